@@ -1,258 +1,303 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/tls"
 	"fmt"
 	"log"
-	"math/rand"
-	"runtime"
+	"net/http"
+	"os"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/auth"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/collector"
 	"github.com/krm-shrftdnv/go-musthave-metrics/internal/compress/gzip"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/encryption"
 	"github.com/krm-shrftdnv/go-musthave-metrics/internal/hash"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/host"
 	customHttp "github.com/krm-shrftdnv/go-musthave-metrics/internal/http"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/mtls"
 	"github.com/krm-shrftdnv/go-musthave-metrics/internal/serializer"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/spool"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/subnet"
 )
 
-type SafeMetricsMap struct {
+type number interface {
+	internal.Gauge | internal.Counter
+	internal.MetricType
+}
+
+type SafeMetricsMap[T number] struct {
 	mx sync.RWMutex
-	m  map[string]*internal.Metric[internal.Gauge]
+	m  map[string]*internal.Metric[T]
 }
 
-func (s *SafeMetricsMap) Get(key string) (*internal.Metric[internal.Gauge], bool) {
+func (s *SafeMetricsMap[T]) Get(key string) (*internal.Metric[T], bool) {
 	s.mx.RLock()
 	defer s.mx.RUnlock()
 	val, ok := s.m[key]
 	return val, ok
 }
 
-func (s *SafeMetricsMap) Set(key string, value internal.Metric[internal.Gauge]) {
+func (s *SafeMetricsMap[T]) Set(key string, value internal.Metric[T]) {
 	s.mx.Lock()
 	defer s.mx.Unlock()
 	s.m[key] = &value
 }
 
-func (s *SafeMetricsMap) Update(key string, newValue internal.Gauge) {
+func (s *SafeMetricsMap[T]) Add(key string, delta T) {
 	s.mx.Lock()
 	defer s.mx.Unlock()
-	s.m[key].Value = newValue
+	if metric, ok := s.m[key]; ok {
+		metric.Value += delta
+		return
+	}
+	s.m[key] = &internal.Metric[T]{Name: key, Value: delta}
 }
 
-func (s *SafeMetricsMap) GetAll() map[string]*internal.Metric[internal.Gauge] {
+func (s *SafeMetricsMap[T]) GetAll() map[string]*internal.Metric[T] {
 	s.mx.RLock()
 	defer s.mx.RUnlock()
 	return s.m
 }
 
-type SafeMetric struct {
-	mx sync.RWMutex
-	m  *internal.Metric[internal.Counter]
+// Take returns current values and resets them to zero.
+func (s *SafeMetricsMap[T]) Take() []internal.Metric[T] {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	metrics := make([]internal.Metric[T], 0, len(s.m))
+	for _, metric := range s.m {
+		metrics = append(metrics, *metric)
+		metric.Value = 0
+	}
+	return metrics
 }
 
-func (s *SafeMetric) Get() *internal.Metric[internal.Counter] {
+func (s *SafeMetricsMap[T]) Snapshot() []internal.Metric[T] {
 	s.mx.RLock()
 	defer s.mx.RUnlock()
-	return s.m
+	metrics := make([]internal.Metric[T], 0, len(s.m))
+	for _, metric := range s.m {
+		metrics = append(metrics, *metric)
+	}
+	return metrics
 }
 
-func (s *SafeMetric) Set(value internal.Metric[internal.Counter]) {
-	s.mx.Lock()
-	defer s.mx.Unlock()
-	s.m = &value
-}
+const pollCountName = "PollCount"
 
-func (s *SafeMetric) Inc() {
-	s.mx.Lock()
-	defer s.mx.Unlock()
-	s.m.Value++
+var gaugeMetrics = &SafeMetricsMap[internal.Gauge]{
+	m: make(map[string]*internal.Metric[internal.Gauge]),
 }
+var counterMetrics = &SafeMetricsMap[internal.Counter]{
+	m: make(map[string]*internal.Metric[internal.Counter]),
+}
+var client *resty.Client
+var staticLabels internal.Labels
 
-var m runtime.MemStats
-var metricNames = []string{
-	"Alloc",
-	"BuckHashSys",
-	"Frees",
-	"GCCPUFraction",
-	"GCSys",
-	"HeapAlloc",
-	"HeapIdle",
-	"HeapInuse",
-	"HeapObjects",
-	"HeapReleased",
-	"HeapSys",
-	"LastGC",
-	"Lookups",
-	"MCacheInuse",
-	"MCacheSys",
-	"MSpanInuse",
-	"MSpanSys",
-	"Mallocs",
-	"NextGC",
-	"NumForcedGC",
-	"NumGC",
-	"OtherSys",
-	"PauseTotalNs",
-	"StackInuse",
-	"StackSys",
-	"Sys",
-	"TotalAlloc",
-	"RandomValue",
+func parseLabels(s string) (internal.Labels, error) {
+	labels := make(internal.Labels)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid label %q, expected name=value", pair)
+		}
+		labels[name] = strings.TrimSpace(value)
+	}
+	return labels, nil
 }
-var pollCount = SafeMetric{
-	m: &internal.Metric[internal.Counter]{
-		Name:  "PollCount",
-		Value: 0,
-	},
+
+func initLabels(s string) error {
+	labels, err := parseLabels(s)
+	if err != nil {
+		return err
+	}
+	staticLabels = make(internal.Labels)
+	if hostname, err := os.Hostname(); err == nil {
+		staticLabels["host"] = hostname
+	} else {
+		log.Printf("error getting hostname: %v\n", err)
+	}
+	staticLabels = staticLabels.Merge(labels)
+	return nil
 }
-var gaugeMetrics = &SafeMetricsMap{
-	m: make(map[string]*internal.Metric[internal.Gauge]),
+
+func registerHostCollectors(names string, diskMounts string) {
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if seen[name] {
+			log.Printf("host collector %q listed twice, skipping\n", name)
+			continue
+		}
+		seen[name] = true
+		switch name {
+		case host.CPUCollectorName:
+			collector.Register(&host.CPUCollector{})
+		case host.MemoryCollectorName:
+			collector.Register(&host.MemoryCollector{})
+		case host.LoadCollectorName:
+			collector.Register(&host.LoadCollector{})
+		case host.NetworkCollectorName:
+			collector.Register(&host.NetworkCollector{})
+		case host.DiskCollectorName:
+			var mounts []string
+			for _, mount := range strings.Split(diskMounts, ",") {
+				if mount = strings.TrimSpace(mount); mount != "" {
+					mounts = append(mounts, mount)
+				}
+			}
+			collector.Register(&host.DiskCollector{Mounts: mounts})
+		default:
+			log.Printf("unknown host collector %q, skipping\n", name)
+		}
+	}
 }
-var client *resty.Client
 
 func main() {
 	parseFlags()
 
-	for _, metricName := range metricNames {
-		gaugeMetrics.Set(metricName, internal.Metric[internal.Gauge]{Name: metricName})
+	if err := initLabels(cfg.Labels); err != nil {
+		panic(err)
+	}
+	collector.Register(&collector.RuntimeCollector{})
+	registerHostCollectors(cfg.HostCollectors, cfg.DiskMounts)
+	if cfg.SpoolDir != "" {
+		var err error
+		metricsSpool, err = spool.New(cfg.SpoolDir, cfg.SpoolMaxSize, time.Duration(cfg.SpoolMaxAge)*time.Second)
+		if err != nil {
+			panic(err)
+		}
+	}
+	var tlsConfig *tls.Config
+	if cfg.TLS || cfg.TLSCA != "" || cfg.TLSCert != "" || cfg.TLSKey != "" {
+		var err error
+		tlsConfig, err = mtls.ClientConfig(cfg.TLSCA, cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			panic(err)
+		}
+		serverScheme = "https"
+	}
+	var publicKey *encryption.PublicKey
+	if cfg.CryptoKey != "" {
+		var err error
+		publicKey, err = encryption.LoadPublicKey(cfg.CryptoKey)
+		if err != nil {
+			panic(err)
+		}
 	}
-	client = resty.New().
-		SetTransport(customHttp.Chain(nil, gzip.CompressRequest(), hash.HashRequest(cfg.HashKey)))
+	serverAddress := cfg.ServerAddress
+	if cfg.Transport == "grpc" {
+		serverAddress = cfg.GRPCAddress
+	}
+	realIP, err := subnet.OutboundIP(serverAddress)
+	if err != nil {
+		log.Printf("failed to discover outbound address, not sending %s: %v\n", subnet.Header, err)
+	}
+	switch cfg.Transport {
+	case "", "http":
+		var transport http.RoundTripper
+		if tlsConfig != nil {
+			t := http.DefaultTransport.(*http.Transport).Clone()
+			t.TLSClientConfig = tlsConfig
+			transport = t
+		}
+		client = resty.New().
+			SetTransport(customHttp.Chain(transport, encryption.EncryptRequest(publicKey), gzip.CompressRequest(), hash.HashRequest(cfg.HashKey), subnet.RealIPRequest(realIP), auth.BearerRequest(cfg.Token)))
+	case "grpc":
+		if publicKey != nil {
+			log.Println("crypto key is only used by the http transport")
+		}
+		if err := initGRPC(tlsConfig, realIP); err != nil {
+			panic(err)
+		}
+	default:
+		panic(fmt.Sprintf("unknown transport %q, expected http or grpc", cfg.Transport))
+	}
+	ctx := context.Background()
 	go func() {
-		poll()
+		poll(ctx)
 	}()
+	for _, c := range collector.Collectors() {
+		go func(c collector.Collector) {
+			pollCollector(ctx, c)
+		}(c)
+	}
+
+	rateLimit := cfg.RateLimit
+	if rateLimit < 1 {
+		rateLimit = 1
+	}
+	batches := make(chan []serializer.Metrics, rateLimit)
+	for i := int64(0); i < rateLimit; i++ {
+		go func() {
+			sendWorker(ctx, batches)
+		}()
+	}
 	go func() {
-		sendMetrics()
+		report(ctx, batches)
 	}()
 	select {}
 }
 
-func poll() {
-	for range time.Tick(time.Duration(cfg.PollInterval) * time.Second) {
-		runtime.ReadMemStats(&m)
-		pollCount.Inc()
-		for _, metricName := range metricNames {
-			updateMetric(metricName)
+func poll(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(cfg.PollInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			counterMetrics.Add(pollCountName, 1)
 		}
 	}
 }
 
-func updateMetric(name string) {
-	_, ok := gaugeMetrics.Get(name)
-	randNum := internal.Gauge(rand.Float64()) * 1000
-	if !ok {
-		return
-	}
-	switch name {
-	case "Alloc":
-		gaugeMetrics.Update(name, internal.Gauge(m.Alloc)/(1024*1024))
-	case "BuckHashSys":
-		gaugeMetrics.Update(name, internal.Gauge(m.BuckHashSys)/(1024*1024))
-	case "Frees":
-		gaugeMetrics.Update(name, internal.Gauge(m.Frees)/(1024*1024))
-	case "GCCPUFraction":
-		gaugeMetrics.Update(name, internal.Gauge(m.GCCPUFraction)/(1024*1024))
-	case "GCSys":
-		gaugeMetrics.Update(name, internal.Gauge(m.GCSys)/(1024*1024))
-	case "HeapAlloc":
-		gaugeMetrics.Update(name, internal.Gauge(m.HeapAlloc)/(1024*1024))
-	case "HeapIdle":
-		gaugeMetrics.Update(name, internal.Gauge(m.HeapIdle)/(1024*1024))
-	case "HeapInuse":
-		gaugeMetrics.Update(name, internal.Gauge(m.HeapInuse)/(1024*1024))
-	case "HeapObjects":
-		gaugeMetrics.Update(name, internal.Gauge(m.HeapObjects)/(1024*1024))
-	case "HeapReleased":
-		gaugeMetrics.Update(name, internal.Gauge(m.HeapReleased)/(1024*1024))
-	case "HeapSys":
-		gaugeMetrics.Update(name, internal.Gauge(m.HeapSys)/(1024*1024))
-	case "LastGC":
-		gaugeMetrics.Update(name, internal.Gauge(m.LastGC)/(1024*1024))
-	case "Lookups":
-		gaugeMetrics.Update(name, internal.Gauge(m.Lookups)/(1024*1024))
-	case "MCacheInuse":
-		gaugeMetrics.Update(name, internal.Gauge(m.MCacheInuse)/(1024*1024))
-	case "MCacheSys":
-		gaugeMetrics.Update(name, internal.Gauge(m.MCacheSys)/(1024*1024))
-	case "MSpanInuse":
-		gaugeMetrics.Update(name, internal.Gauge(m.MSpanInuse)/(1024*1024))
-	case "MSpanSys":
-		gaugeMetrics.Update(name, internal.Gauge(m.MSpanSys)/(1024*1024))
-	case "Mallocs":
-		gaugeMetrics.Update(name, internal.Gauge(m.Mallocs)/(1024*1024))
-	case "NextGC":
-		gaugeMetrics.Update(name, internal.Gauge(m.NextGC)/(1024*1024))
-	case "NumForcedGC":
-		gaugeMetrics.Update(name, internal.Gauge(m.NumForcedGC)/(1024*1024))
-	case "NumGC":
-		gaugeMetrics.Update(name, internal.Gauge(m.NumGC)/(1024*1024))
-	case "OtherSys":
-		gaugeMetrics.Update(name, internal.Gauge(m.OtherSys)/(1024*1024))
-	case "PauseTotalNs":
-		gaugeMetrics.Update(name, internal.Gauge(m.PauseTotalNs)/(1024*1024))
-	case "StackInuse":
-		gaugeMetrics.Update(name, internal.Gauge(m.StackInuse)/(1024*1024))
-	case "StackSys":
-		gaugeMetrics.Update(name, internal.Gauge(m.StackSys)/(1024*1024))
-	case "Sys":
-		gaugeMetrics.Update(name, internal.Gauge(m.Sys)/(1024*1024))
-	case "TotalAlloc":
-		gaugeMetrics.Update(name, internal.Gauge(m.TotalAlloc)/(1024*1024))
-	case "RandomValue":
-		gaugeMetrics.Update(name, randNum)
+func pollCollector(ctx context.Context, c collector.Collector) {
+	ticker := time.NewTicker(time.Duration(cfg.PollInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			collectMetrics(ctx, c)
+		}
 	}
 }
 
-func sendMetrics() {
-	const maxAttempts = 3
-	for range time.Tick(time.Duration(cfg.ReportInterval) * time.Second) {
-		var metrics []serializer.Metrics
-		gaugeMetricsMap := gaugeMetrics.GetAll()
-		gaugeMetrics.mx.RLock()
-		for k, v := range gaugeMetricsMap {
-			metrics = append(metrics, serializer.Metrics{
-				ID:    k,
-				MType: string(v.Value.GetTypeName()),
-				Value: &v.Value,
-			})
-		}
-		pollCountMetric := pollCount.Get()
-		metrics = append(metrics, serializer.Metrics{
-			ID:    pollCountMetric.Name,
-			MType: string(pollCountMetric.Value.GetTypeName()),
-			Delta: &pollCountMetric.Value,
-		})
-		gaugeMetrics.mx.RUnlock()
-
-		if len(metrics) == 0 {
-			continue
-		}
-
-		req := client.R()
-		pollCount.mx.RLock()
-		gaugeMetrics.mx.RLock()
-		body, err := json.Marshal(metrics)
-		pollCount.mx.RUnlock()
-		gaugeMetrics.mx.RUnlock()
+func collectMetrics(ctx context.Context, collectors ...collector.Collector) {
+	for _, c := range collectors {
+		metrics, err := c.Collect(ctx)
 		if err != nil {
-			log.Printf("error marshalling metrics: %v\n", err)
+			log.Printf("error collecting %s metrics: %v\n", c.Name(), err)
+			continue
 		}
-		_, err = req.
-			SetBody(body).
-			SetHeader("Content-Type", "application/json; charset=utf-8").
-			Post(fmt.Sprintf("http://%s/updates/", cfg.ServerAddress))
-		i := 0
-		for err != nil && i < maxAttempts {
-			log.Printf("error sending metrics: %v. waiting %d seconds\n", err, 2*i+1)
-			time.Sleep(time.Duration(2*i+1) * time.Second)
-			log.Printf("retrying: attempt %d\n", i+1)
-			_, err = req.
-				SetBody(body).
-				SetHeader("Content-Type", "application/json; charset=utf-8").
-				Post(fmt.Sprintf("http://%s/updates/", cfg.ServerAddress))
-			i++
+		for _, m := range metrics {
+			switch internal.MetricTypeName(m.MType) {
+			case internal.GaugeName:
+				if m.Value != nil {
+					key := internal.SeriesKey(m.ID, m.Labels)
+					gaugeMetrics.Set(key, internal.Metric[internal.Gauge]{Name: key, Value: *m.Value})
+				}
+			case internal.CounterName:
+				if m.Delta != nil {
+					counterMetrics.Add(internal.SeriesKey(m.ID, m.Labels), *m.Delta)
+				}
+			default:
+				log.Printf("collector %s returned unsupported metric type %q\n", c.Name(), m.MType)
+			}
 		}
 	}
 }
@@ -1,38 +1,268 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
 	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/collector"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/host"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/serializer"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/spool"
 	"github.com/stretchr/testify/assert"
-	"testing"
+	"github.com/stretchr/testify/require"
 )
 
-var gaugeTestMetrics = map[string]*internal.Metric[internal.Gauge]{}
+type testCollector struct {
+	metrics []serializer.Metrics
+}
+
+func (c *testCollector) Name() string {
+	return "test"
+}
+
+func (c *testCollector) Collect(context.Context) ([]serializer.Metrics, error) {
+	return c.metrics, nil
+}
+
+func Test_collectMetrics(t *testing.T) {
+	collector.Register(&testCollector{
+		metrics: []serializer.Metrics{
+			serializer.NewGauge("TestGauge", 1.5),
+			serializer.NewCounter("TestCounter", 2),
+		},
+	})
+	defer collector.Unregister("test")
+
+	tests := []struct {
+		name        string
+		wantGauge   internal.Gauge
+		wantCounter internal.Counter
+	}{
+		{name: "first poll", wantGauge: 1.5, wantCounter: 2},
+		{name: "second poll", wantGauge: 1.5, wantCounter: 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collectMetrics(context.Background(), collector.Collectors()...)
+			gauge, ok := gaugeMetrics.Get("TestGauge")
+			require.True(t, ok)
+			assert.Equal(t, tt.wantGauge, gauge.Value)
+			counter, ok := counterMetrics.Get("TestCounter")
+			require.True(t, ok)
+			assert.Equal(t, tt.wantCounter, counter.Value)
+		})
+	}
+}
+
+func Test_sendWorker_rateLimit(t *testing.T) {
+	const rateLimit = 2
+	const batchCount = 6
+	var inFlight, maxInFlight, received int32
+	var wg sync.WaitGroup
+	wg.Add(batchCount)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer wg.Done()
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			previous := atomic.LoadInt32(&maxInFlight)
+			if current <= previous || atomic.CompareAndSwapInt32(&maxInFlight, previous, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&received, 1)
+	}))
+	defer srv.Close()
+	client = resty.New()
+	cfg.ServerAddress = strings.TrimPrefix(srv.URL, "http://")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	batches := make(chan []serializer.Metrics)
+	var workers sync.WaitGroup
+	for i := 0; i < rateLimit; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			sendWorker(ctx, batches)
+		}()
+	}
+	for i := 0; i < batchCount; i++ {
+		batches <- []serializer.Metrics{serializer.NewGauge("TestGauge", internal.Gauge(i))}
+	}
+	wg.Wait()
+	// stop the workers before the next test replaces the globals they read
+	cancel()
+	workers.Wait()
+
+	assert.Equal(t, int32(batchCount), atomic.LoadInt32(&received))
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxInFlight), int32(rateLimit))
+}
+
+type counterServer struct {
+	mx       sync.Mutex
+	fail     int
+	requests int
+	total    internal.Counter
+}
+
+func (s *counterServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.requests++
+	if s.fail != 0 {
+		if s.fail > 0 {
+			s.fail--
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var metrics []serializer.Metrics
+	if err := json.NewDecoder(r.Body).Decode(&metrics); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	for _, m := range metrics {
+		if m.ID == pollCountName && m.Delta != nil {
+			s.total += *m.Delta
+		}
+	}
+}
+
+func (s *counterServer) setFail(fail int) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.fail = fail
+}
+
+func (s *counterServer) state() (int, internal.Counter) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	return s.requests, s.total
+}
 
-func Test_updateMetric(t *testing.T) {
-	type args struct {
-		name string
+func Test_deliver(t *testing.T) {
+	retryDelay = func(int) time.Duration { return 0 }
+	type step struct {
+		polls        internal.Counter
+		fail         int
+		wantErr      bool
+		wantRequests int
+		wantTotal    internal.Counter
 	}
 	tests := []struct {
-		name string
-		args args
+		name     string
+		useSpool bool
+		steps    []step
 	}{
 		{
-			name: "success",
-			args: args{
-				name: "Alloc",
+			name: "acknowledged increments are not resent",
+			steps: []step{
+				{polls: 3, wantRequests: 1, wantTotal: 3},
+				{polls: 2, wantRequests: 2, wantTotal: 5},
+			},
+		},
+		{
+			name: "retried batch is counted once",
+			steps: []step{
+				{polls: 3, fail: 2, wantRequests: 3, wantTotal: 3},
+			},
+		},
+		{
+			name: "unacknowledged increments are carried over",
+			steps: []step{
+				{polls: 3, fail: -1, wantErr: true, wantRequests: maxAttempts + 1, wantTotal: 0},
+				{polls: 2, wantRequests: maxAttempts + 2, wantTotal: 5},
+			},
+		},
+		{
+			name:     "spooled increments are replayed once",
+			useSpool: true,
+			steps: []step{
+				{polls: 3, fail: -1, wantRequests: maxAttempts + 1, wantTotal: 0},
+				{polls: 2, wantRequests: maxAttempts + 3, wantTotal: 5},
+				{polls: 1, wantRequests: maxAttempts + 4, wantTotal: 6},
 			},
 		},
 	}
-	for _, metricName := range metricNames {
-		gaugeTestMetrics[metricName] = &internal.Metric[internal.Gauge]{
-			Name: metricName,
-		}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &counterServer{}
+			httpSrv := httptest.NewServer(srv)
+			defer httpSrv.Close()
+			client = resty.New()
+			cfg.ServerAddress = strings.TrimPrefix(httpSrv.URL, "http://")
+			counterMetrics = &SafeMetricsMap[internal.Counter]{m: make(map[string]*internal.Metric[internal.Counter])}
+			metricsSpool = nil
+			if tt.useSpool {
+				var err error
+				metricsSpool, err = spool.New(t.TempDir(), 0, 0)
+				require.NoError(t, err)
+				defer func() { metricsSpool = nil }()
+			}
+
+			for _, st := range tt.steps {
+				counterMetrics.Add(pollCountName, st.polls)
+				srv.setFail(st.fail)
+				err := deliver(context.Background(), buildBatch())
+				if st.wantErr {
+					assert.Error(t, err)
+				} else {
+					assert.NoError(t, err)
+				}
+				requests, total := srv.state()
+				assert.Equal(t, st.wantRequests, requests)
+				assert.Equal(t, st.wantTotal, total)
+			}
+		})
+	}
+}
+
+func Test_parseLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    internal.Labels
+		wantErr bool
+	}{
+		{name: "empty", s: "", want: internal.Labels{}},
+		{name: "pairs", s: "env=prod, service=api", want: internal.Labels{"env": "prod", "service": "api"}},
+		{name: "missing value separator", s: "env", wantErr: true},
+		{name: "missing name", s: "=prod", wantErr: true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			oldValue := &gaugeTestMetrics[tt.args.name].Value
-			updateMetric(tt.args.name)
-			assert.Equal(t, oldValue, &gaugeTestMetrics[tt.args.name].Value, "updateMetric() = %v, want %v", oldValue, &gaugeTestMetrics[tt.args.name].Value)
+			got, err := parseLabels(tt.s)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
 		})
 	}
 }
+
+func Test_registerHostCollectors(t *testing.T) {
+	defer collector.Unregister(host.CPUCollectorName)
+	defer collector.Unregister(host.LoadCollectorName)
+	assert.NotPanics(t, func() {
+		registerHostCollectors("cpu, load,cpu,unknown", "")
+	})
+	var names []string
+	for _, c := range collector.Collectors() {
+		if c.Name() == host.CPUCollectorName || c.Name() == host.LoadCollectorName {
+			names = append(names, c.Name())
+		}
+	}
+	assert.Equal(t, []string{host.CPUCollectorName, host.LoadCollectorName}, names)
+}
@@ -13,9 +13,24 @@ var cfg internal.Config
 
 func parseFlags() {
 	flag.StringVar(&cfg.ServerAddress, "a", "localhost:8080", "address and port to run server")
+	flag.StringVar(&cfg.GRPCAddress, "grpc-address", "localhost:3200", "address and port of gRPC server")
+	flag.StringVar(&cfg.Transport, "transport", "http", "transport to send metrics with, http or grpc")
 	flag.Int64Var(&cfg.PollInterval, "p", 2, "poll interval")
 	flag.Int64Var(&cfg.ReportInterval, "r", 10, "report interval")
 	flag.StringVar(&cfg.HashKey, "k", "", "hash key")
+	flag.BoolVar(&cfg.TLS, "tls", false, "connect over TLS, implied by the other -tls flags")
+	flag.StringVar(&cfg.TLSCA, "tls-ca", "", "PEM file with CAs to verify the server with instead of the system ones")
+	flag.StringVar(&cfg.TLSCert, "tls-cert", "", "PEM file with the client certificate for mutual TLS")
+	flag.StringVar(&cfg.TLSKey, "tls-key", "", "PEM file with the client private key")
+	flag.StringVar(&cfg.Token, "token", "", "bearer token with the writer role")
+	flag.StringVar(&cfg.CryptoKey, "crypto-key", "", "PEM file with the server's RSA or X25519 public key to encrypt payloads for")
+	flag.Int64Var(&cfg.RateLimit, "l", 1, "max number of concurrent outgoing requests")
+	flag.StringVar(&cfg.SpoolDir, "spool-dir", "", "directory to spool unsent batches to, disabled if empty")
+	flag.Int64Var(&cfg.SpoolMaxSize, "spool-max-size", 64*1024*1024, "max spool size in bytes")
+	flag.Int64Var(&cfg.SpoolMaxAge, "spool-max-age", 3600, "max age of spooled batches in seconds")
+	flag.StringVar(&cfg.Labels, "labels", "", "comma-separated static labels attached to every metric, e.g. env=prod,service=api")
+	flag.StringVar(&cfg.HostCollectors, "collectors", "cpu,mem,load,net,disk", "comma-separated host collectors to enable (cpu, mem, load, net, disk)")
+	flag.StringVar(&cfg.DiskMounts, "disk-mounts", "/", "comma-separated mount points for disk collector")
 	flag.Parse()
 
 	if err := godotenv.Load(".env", ".env.local"); err != nil {
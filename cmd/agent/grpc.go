@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/auth"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/hash"
+	pb "github.com/krm-shrftdnv/go-musthave-metrics/internal/proto"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/serializer"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/subnet"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+)
+
+var grpcClient pb.MetricsClient
+
+func initGRPC(tlsConfig *tls.Config, realIP net.IP) error {
+	creds := insecure.NewCredentials()
+	if tlsConfig != nil {
+		creds = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpc.Dial(
+		cfg.GRPCAddress,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)),
+		grpc.WithChainUnaryInterceptor(hash.HashUnaryRequest(cfg.HashKey), subnet.RealIPUnaryRequest(realIP), auth.BearerUnaryRequest(cfg.Token)),
+	)
+	if err != nil {
+		return err
+	}
+	grpcClient = pb.NewMetricsClient(conn)
+	return nil
+}
+
+func updateMetrics(ctx context.Context, body []byte) error {
+	var metrics []serializer.Metrics
+	if err := json.Unmarshal(body, &metrics); err != nil {
+		return fmt.Errorf("error unmarshalling metrics: %w", err)
+	}
+	req := &pb.UpdateMetricsRequest{Metrics: make([]*pb.Metric, 0, len(metrics))}
+	for _, metric := range metrics {
+		m, err := pb.FromMetrics(metric)
+		if err != nil {
+			return err
+		}
+		req.Metrics = append(req.Metrics, m)
+	}
+	_, err := grpcClient.UpdateMetrics(ctx, req)
+	return err
+}
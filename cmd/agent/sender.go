@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/serializer"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/spool"
+)
+
+var metricsSpool *spool.Spool
+
+// serverScheme becomes https when the agent is configured for TLS.
+var serverScheme = "http"
+
+const maxAttempts = 3
+
+var retryDelay = func(attempt int) time.Duration {
+	return time.Duration(2*attempt+1) * time.Second
+}
+
+func report(ctx context.Context, batches chan<- []serializer.Metrics) {
+	ticker := time.NewTicker(time.Duration(cfg.ReportInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			metrics := buildBatch()
+			if len(metrics) == 0 {
+				continue
+			}
+			select {
+			case batches <- metrics:
+			case <-ctx.Done():
+				restoreCounters(metrics)
+				return
+			}
+		}
+	}
+}
+
+// buildBatch takes counter increments accumulated since the previous batch,
+// so the server receives every increment exactly once.
+func buildBatch() []serializer.Metrics {
+	var metrics []serializer.Metrics
+	for _, m := range gaugeMetrics.Snapshot() {
+		metrics = append(metrics, withLabels(serializer.NewGauge(m.Name, m.Value)))
+	}
+	for _, m := range counterMetrics.Take() {
+		metrics = append(metrics, withLabels(serializer.NewCounter(m.Name, m.Value)))
+	}
+	return metrics
+}
+
+// withLabels splits a series key into the metric name and its own labels
+// and adds the static agent labels to them.
+func withLabels(m serializer.Metrics) serializer.Metrics {
+	name, labels, err := internal.ParseSeriesKey(m.ID)
+	if err != nil {
+		return m
+	}
+	m.ID = name
+	m.Labels = staticLabels.Merge(labels)
+	if len(m.Labels) == 0 {
+		m.Labels = nil
+	}
+	return m
+}
+
+// restoreCounters carries unacknowledged increments over to the next batch.
+func restoreCounters(metrics []serializer.Metrics) {
+	for _, m := range metrics {
+		if internal.MetricTypeName(m.MType) == internal.CounterName && m.Delta != nil {
+			counterMetrics.Add(internal.SeriesKey(m.ID, m.Labels.Without(staticLabels)), *m.Delta)
+		}
+	}
+}
+
+func sendWorker(ctx context.Context, batches <-chan []serializer.Metrics) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case metrics := <-batches:
+			if err := deliver(ctx, metrics); err != nil {
+				log.Printf("error sending metrics: %v\n", err)
+			}
+		}
+	}
+}
+
+// deliver replays spooled batches before the live one to keep them in order.
+// A batch that can't be sent is spooled, and its counter increments are
+// considered handed off to the spool; without a spool they are carried over.
+func deliver(ctx context.Context, metrics []serializer.Metrics) error {
+	body, err := json.Marshal(metrics)
+	if err != nil {
+		restoreCounters(metrics)
+		return fmt.Errorf("error marshalling metrics: %w", err)
+	}
+	if metricsSpool != nil {
+		err = metricsSpool.Replay(func(batch []byte) error {
+			return postMetrics(ctx, batch)
+		})
+	}
+	if err == nil {
+		err = sendBatch(ctx, body)
+	}
+	if err == nil {
+		return nil
+	}
+	if metricsSpool != nil {
+		spoolErr := metricsSpool.Append(body)
+		if spoolErr == nil {
+			log.Printf("error sending metrics: %v. batch spooled\n", err)
+			return nil
+		}
+		log.Printf("error spooling metrics: %v\n", spoolErr)
+	}
+	restoreCounters(metrics)
+	return err
+}
+
+func sendBatch(ctx context.Context, body []byte) error {
+	err := postMetrics(ctx, body)
+	for i := 0; err != nil && i < maxAttempts; i++ {
+		delay := retryDelay(i)
+		log.Printf("error sending metrics: %v. waiting %v\n", err, delay)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		log.Printf("retrying: attempt %d\n", i+1)
+		err = postMetrics(ctx, body)
+	}
+	return err
+}
+
+// postMetrics sends a JSON batch, as kept in the spool, over the configured transport.
+func postMetrics(ctx context.Context, body []byte) error {
+	if grpcClient != nil {
+		return updateMetrics(ctx, body)
+	}
+	resp, err := client.R().
+		SetContext(ctx).
+		SetBody(body).
+		SetHeader("Content-Type", "application/json; charset=utf-8").
+		Post(fmt.Sprintf("%s://%s/updates/", serverScheme, cfg.ServerAddress))
+	if err != nil {
+		return err
+	}
+	if resp.IsError() {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode())
+	}
+	return nil
+}
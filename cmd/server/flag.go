@@ -8,12 +8,14 @@ import (
 	"github.com/caarlos0/env/v6"
 	"github.com/joho/godotenv"
 	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/stream"
 )
 
 var cfg internal.Config
 
 func parseFlags() {
 	flag.StringVar(&cfg.ServerAddress, "a", ":8080", "address and port to run server")
+	flag.StringVar(&cfg.GRPCAddress, "grpc-address", "", "address and port to run gRPC server, empty disables it")
 	flag.StringVar(&cfg.LogLevel, "l", "info", "log level")
 	flag.Int64Var(&cfg.StoreInterval, "i", 10, "store interval")
 	absPath, err := filepath.Abs("../../tmp/metrics-db.json")
@@ -24,6 +26,26 @@ func parseFlags() {
 	flag.BoolVar(&cfg.Restore, "r", true, "restore from file")
 	flag.StringVar(&cfg.DatabaseDsn, "d", "", "database dsn")
 	flag.StringVar(&cfg.HashKey, "k", "", "hash key")
+	flag.StringVar(&cfg.TLSCert, "tls-cert", "", "PEM file with the TLS certificate, serves HTTPS and gRPC over TLS with -tls-key")
+	flag.StringVar(&cfg.TLSKey, "tls-key", "", "PEM file with the TLS private key")
+	flag.StringVar(&cfg.TLSClientCA, "tls-client-ca", "", "PEM file with CAs that sign client certificates, requires them when set")
+	flag.StringVar(&cfg.TrustedSubnet, "t", "", "comma-separated CIDRs allowed to send updates on any ingest path, checked against X-Real-IP or the sender address; empty allows everyone")
+	flag.BoolVar(&cfg.Auth, "auth", false, "require bearer tokens, with the writer role for ingestion, reader for queries and admin for /admin")
+	flag.StringVar(&cfg.AuthTokens, "auth-tokens", "", "JSON file to keep hashed tokens in, the database is used when empty")
+	flag.StringVar(&cfg.AdminToken, "admin-token", "", "token with the admin role to create the other tokens with")
+	flag.StringVar(&cfg.CryptoKey, "crypto-key", "", "PEM file with the RSA or X25519 private key to decrypt agent payloads with")
+	flag.Float64Var(&cfg.SummaryAccuracy, "summary-accuracy", internal.DefaultSummaryAccuracy, "relative accuracy of summary quantiles")
+	flag.UintVar(&cfg.SetPrecision, "set-precision", internal.DefaultSetPrecision, "HyperLogLog precision of set metrics, from 4 to 18")
+	flag.Int64Var(&cfg.HistoryRetention, "history-retention", 3600, "seconds of raw gauge and counter history to keep for metrics without a policy, 0 disables history")
+	flag.StringVar(&cfg.HistoryPolicies, "history-policies", "", "retention tiers per metric name pattern, e.g. \"Go*=raw:1h;*=raw:24h,1m:30d,1h:1y\"")
+	flag.StringVar(&cfg.StatsdAddress, "statsd-address", "", "UDP address to receive StatsD on, empty disables the listener")
+	flag.Int64Var(&cfg.StatsdFlush, "statsd-flush-interval", 10, "seconds between flushes of StatsD timer gauges")
+	flag.StringVar(&cfg.GraphiteAddress, "graphite-address", "", "TCP address to receive Graphite plaintext on, empty disables the listener")
+	flag.StringVar(&cfg.LineCounters, "line-protocol-counters", "", "comma-separated metric name patterns of line protocol fields kept as counter totals besides the _total ones, e.g. \"net_bytes_*,diskio_*\"")
+	flag.StringVar(&cfg.GraphiteRules, "graphite-rules", "", "YAML file with rules mapping Graphite paths to metric names and labels")
+	flag.Int64Var(&cfg.StreamBuffer, "stream-buffer", stream.DefaultBufferSize, "updates buffered per /stream subscriber before they are dropped")
+	flag.StringVar(&cfg.AlertRules, "alert-rules", "", "YAML file with alerting rules and webhooks, empty disables alerting")
+	flag.StringVar(&cfg.HistogramBuckets, "histogram-buckets", "0.005,0.01,0.025,0.05,0.1,0.25,0.5,1,2.5,5,10", "comma-separated histogram bucket upper bounds")
 	flag.Parse()
 
 	if err := godotenv.Load(".env", ".env.local"); err != nil {
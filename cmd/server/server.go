@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"database/sql"
+	"errors"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,17 +15,78 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/alert"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/auth"
 	"github.com/krm-shrftdnv/go-musthave-metrics/internal/compress/gzip"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/dashboard"
 	"github.com/krm-shrftdnv/go-musthave-metrics/internal/db"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/encryption"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/graphite"
 	"github.com/krm-shrftdnv/go-musthave-metrics/internal/handlers"
 	"github.com/krm-shrftdnv/go-musthave-metrics/internal/hash"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/lineprotocol"
 	"github.com/krm-shrftdnv/go-musthave-metrics/internal/logger"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/mtls"
+	pb "github.com/krm-shrftdnv/go-musthave-metrics/internal/proto"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/series"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/statsd"
 	"github.com/krm-shrftdnv/go-musthave-metrics/internal/storage"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/stream"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/subnet"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	_ "google.golang.org/grpc/encoding/gzip"
 )
 
-func run(handler http.Handler) error {
-	logger.Log.Infoln("Running server on ", cfg.ServerAddress)
-	return http.ListenAndServe(cfg.ServerAddress, handler)
+func run(handler http.Handler, tlsConfig *tls.Config) error {
+	if tlsConfig == nil {
+		logger.Log.Infoln("Running server on ", cfg.ServerAddress)
+		return http.ListenAndServe(cfg.ServerAddress, handler)
+	}
+	srv := &http.Server{
+		Addr:      cfg.ServerAddress,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
+	logger.Log.Infoln("Running HTTPS server on ", cfg.ServerAddress)
+	return srv.ListenAndServeTLS("", "")
+}
+
+// grpcRoles are the roles the gRPC methods require when authentication is on.
+var grpcRoles = map[string]auth.Role{
+	pb.Metrics_UpdateMetrics_FullMethodName: auth.Writer,
+	pb.Metrics_PushMetrics_FullMethodName:   auth.Writer,
+	pb.Metrics_GetMetric_FullMethodName:     auth.Reader,
+	pb.Metrics_ListMetrics_FullMethodName:   auth.Reader,
+}
+
+func runGRPC(srv pb.MetricsServer, tlsConfig *tls.Config, trusted subnet.Subnets, authn *auth.Authenticator) error {
+	listen, err := net.Listen("tcp", cfg.GRPCAddress)
+	if err != nil {
+		return err
+	}
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			mtls.UnaryIdentity,
+			logger.UnaryWithLogging,
+			subnet.NewUnaryInterceptor(trusted, pb.Metrics_UpdateMetrics_FullMethodName),
+			authn.NewUnaryInterceptor(grpcRoles),
+			hash.NewUnaryInterceptor(cfg.HashKey),
+		),
+		grpc.ChainStreamInterceptor(
+			mtls.StreamIdentity,
+			logger.StreamWithLogging,
+			subnet.NewStreamInterceptor(trusted, pb.Metrics_PushMetrics_FullMethodName),
+			authn.NewStreamInterceptor(grpcRoles),
+		),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	s := grpc.NewServer(opts...)
+	pb.RegisterMetricsServer(s, srv)
+	logger.Log.Infoln("Running gRPC server on ", cfg.GRPCAddress)
+	return s.Serve(listen)
 }
 
 func saveMetrics(ctx context.Context, storeInterval int64) {
@@ -34,9 +98,88 @@ func saveMetrics(ctx context.Context, storeInterval int64) {
 	}
 }
 
+func compactHistory(ctx context.Context, history *series.Store) {
+	for now := range time.Tick(time.Minute) {
+		err := history.Compact(ctx, now)
+		if err != nil {
+			logger.Log.Errorln(err)
+		}
+	}
+}
+
+func flushHistory(ctx context.Context, history *series.Store) {
+	for range time.Tick(time.Second) {
+		if err := history.Flush(ctx); err != nil {
+			logger.Log.Errorln(err)
+		}
+	}
+}
+
+func newHistory(database *sql.DB) (*series.Store, error) {
+	policies, err := series.ParsePolicies(cfg.HistoryPolicies)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.HistoryRetention > 0 {
+		policies = append(policies, series.Policy{
+			Pattern: "*",
+			Tiers:   []series.Tier{{Retention: time.Duration(cfg.HistoryRetention) * time.Second}},
+		})
+	}
+	if len(policies) == 0 {
+		return nil, nil
+	}
+	if database != nil {
+		return series.NewDBStore(database, policies), nil
+	}
+	return series.NewStore(policies), nil
+}
+
+// newAuthenticator keeps tokens in the tokens file, or the database without one.
+// It returns nil when authentication is off.
+func newAuthenticator(database *sql.DB) (*auth.Authenticator, error) {
+	if !cfg.Auth {
+		return nil, nil
+	}
+	var store auth.Store
+	switch {
+	case cfg.AuthTokens != "":
+		fileStore, err := auth.NewFileStore(cfg.AuthTokens)
+		if err != nil {
+			return nil, err
+		}
+		store = fileStore
+	case database != nil:
+		store = &auth.DBStore{DB: database}
+	default:
+		return nil, errors.New("authentication needs a tokens file or a database to keep tokens in")
+	}
+	if cfg.AdminToken == "" {
+		logger.Log.Warnln("no admin token is configured, tokens can't be managed over /admin/tokens until one is")
+	}
+	return &auth.Authenticator{Store: store, AdminToken: cfg.AdminToken}, nil
+}
+
+func newStorage[T storage.Element](database *sql.DB) storage.Storage[T] {
+	memStorage := &storage.MemStorage[T]{}
+	memStorage.Init()
+	switch {
+	case database != nil:
+		return &storage.DBStorage[T]{
+			MemStorage: memStorage,
+			DB:         database,
+		}
+	case cfg.Restore && cfg.FileStoragePath != "":
+		return &storage.FileStorage[T]{
+			MemStorage: memStorage,
+			FilePath:   cfg.FileStoragePath,
+		}
+	default:
+		return memStorage
+	}
+}
+
 func main() {
-	var counterStorage storage.Storage[internal.Counter]
-	var gaugeStorage storage.Storage[internal.Gauge]
 	var database *sql.DB
 	ctx := context.TODO()
 
@@ -45,51 +188,51 @@ func main() {
 		panic(err)
 	}
 
-	counterMemStorage := &storage.MemStorage[internal.Counter]{}
-	gaugeMemStorage := &storage.MemStorage[internal.Gauge]{}
-	counterMemStorage.Init()
-	gaugeMemStorage.Init()
-	switch {
-	case cfg.DatabaseDsn != "":
-		{
-			var err error
-			database, err = db.Init(cfg.DatabaseDsn)
-			if err != nil {
-				panic(err)
-			}
-			err = db.CreateTable(ctx, database)
-			if err != nil {
-				panic(err)
-			}
-			counterStorage = &storage.DBStorage[internal.Counter]{
-				MemStorage: counterMemStorage,
-				DB:         database,
-			}
-			gaugeStorage = &storage.DBStorage[internal.Gauge]{
-				MemStorage: gaugeMemStorage,
-				DB:         database,
-			}
-			break
+	var tlsConfig *tls.Config
+	if cfg.TLSCert != "" || cfg.TLSKey != "" || cfg.TLSClientCA != "" {
+		var err error
+		tlsConfig, err = mtls.ServerConfig(cfg.TLSCert, cfg.TLSKey, cfg.TLSClientCA)
+		if err != nil {
+			panic(err)
 		}
-	case cfg.Restore && cfg.FileStoragePath != "":
-		{
-			counterStorage = &storage.FileStorage[internal.Counter]{
-				MemStorage: counterMemStorage,
-				FilePath:   cfg.FileStoragePath,
-			}
-			gaugeStorage = &storage.FileStorage[internal.Gauge]{
-				MemStorage: gaugeMemStorage,
-				FilePath:   cfg.FileStoragePath,
-			}
-			break
+	}
+	trustedSubnets, err := subnet.Parse(cfg.TrustedSubnet)
+	if err != nil {
+		panic(err)
+	}
+	var privateKey *encryption.PrivateKey
+	if cfg.CryptoKey != "" {
+		var err error
+		privateKey, err = encryption.LoadPrivateKey(cfg.CryptoKey)
+		if err != nil {
+			panic(err)
 		}
-	default:
-		{
-			counterStorage = &storage.MemStorage[internal.Counter]{}
-			gaugeStorage = &storage.MemStorage[internal.Gauge]{}
+	}
+
+	if cfg.DatabaseDsn != "" {
+		var err error
+		database, err = db.Init(cfg.DatabaseDsn)
+		if err != nil {
+			panic(err)
+		}
+		err = db.CreateTable(ctx, database)
+		if err != nil {
+			panic(err)
 		}
 	}
-	operator, err := storage.NewOperator(ctx, gaugeStorage, counterStorage, cfg.Restore && cfg.FileStoragePath != "")
+	authn, err := newAuthenticator(database)
+	if err != nil {
+		panic(err)
+	}
+	counterStorage := newStorage[internal.Counter](database)
+	gaugeStorage := newStorage[internal.Gauge](database)
+	histogramStorage := newStorage[internal.Histogram](database)
+	summaryStorage := newStorage[internal.Summary](database)
+	if cfg.SetPrecision < 4 || cfg.SetPrecision > 18 {
+		panic("set precision should be between 4 and 18")
+	}
+	setStorage := storage.NewSetStorage(newStorage[internal.Set](database), uint8(cfg.SetPrecision))
+	operator, err := storage.NewOperator(ctx, gaugeStorage, counterStorage, histogramStorage, summaryStorage, setStorage, cfg.Restore && cfg.FileStoragePath != "")
 	if err != nil {
 		panic(err)
 	}
@@ -98,20 +241,67 @@ func main() {
 	gracefulShutdown := make(chan os.Signal, 1)
 	signal.Notify(gracefulShutdown, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
+	histogramBuckets, err := internal.ParseBuckets(cfg.HistogramBuckets)
+	if err != nil {
+		panic(err)
+	}
+	lineCounters, err := lineprotocol.ParseCounters(cfg.LineCounters)
+	if err != nil {
+		panic(err)
+	}
+	history, err := newHistory(database)
+	if err != nil {
+		panic(err)
+	}
+	if history != nil {
+		go func() {
+			compactHistory(ctx, history)
+		}()
+		go func() {
+			flushHistory(ctx, history)
+		}()
+	}
+	var alertEngine *alert.Engine
+	if cfg.AlertRules != "" {
+		alertConfig, err := alert.LoadConfig(cfg.AlertRules)
+		if err != nil {
+			panic(err)
+		}
+		alertEngine = alert.NewEngine(alertConfig, gaugeStorage, counterStorage, &alert.Webhook{
+			Client: &http.Client{Timeout: 10 * time.Second},
+		})
+		go func() {
+			alertEngine.Run(ctx)
+		}()
+	}
+	hub := stream.NewHub(int(cfg.StreamBuffer))
 	updateMetricHandler := handlers.UpdateMetricHandler{
-		GaugeStorage:   gaugeStorage,
-		CounterStorage: counterStorage,
+		GaugeStorage:     gaugeStorage,
+		CounterStorage:   counterStorage,
+		HistogramStorage: histogramStorage,
+		HistogramBuckets: histogramBuckets,
+		SummaryStorage:   summaryStorage,
+		SummaryAccuracy:  cfg.SummaryAccuracy,
+		SetStorage:       setStorage,
+		History:          history,
+		Hub:              hub,
 	}
 	if cfg.StoreInterval == 0 {
 		updateMetricHandler.FileStoragePath = cfg.FileStoragePath
 	}
 	storageStateHandler := handlers.StorageStateHandler{
-		GaugeStorage:   gaugeStorage,
-		CounterStorage: counterStorage,
+		GaugeStorage:     gaugeStorage,
+		CounterStorage:   counterStorage,
+		HistogramStorage: histogramStorage,
+		SummaryStorage:   summaryStorage,
+		SetStorage:       setStorage,
 	}
 	metricStateHandler := handlers.MetricStateHandler{
-		GaugeStorage:   gaugeStorage,
-		CounterStorage: counterStorage,
+		GaugeStorage:     gaugeStorage,
+		CounterStorage:   counterStorage,
+		HistogramStorage: histogramStorage,
+		SummaryStorage:   summaryStorage,
+		SetStorage:       setStorage,
 	}
 	jsonUpdateMetricHandler := handlers.JSONUpdateMetricHandler{
 		UpdateMetricHandler: updateMetricHandler,
@@ -125,6 +315,29 @@ func main() {
 	jsonUpdateMetricsHandler := handlers.JSONUpdateMetricsHandler{
 		UpdateMetricHandler: updateMetricHandler,
 	}
+	seriesHandler := handlers.SeriesHandler{
+		History: history,
+	}
+	remoteWriteHandler := handlers.RemoteWriteHandler{
+		UpdateMetricHandler: updateMetricHandler,
+	}
+	lineProtocolHandler := handlers.LineProtocolHandler{
+		UpdateMetricHandler: updateMetricHandler,
+		Counters:            lineCounters,
+	}
+	otlpHandler := handlers.OTLPHandler{
+		UpdateMetricHandler: updateMetricHandler,
+	}
+	streamHandler := handlers.StreamHandler{
+		Hub: hub,
+	}
+	webSocketHandler := handlers.WebSocketHandler{
+		Hub: hub,
+	}
+	alertsHandler := handlers.AlertsHandler{
+		Engine: alertEngine,
+	}
+	prometheusHandler := handlers.PrometheusHandler{}
 	dbPingHandler := handlers.DBPingHandler{
 		DB: database,
 	}
@@ -132,37 +345,131 @@ func main() {
 	r := chi.NewRouter()
 	r.Use(
 		middleware.StripSlashes,
+		mtls.Identify,
 		logger.RequestWithLogging,
+		encryption.DecryptRequestBody(privateKey),
 		gzip.CompressRequestBody,
 		hash.New(cfg.HashKey),
 	)
 
+	trusted := subnet.Trusted(trustedSubnets)
+	reader := authn.Require(auth.Reader)
+	writer := authn.Require(auth.Writer)
 	r.Route("/update", func(r chi.Router) {
+		r.Use(trusted, writer)
 		r.Handle("/", &jsonUpdateMetricHandler)
 		r.Handle("/{metricType}/{metricName}/{metricValue}", &updateMetricHandler)
 	})
 	r.Route("/updates", func(r chi.Router) {
+		r.Use(trusted, writer)
 		r.Handle("/", &jsonUpdateMetricsHandler)
 	})
 	r.Route("/value", func(r chi.Router) {
+		r.Use(reader)
 		r.Handle("/", &jsonMetricStateHandler)
 		r.Handle("/{metricType}/{metricName}", &metricStateHandler)
 	})
+	r.Route("/series", func(r chi.Router) {
+		r.Use(reader)
+		r.Handle("/{metricType}/{metricName}", &seriesHandler)
+	})
+	r.Route("/api/v1/write", func(r chi.Router) {
+		r.Use(trusted, writer)
+		r.Handle("/", &remoteWriteHandler)
+	})
+	r.Route("/write", func(r chi.Router) {
+		r.Use(trusted, writer)
+		r.Handle("/", &lineProtocolHandler)
+	})
+	r.Route("/v1/metrics", func(r chi.Router) {
+		r.Use(trusted, writer)
+		r.Handle("/", &otlpHandler)
+	})
+	r.Route("/stream", func(r chi.Router) {
+		r.Use(reader)
+		r.Handle("/", &streamHandler)
+		r.Handle("/ws", &webSocketHandler)
+	})
+	r.Route("/alerts", func(r chi.Router) {
+		r.Use(reader)
+		r.Handle("/", &alertsHandler)
+	})
+	r.Route("/metrics", func(r chi.Router) {
+		r.Use(reader)
+		r.Handle("/", &prometheusHandler)
+	})
+	if authn != nil {
+		tokensHandler := handlers.TokensHandler{Store: authn.Store}
+		r.Route("/admin/tokens", func(r chi.Router) {
+			r.Use(authn.Require(auth.Admin))
+			r.Handle("/", &tokensHandler)
+			r.Handle("/{id}", &tokensHandler)
+		})
+	}
+	dashboardHandler := dashboard.New()
 	r.Route("/", func(r chi.Router) {
-		r.Handle("/json", &jsonStorageStateHandler)
-		r.Handle("/", &storageStateHandler)
+		r.With(reader).Handle("/json", &jsonStorageStateHandler)
+		r.With(reader).Handle("/state", &storageStateHandler)
+		r.Handle("/dashboard/*", http.StripPrefix("/dashboard", dashboardHandler))
+		r.Handle("/", dashboardHandler)
 	})
 	r.Route("/ping", func(r chi.Router) {
 		r.Handle("/", &dbPingHandler)
 	})
 
 	go func() {
-		err := run(r)
+		err := run(r, tlsConfig)
 		if err != nil {
 			panic(err)
 		}
 	}()
 
+	if cfg.GRPCAddress != "" {
+		metricsServer := handlers.MetricsServer{UpdateMetricHandler: updateMetricHandler}
+		go func() {
+			err := runGRPC(&metricsServer, tlsConfig, trustedSubnets, authn)
+			if err != nil {
+				panic(err)
+			}
+		}()
+	}
+	if cfg.StatsdAddress != "" {
+		statsdListener := statsd.Listener{
+			Addr:          cfg.StatsdAddress,
+			FlushInterval: time.Duration(cfg.StatsdFlush) * time.Second,
+			Sink:          &handlers.StatsDSink{UpdateMetricHandler: updateMetricHandler},
+			Trusted:       trustedSubnets,
+		}
+		go func() {
+			err := statsdListener.ListenAndServe(ctx)
+			if err != nil {
+				panic(err)
+			}
+		}()
+	}
+
+	if cfg.GraphiteAddress != "" {
+		var rules graphite.Rules
+		if cfg.GraphiteRules != "" {
+			rules, err = graphite.LoadRules(cfg.GraphiteRules)
+			if err != nil {
+				panic(err)
+			}
+		}
+		graphiteListener := graphite.Listener{
+			Addr:    cfg.GraphiteAddress,
+			Rules:   rules,
+			Sink:    &handlers.GraphiteSink{UpdateMetricHandler: updateMetricHandler},
+			Trusted: trustedSubnets,
+		}
+		go func() {
+			err := graphiteListener.ListenAndServe(ctx)
+			if err != nil {
+				panic(err)
+			}
+		}()
+	}
+
 	if cfg.StoreInterval > 0 {
 		go func() {
 			saveMetrics(ctx, cfg.StoreInterval)
@@ -175,4 +482,9 @@ func main() {
 	if err != nil {
 		logger.Log.Errorln(err)
 	}
+	if history != nil {
+		if err = history.Flush(ctx); err != nil {
+			logger.Log.Errorln(err)
+		}
+	}
 }
@@ -0,0 +1,166 @@
+package alert
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/logger"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testNotifier struct {
+	fail          bool
+	notifications map[string][]Notification
+}
+
+func (n *testNotifier) Notify(_ context.Context, url string, notification Notification) error {
+	if n.fail {
+		return errors.New("webhook is down")
+	}
+	n.notifications[url] = append(n.notifications[url], notification)
+	return nil
+}
+
+func (n *testNotifier) take() map[string][]Notification {
+	notifications := n.notifications
+	n.notifications = make(map[string][]Notification)
+	return notifications
+}
+
+func TestRule_compile(t *testing.T) {
+	tests := []struct {
+		expr    string
+		want    Rule
+		wantErr bool
+	}{
+		{
+			expr: "gauge HeapAlloc > 500 for 2m",
+			want: Rule{metricType: internal.GaugeName, metric: "HeapAlloc", op: ">", threshold: 500, hold: 2 * time.Minute},
+		},
+		{
+			expr: `counter rate(PollCount{host="a"}) == 0 for 5m`,
+			want: Rule{metricType: internal.CounterName, rate: true, metric: "PollCount", filter: internal.Labels{"host": "a"}, op: "==", threshold: 0, hold: 5 * time.Minute},
+		},
+		{
+			expr: "counter PollCount>=1e3",
+			want: Rule{metricType: internal.CounterName, metric: "PollCount", op: ">=", threshold: 1000},
+		},
+		{expr: "gauge rate(HeapAlloc) > 1", wantErr: true},
+		{expr: "gauge HeapAlloc => 1", wantErr: true},
+		{expr: "gauge HeapAlloc > many", wantErr: true},
+		{expr: "gauge HeapAlloc > 1 for ever", wantErr: true},
+		{expr: "histogram Latency > 1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			rule := Rule{Expr: tt.expr}
+			err := rule.compile()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			tt.want.Expr = tt.expr
+			assert.Equal(t, tt.want, rule)
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+repeat_interval: 1h
+webhooks: [http://hooks/all]
+rules:
+  - name: HighHeapAlloc
+    expr: gauge HeapAlloc > 500 for 2m
+    labels: {severity: warning}
+`), 0644))
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, DefaultEvaluationInterval, cfg.EvaluationInterval)
+	assert.Equal(t, time.Hour, cfg.RepeatInterval)
+	require.Len(t, cfg.Rules, 1)
+	assert.Equal(t, 2*time.Minute, cfg.Rules[0].hold)
+
+	require.NoError(t, os.WriteFile(path, []byte("rules:\n  - name: A\n    expr: gauge A > 1\n  - name: A\n    expr: gauge B > 1\n"), 0644))
+	_, err = LoadConfig(path)
+	assert.Error(t, err)
+}
+
+func TestEngine(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+	cfg := &Config{
+		RepeatInterval: time.Hour,
+		Webhooks:       []string{"http://hooks/all"},
+		Rules: []*Rule{
+			{Name: "HighHeapAlloc", Expr: "gauge HeapAlloc > 500 for 2m", Labels: map[string]string{"severity": "warning"}},
+			{Name: "AgentStalled", Expr: "counter rate(PollCount) == 0", Webhooks: []string{"http://hooks/pager"}},
+		},
+	}
+	require.NoError(t, cfg.Compile())
+	var gaugeStorage storage.MemStorage[internal.Gauge]
+	var counterStorage storage.MemStorage[internal.Counter]
+	notifier := &testNotifier{notifications: make(map[string][]Notification)}
+	engine := NewEngine(cfg, &gaugeStorage, &counterStorage, notifier)
+	ctx := context.Background()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	gaugeStorage.Set(`HeapAlloc{host="a"}`, 600)
+	gaugeStorage.Set(`HeapAlloc{host="b"}`, 100)
+	counterStorage.Set("PollCount", 10)
+	engine.Evaluate(ctx, start)
+	alerts := engine.Alerts()
+	require.Len(t, alerts, 1)
+	assert.Equal(t, Pending, alerts[0].State)
+	assert.Equal(t, internal.Labels{"host": "a", "severity": "warning"}, alerts[0].Labels)
+	assert.Empty(t, notifier.take())
+
+	counterStorage.Set("PollCount", 20)
+	engine.Evaluate(ctx, start.Add(time.Minute))
+	assert.Len(t, engine.Alerts(), 1)
+	assert.Empty(t, notifier.take())
+
+	// the counter stalls and the gauge has been high for 2m
+	engine.Evaluate(ctx, start.Add(2*time.Minute))
+	notifications := notifier.take()
+	require.Len(t, notifications["http://hooks/all"], 1)
+	assert.Equal(t, Firing, notifications["http://hooks/all"][0].Status)
+	assert.Equal(t, "HighHeapAlloc", notifications["http://hooks/all"][0].Alerts[0].Rule)
+	require.Len(t, notifications["http://hooks/pager"], 1)
+	assert.Equal(t, "AgentStalled", notifications["http://hooks/pager"][0].Alerts[0].Rule)
+
+	// firing alerts are not notified again before the repeat interval
+	engine.Evaluate(ctx, start.Add(3*time.Minute))
+	assert.Empty(t, notifier.take())
+	engine.Evaluate(ctx, start.Add(62*time.Minute))
+	assert.Len(t, notifier.take(), 2)
+
+	// resolved notifications are retried until the webhook accepts them
+	gaugeStorage.Set(`HeapAlloc{host="a"}`, 400)
+	notifier.fail = true
+	engine.Evaluate(ctx, start.Add(63*time.Minute))
+	notifier.fail = false
+	engine.Evaluate(ctx, start.Add(64*time.Minute))
+	notifications = notifier.take()
+	require.Len(t, notifications["http://hooks/all"], 1)
+	assert.Equal(t, Resolved, notifications["http://hooks/all"][0].Status)
+	assert.Empty(t, notifications["http://hooks/pager"])
+	engine.Evaluate(ctx, start.Add(65*time.Minute))
+	assert.Empty(t, notifier.take())
+
+	alerts = engine.Alerts()
+	require.Len(t, alerts, 2)
+	assert.Equal(t, "AgentStalled", alerts[0].Rule)
+	assert.Equal(t, Firing, alerts[0].State)
+	assert.Equal(t, Resolved, alerts[1].State)
+	engine.Evaluate(ctx, start.Add(63*time.Minute+resolvedRetention))
+	assert.Len(t, engine.Alerts(), 1)
+}
@@ -0,0 +1,270 @@
+package alert
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/logger"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/storage"
+)
+
+// resolvedRetention is how long resolved alerts stay listed.
+const resolvedRetention = 15 * time.Minute
+
+type State string
+
+const (
+	Pending  State = "pending"
+	Firing   State = "firing"
+	Resolved State = "resolved"
+)
+
+// Alert is the state of a rule for one series.
+type Alert struct {
+	Rule       string          `json:"rule"`
+	Expr       string          `json:"expr"`
+	Metric     string          `json:"metric"`
+	Labels     internal.Labels `json:"labels,omitempty"`
+	State      State           `json:"state"`
+	Value      float64         `json:"value"`
+	ActiveAt   time.Time       `json:"active_at"`
+	FiredAt    *time.Time      `json:"fired_at,omitempty"`
+	ResolvedAt *time.Time      `json:"resolved_at,omitempty"`
+
+	rule             *Rule
+	lastNotified     time.Time
+	resolvedNotified bool
+}
+
+// delivery is a notification to one webhook and the ids of its alerts.
+type delivery struct {
+	ids          []string
+	notification Notification
+}
+
+type sample struct {
+	value float64
+	time  time.Time
+}
+
+// Engine evaluates rules against the gauge and counter storages. An alert turns
+// pending when its rule starts to hold, firing once it held for the rule duration
+// and resolved when it no longer holds. Webhooks are notified when an alert fires,
+// every repeat interval while it keeps firing and once when it resolves.
+type Engine struct {
+	Config         *Config
+	GaugeStorage   storage.Storage[internal.Gauge]
+	CounterStorage storage.Storage[internal.Counter]
+	Notifier       Notifier
+
+	mx       sync.RWMutex
+	alerts   map[string]*Alert
+	counters map[string]sample
+}
+
+func NewEngine(cfg *Config, gs storage.Storage[internal.Gauge], cs storage.Storage[internal.Counter], notifier Notifier) *Engine {
+	return &Engine{
+		Config:         cfg,
+		GaugeStorage:   gs,
+		CounterStorage: cs,
+		Notifier:       notifier,
+		alerts:         make(map[string]*Alert),
+		counters:       make(map[string]sample),
+	}
+}
+
+func (e *Engine) Run(ctx context.Context) {
+	ticker := time.NewTicker(e.Config.EvaluationInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			e.Evaluate(ctx, now)
+		}
+	}
+}
+
+// Alerts returns current alerts ordered by rule and labels.
+func (e *Engine) Alerts() []Alert {
+	e.mx.RLock()
+	defer e.mx.RUnlock()
+	ids := make([]string, 0, len(e.alerts))
+	for id := range e.alerts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	alerts := make([]Alert, 0, len(ids))
+	for _, id := range ids {
+		alerts = append(alerts, *e.alerts[id])
+	}
+	return alerts
+}
+
+// Evaluate updates alert states and sends due notifications. Alerts a webhook
+// failed to receive are notified again on the next evaluation.
+func (e *Engine) Evaluate(ctx context.Context, now time.Time) {
+	deliveries := e.evaluate(now)
+	notified := make(map[string]bool)
+	failed := make(map[string]bool)
+	for url, d := range deliveries {
+		if err := e.Notifier.Notify(ctx, url, d.notification); err != nil {
+			logger.Log.Errorf("error notifying %s: %v", url, err)
+			for _, id := range d.ids {
+				failed[id] = true
+			}
+			continue
+		}
+		for _, id := range d.ids {
+			notified[id] = true
+		}
+	}
+
+	e.mx.Lock()
+	defer e.mx.Unlock()
+	for id := range notified {
+		alert, ok := e.alerts[id]
+		if !ok || failed[id] {
+			continue
+		}
+		alert.lastNotified = now
+		if alert.State == Resolved {
+			alert.resolvedNotified = true
+		}
+	}
+}
+
+// evaluate updates alert states and returns the notifications due by webhook.
+func (e *Engine) evaluate(now time.Time) map[string]*delivery {
+	gauges := make(map[string]float64)
+	for key, value := range e.GaugeStorage.GetAll() {
+		gauges[key] = float64(*value)
+	}
+	counters := make(map[string]float64)
+	for key, value := range e.CounterStorage.GetAll() {
+		counters[key] = float64(*value)
+	}
+
+	e.mx.Lock()
+	defer e.mx.Unlock()
+	rates := make(map[string]float64)
+	for key, value := range counters {
+		prev, ok := e.counters[key]
+		if ok && now.After(prev.time) {
+			delta := value - prev.value
+			if delta < 0 {
+				// the counter was reset
+				delta = value
+			}
+			rates[key] = delta / now.Sub(prev.time).Seconds()
+		}
+		e.counters[key] = sample{value: value, time: now}
+	}
+	for key := range e.counters {
+		if _, ok := counters[key]; !ok {
+			delete(e.counters, key)
+		}
+	}
+
+	active := make(map[string]bool)
+	for _, rule := range e.Config.Rules {
+		values := gauges
+		switch {
+		case rule.rate:
+			values = rates
+		case rule.metricType == internal.CounterName:
+			values = counters
+		}
+		for key, value := range values {
+			if !rule.selects(key) || !rule.holds(value) {
+				continue
+			}
+			id := rule.Name + "/" + key
+			active[id] = true
+			alert, ok := e.alerts[id]
+			if !ok || alert.State == Resolved {
+				_, labels, _ := internal.ParseSeriesKey(key)
+				alert = &Alert{
+					Rule:     rule.Name,
+					Expr:     rule.Expr,
+					Metric:   rule.metric,
+					Labels:   labels.Merge(rule.Labels),
+					State:    Pending,
+					ActiveAt: now,
+					rule:     rule,
+				}
+				e.alerts[id] = alert
+			}
+			alert.Value = value
+			if alert.State == Pending && now.Sub(alert.ActiveAt) >= rule.hold {
+				alert.State = Firing
+				firedAt := now
+				alert.FiredAt = &firedAt
+			}
+		}
+	}
+
+	deliveries := make(map[string]*delivery)
+	for id, alert := range e.alerts {
+		if !active[id] {
+			switch alert.State {
+			case Pending:
+				delete(e.alerts, id)
+				continue
+			case Firing:
+				alert.State = Resolved
+				resolvedAt := now
+				alert.ResolvedAt = &resolvedAt
+			case Resolved:
+				if now.Sub(*alert.ResolvedAt) >= resolvedRetention {
+					delete(e.alerts, id)
+					continue
+				}
+			}
+		}
+		if !e.due(alert, now) {
+			continue
+		}
+		webhooks := alert.rule.Webhooks
+		if len(webhooks) == 0 {
+			webhooks = e.Config.Webhooks
+		}
+		for _, url := range webhooks {
+			d, ok := deliveries[url]
+			if !ok {
+				d = &delivery{notification: Notification{Status: Resolved}}
+				deliveries[url] = d
+			}
+			d.ids = append(d.ids, id)
+		}
+	}
+	for _, d := range deliveries {
+		sort.Strings(d.ids)
+		for _, id := range d.ids {
+			alert := e.alerts[id]
+			if alert.State == Firing {
+				d.notification.Status = Firing
+			}
+			d.notification.Alerts = append(d.notification.Alerts, *alert)
+		}
+	}
+	return deliveries
+}
+
+// due reports whether an alert should be notified: firing alerts not notified
+// within the repeat interval and resolved alerts not notified since resolving.
+func (e *Engine) due(alert *Alert, now time.Time) bool {
+	switch alert.State {
+	case Firing:
+		return alert.lastNotified.IsZero() || now.Sub(alert.lastNotified) >= e.Config.RepeatInterval
+	case Resolved:
+		// an alert that was never notified as firing resolves silently
+		return !alert.lastNotified.IsZero() && !alert.resolvedNotified
+	default:
+		return false
+	}
+}
@@ -0,0 +1,147 @@
+// Package alert evaluates threshold rules against stored gauges and counters
+// and notifies webhooks about alerts that fire and resolve.
+package alert
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DefaultEvaluationInterval = 15 * time.Second
+	DefaultRepeatInterval     = 4 * time.Hour
+)
+
+// Config is the contents of a rules file.
+type Config struct {
+	EvaluationInterval time.Duration `yaml:"evaluation_interval"`
+	// RepeatInterval is how often a firing alert is notified again
+	RepeatInterval time.Duration `yaml:"repeat_interval"`
+	// Webhooks are notified about rules that don't list their own
+	Webhooks []string `yaml:"webhooks"`
+	Rules    []*Rule  `yaml:"rules"`
+}
+
+// Rule fires for every series its expression holds for, e.g.
+// "gauge HeapAlloc > 500 for 2m" or "counter rate(PollCount{host=\"a\"}) == 0 for 5m".
+type Rule struct {
+	Name     string            `yaml:"name"`
+	Expr     string            `yaml:"expr"`
+	Labels   map[string]string `yaml:"labels"`
+	Webhooks []string          `yaml:"webhooks"`
+
+	metricType internal.MetricTypeName
+	rate       bool
+	metric     string
+	filter     internal.Labels
+	op         string
+	threshold  float64
+	hold       time.Duration
+}
+
+const selectorPattern = `[A-Za-z_:][^\s{}()]*(?:\{[^}]*\})?`
+
+var exprRe = regexp.MustCompile(`^\s*(gauge|counter)\s+(?:rate\((` + selectorPattern + `)\)|(` + selectorPattern + `))\s*(>=|<=|==|!=|>|<)\s*(\S+)(?:\s+for\s+(\S+))?\s*$`)
+
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err = yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse alert rules: %w", err)
+	}
+	if err = cfg.Compile(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Compile parses rule expressions and fills in default intervals.
+func (c *Config) Compile() error {
+	if c.EvaluationInterval <= 0 {
+		c.EvaluationInterval = DefaultEvaluationInterval
+	}
+	if c.RepeatInterval <= 0 {
+		c.RepeatInterval = DefaultRepeatInterval
+	}
+	names := make(map[string]bool, len(c.Rules))
+	for i, rule := range c.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("alert rule %d: name is required", i+1)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("alert rule %q: duplicate name", rule.Name)
+		}
+		names[rule.Name] = true
+		if err := rule.compile(); err != nil {
+			return fmt.Errorf("alert rule %q: %w", rule.Name, err)
+		}
+	}
+	return nil
+}
+
+func (r *Rule) compile() error {
+	match := exprRe.FindStringSubmatch(r.Expr)
+	if match == nil {
+		return fmt.Errorf("invalid expression %q, expected e.g. \"gauge HeapAlloc > 500 for 2m\"", r.Expr)
+	}
+	r.metricType = internal.MetricTypeName(match[1])
+	selector := match[3]
+	if match[2] != "" {
+		if r.metricType != internal.CounterName {
+			return fmt.Errorf("rate is only defined for counters")
+		}
+		r.rate = true
+		selector = match[2]
+	}
+	var err error
+	r.metric, r.filter, err = internal.ParseSeriesKey(selector)
+	if err != nil {
+		return err
+	}
+	r.op = match[4]
+	r.threshold, err = strconv.ParseFloat(match[5], 64)
+	if err != nil {
+		return fmt.Errorf("invalid threshold %q", match[5])
+	}
+	if match[6] != "" {
+		r.hold, err = time.ParseDuration(match[6])
+		if err != nil || r.hold < 0 {
+			return fmt.Errorf("invalid duration %q", match[6])
+		}
+	}
+	return nil
+}
+
+// selects reports whether the rule applies to the series at key.
+func (r *Rule) selects(key string) bool {
+	name, labels, err := internal.ParseSeriesKey(key)
+	return err == nil && name == r.metric && labels.Match(r.filter)
+}
+
+func (r *Rule) holds(value float64) bool {
+	switch r.op {
+	case ">":
+		return value > r.threshold
+	case ">=":
+		return value >= r.threshold
+	case "<":
+		return value < r.threshold
+	case "<=":
+		return value <= r.threshold
+	case "==":
+		return value == r.threshold
+	case "!=":
+		return value != r.threshold
+	default:
+		return false
+	}
+}
@@ -0,0 +1,50 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Notification is the JSON body posted to webhooks. Its status is firing
+// when any of its alerts fires and resolved otherwise.
+type Notification struct {
+	Status State   `json:"status"`
+	Alerts []Alert `json:"alerts"`
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, url string, n Notification) error
+}
+
+// Webhook posts notifications as JSON.
+type Webhook struct {
+	Client *http.Client
+}
+
+func (w *Webhook) Notify(ctx context.Context, url string, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
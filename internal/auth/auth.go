@@ -0,0 +1,285 @@
+// Package auth checks bearer tokens. A token has roles, reader for queries, writer
+// for ingestion and admin for everything including token management, and may be
+// scoped to metric name prefixes. Only SHA-256 hashes of tokens are stored.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	customHttp "github.com/krm-shrftdnv/go-musthave-metrics/internal/http"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type Role string
+
+const (
+	Reader Role = "reader"
+	Writer Role = "writer"
+	Admin  Role = "admin"
+)
+
+// tokenPrefix makes tokens easy to recognize, e.g. by secret scanners.
+const tokenPrefix = "mt_"
+
+var (
+	ErrNotFound     = errors.New("token not found")
+	ErrUnauthorized = errors.New("missing or invalid bearer token")
+	// ErrForbidden is returned for metric names outside the token scope
+	ErrForbidden = errors.New("token is not allowed to access this metric")
+)
+
+func ParseRole(s string) (Role, error) {
+	switch role := Role(s); role {
+	case Reader, Writer, Admin:
+		return role, nil
+	default:
+		return "", fmt.Errorf("role %q should be reader, writer or admin", s)
+	}
+}
+
+type Token struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Hash      string    `json:"hash"`
+	Roles     []Role    `json:"roles"`
+	Prefixes  []string  `json:"prefixes,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Has reports whether the token grants role. Admins have every role.
+func (t *Token) Has(role Role) bool {
+	for _, r := range t.Roles {
+		if r == role || r == Admin {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether the metric name is within the token scope.
+func (t *Token) Allows(name string) bool {
+	if len(t.Prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range t.Prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewToken returns a token with a fresh secret. Only the hash of the secret is kept
+// in the token, the secret itself is shown to the caller once.
+func NewToken(name string, roles []Role, prefixes []string) (Token, string, error) {
+	if len(roles) == 0 {
+		return Token{}, "", errors.New("at least one role is required")
+	}
+	for _, role := range roles {
+		if _, err := ParseRole(string(role)); err != nil {
+			return Token{}, "", err
+		}
+	}
+	for _, prefix := range prefixes {
+		if prefix == "" || strings.Contains(prefix, ",") {
+			return Token{}, "", fmt.Errorf("prefix %q should be non-empty and have no commas", prefix)
+		}
+	}
+	id := make([]byte, 8)
+	secret := make([]byte, 24)
+	if _, err := rand.Read(id); err != nil {
+		return Token{}, "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return Token{}, "", err
+	}
+	plain := tokenPrefix + hex.EncodeToString(secret)
+	return Token{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Hash:      Hash(plain),
+		Roles:     roles,
+		Prefixes:  prefixes,
+		CreatedAt: time.Now().UTC(),
+	}, plain, nil
+}
+
+type tokenKey struct{}
+
+func WithToken(ctx context.Context, token *Token) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+func FromContext(ctx context.Context) (*Token, bool) {
+	token, ok := ctx.Value(tokenKey{}).(*Token)
+	return token, ok
+}
+
+// Allows reports whether the request token may access the metric name. Without
+// a token, e.g. with authentication disabled, every name is allowed.
+func Allows(ctx context.Context, name string) bool {
+	token, ok := FromContext(ctx)
+	return !ok || token.Allows(name)
+}
+
+// Scoped reports whether the request token is limited to some metric names.
+func Scoped(ctx context.Context) bool {
+	token, ok := FromContext(ctx)
+	return ok && len(token.Prefixes) > 0
+}
+
+// Authenticator looks tokens up in the store. AdminToken is a bootstrap token with
+// the admin role that is configured rather than stored. A nil Authenticator lets
+// every request through.
+type Authenticator struct {
+	Store      Store
+	AdminToken string
+}
+
+func (a *Authenticator) Authenticate(ctx context.Context, authorization string) (*Token, error) {
+	scheme, secret, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || secret == "" {
+		return nil, ErrUnauthorized
+	}
+	secret = strings.TrimSpace(secret)
+	if a.AdminToken != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(a.AdminToken)) == 1 {
+		return &Token{ID: "admin", Name: "admin", Roles: []Role{Admin}}, nil
+	}
+	token, err := a.Store.Lookup(ctx, Hash(secret))
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrUnauthorized
+	}
+	return token, err
+}
+
+// Require answers 401 to requests without a valid token and 403 to tokens
+// without the role.
+func (a *Authenticator) Require(role Role) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if a == nil {
+			return next
+		}
+		requireFn := func(w http.ResponseWriter, r *http.Request) {
+			token, err := a.Authenticate(r.Context(), r.Header.Get("Authorization"))
+			if errors.Is(err, ErrUnauthorized) {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !token.Has(role) {
+				http.Error(w, fmt.Sprintf("token lacks the %s role", role), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithToken(r.Context(), token)))
+		}
+		return http.HandlerFunc(requireFn)
+	}
+}
+
+func (a *Authenticator) authorize(ctx context.Context, role Role) (context.Context, error) {
+	var authorization string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			authorization = values[0]
+		}
+	}
+	token, err := a.Authenticate(ctx, authorization)
+	if errors.Is(err, ErrUnauthorized) {
+		return ctx, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err != nil {
+		return ctx, status.Error(codes.Internal, err.Error())
+	}
+	if !token.Has(role) {
+		return ctx, status.Errorf(codes.PermissionDenied, "token lacks the %s role", role)
+	}
+	return WithToken(ctx, token), nil
+}
+
+// NewUnaryInterceptor requires the role given for each method. Methods that aren't
+// listed need no token.
+func (a *Authenticator) NewUnaryInterceptor(roles map[string]Role) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		role, ok := roles[info.FullMethod]
+		if a == nil || !ok {
+			return handler(ctx, req)
+		}
+		ctx, err := a.authorize(ctx, role)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authorizedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (a *Authenticator) NewStreamInterceptor(roles map[string]Role) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		role, ok := roles[info.FullMethod]
+		if a == nil || !ok {
+			return handler(srv, ss)
+		}
+		ctx, err := a.authorize(ss.Context(), role)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authorizedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// BearerRequest sets the Authorization header on outgoing requests.
+func BearerRequest(token string) customHttp.Middleware {
+	if token == "" {
+		return nil
+	}
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return customHttp.InternalRoundTripper(func(req *http.Request) (*http.Response, error) {
+			header := req.Header
+			if header == nil {
+				header = make(http.Header)
+			}
+			header.Set("Authorization", "Bearer "+token)
+			req.Header = header
+			return rt.RoundTrip(req)
+		})
+	}
+}
+
+// BearerUnaryRequest sets the authorization metadata on outgoing calls.
+func BearerUnaryRequest(token string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if token != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
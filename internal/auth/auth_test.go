@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestToken(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   Token
+		role    Role
+		has     bool
+		metric  string
+		allowed bool
+	}{
+		{name: "reader", token: Token{Roles: []Role{Reader}}, role: Reader, has: true, metric: "Alloc", allowed: true},
+		{name: "reader can't write", token: Token{Roles: []Role{Reader}}, role: Writer, has: false, metric: "Alloc", allowed: true},
+		{name: "admin has every role", token: Token{Roles: []Role{Admin}}, role: Writer, has: true, metric: "Alloc", allowed: true},
+		{name: "in scope", token: Token{Roles: []Role{Writer}, Prefixes: []string{"Heap", "Go"}}, role: Writer, has: true, metric: "GoRoutines", allowed: true},
+		{name: "out of scope", token: Token{Roles: []Role{Writer}, Prefixes: []string{"Heap"}}, role: Writer, has: true, metric: "Alloc", allowed: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.has, tt.token.Has(tt.role))
+			assert.Equal(t, tt.allowed, tt.token.Allows(tt.metric))
+		})
+	}
+}
+
+func TestNewToken(t *testing.T) {
+	token, secret, err := NewToken("agent", []Role{Writer}, []string{"Heap"})
+	require.NoError(t, err)
+	assert.Equal(t, Hash(secret), token.Hash)
+	assert.NotContains(t, token.Hash, secret)
+	assert.Len(t, token.ID, 16)
+
+	_, _, err = NewToken("agent", nil, nil)
+	assert.Error(t, err)
+	_, _, err = NewToken("agent", []Role{"owner"}, nil)
+	assert.Error(t, err)
+	_, _, err = NewToken("agent", []Role{Writer}, []string{"a,b"})
+	assert.Error(t, err)
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	store, err := NewFileStore(path)
+	require.NoError(t, err)
+	token, secret, err := NewToken("agent", []Role{Writer}, nil)
+	require.NoError(t, err)
+	require.NoError(t, store.Create(ctx, token))
+
+	// tokens survive a restart
+	store, err = NewFileStore(path)
+	require.NoError(t, err)
+	found, err := store.Lookup(ctx, Hash(secret))
+	require.NoError(t, err)
+	assert.Equal(t, "agent", found.Name)
+	tokens, err := store.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, tokens, 1)
+
+	require.NoError(t, store.Revoke(ctx, token.ID))
+	_, err = store.Lookup(ctx, Hash(secret))
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, store.Revoke(ctx, token.ID), ErrNotFound)
+}
+
+func TestAuthenticator_Require(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "tokens.json"))
+	require.NoError(t, err)
+	reader, readerSecret, err := NewToken("dashboard", []Role{Reader}, []string{"Heap"})
+	require.NoError(t, err)
+	require.NoError(t, store.Create(ctx, reader))
+	authn := &Authenticator{Store: store, AdminToken: "bootstrap"}
+
+	var scoped bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scoped = Scoped(r.Context())
+	})
+	handler := authn.Require(Reader)(next)
+	tests := []struct {
+		name          string
+		authorization string
+		code          int
+		scoped        bool
+	}{
+		{name: "no token", code: http.StatusUnauthorized},
+		{name: "unknown token", authorization: "Bearer mt_unknown", code: http.StatusUnauthorized},
+		{name: "wrong scheme", authorization: "Basic " + readerSecret, code: http.StatusUnauthorized},
+		{name: "reader", authorization: "Bearer " + readerSecret, code: http.StatusOK, scoped: true},
+		{name: "admin token", authorization: "bearer bootstrap", code: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scoped = false
+			req := httptest.NewRequest(http.MethodGet, "/json", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, tt.code, w.Code)
+			assert.Equal(t, tt.scoped, scoped)
+		})
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/updates", nil)
+	req.Header.Set("Authorization", "Bearer "+readerSecret)
+	authn.Require(Writer)(next).ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// a nil authenticator lets everything through
+	w = httptest.NewRecorder()
+	(*Authenticator)(nil).Require(Admin)(next).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAuthenticator_NewUnaryInterceptor(t *testing.T) {
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "tokens.json"))
+	require.NoError(t, err)
+	authn := &Authenticator{Store: store, AdminToken: "bootstrap"}
+	interceptor := authn.NewUnaryInterceptor(map[string]Role{"/metrics.Metrics/UpdateMetrics": Writer})
+	handler := func(ctx context.Context, req any) (any, error) { return nil, nil }
+	info := &grpc.UnaryServerInfo{FullMethod: "/metrics.Metrics/UpdateMetrics"}
+
+	_, err = interceptor(context.Background(), nil, info, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer bootstrap"))
+	_, err = interceptor(ctx, nil, info, handler)
+	assert.NoError(t, err)
+	_, err = interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/metrics.Metrics/Other"}, handler)
+	assert.NoError(t, err)
+}
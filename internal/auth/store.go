@@ -0,0 +1,198 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type Store interface {
+	// Lookup finds a token by the hash of its secret.
+	Lookup(ctx context.Context, hash string) (*Token, error)
+	List(ctx context.Context) ([]Token, error)
+	Create(ctx context.Context, token Token) error
+	Revoke(ctx context.Context, id string) error
+}
+
+// FileStore keeps tokens in memory and rewrites the JSON file on every change.
+type FileStore struct {
+	path   string
+	mx     sync.RWMutex
+	tokens map[string]Token
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, tokens: make(map[string]Token)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var tokens []Token
+	if err = json.Unmarshal(data, &tokens); err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		s.tokens[token.ID] = token
+	}
+	return s, nil
+}
+
+func (s *FileStore) Lookup(_ context.Context, hash string) (*Token, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	for _, token := range s.tokens {
+		if token.Hash == hash {
+			return &token, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *FileStore) List(_ context.Context) ([]Token, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	return s.list(), nil
+}
+
+func (s *FileStore) list() []Token {
+	tokens := make([]Token, 0, len(s.tokens))
+	for _, token := range s.tokens {
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+	})
+	return tokens
+}
+
+func (s *FileStore) Create(_ context.Context, token Token) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.tokens[token.ID] = token
+	if err := s.save(); err != nil {
+		delete(s.tokens, token.ID)
+		return err
+	}
+	return nil
+}
+
+func (s *FileStore) Revoke(_ context.Context, id string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	token, ok := s.tokens[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(s.tokens, id)
+	if err := s.save(); err != nil {
+		s.tokens[id] = token
+		return err
+	}
+	return nil
+}
+
+// save replaces the file atomically, so a crash never leaves it half written.
+func (s *FileStore) save() error {
+	data, err := json.MarshalIndent(s.list(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// DBStore keeps tokens in the api_tokens table.
+type DBStore struct {
+	DB *sql.DB
+}
+
+const tokenColumns = "id, name, hash, roles, prefixes, created_at"
+
+func scanToken(row interface{ Scan(...any) error }) (Token, error) {
+	var token Token
+	var roles, prefixes string
+	if err := row.Scan(&token.ID, &token.Name, &token.Hash, &roles, &prefixes, &token.CreatedAt); err != nil {
+		return token, err
+	}
+	for _, role := range strings.Split(roles, ",") {
+		token.Roles = append(token.Roles, Role(role))
+	}
+	if prefixes != "" {
+		token.Prefixes = strings.Split(prefixes, ",")
+	}
+	return token, nil
+}
+
+func (s *DBStore) Lookup(ctx context.Context, hash string) (*Token, error) {
+	token, err := scanToken(s.DB.QueryRowContext(ctx, "SELECT "+tokenColumns+" FROM api_tokens WHERE hash = $1", hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
+func (s *DBStore) List(ctx context.Context) ([]Token, error) {
+	rows, err := s.DB.QueryContext(ctx, "SELECT "+tokenColumns+" FROM api_tokens ORDER BY created_at")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	tokens := make([]Token, 0)
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, rows.Err()
+}
+
+func (s *DBStore) Create(ctx context.Context, token Token) error {
+	roles := make([]string, len(token.Roles))
+	for i, role := range token.Roles {
+		roles[i] = string(role)
+	}
+	_, err := s.DB.ExecContext(ctx,
+		"INSERT INTO api_tokens ("+tokenColumns+") VALUES ($1, $2, $3, $4, $5, $6)",
+		token.ID, token.Name, token.Hash, strings.Join(roles, ","), strings.Join(token.Prefixes, ","), token.CreatedAt)
+	return err
+}
+
+func (s *DBStore) Revoke(ctx context.Context, id string) error {
+	res, err := s.DB.ExecContext(ctx, "DELETE FROM api_tokens WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
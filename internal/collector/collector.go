@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/serializer"
+)
+
+// Collector produces a batch of metrics on every agent poll.
+// Gauges are reported as the latest value, counters as deltas since the previous Collect.
+type Collector interface {
+	Name() string
+	Collect(ctx context.Context) ([]serializer.Metrics, error)
+}
+
+var registry = struct {
+	mx         sync.RWMutex
+	collectors map[string]Collector
+}{
+	collectors: make(map[string]Collector),
+}
+
+// Register makes a collector available to the agent poll loop.
+// It panics if a collector with the same name is already registered.
+func Register(c Collector) {
+	registry.mx.Lock()
+	defer registry.mx.Unlock()
+	if c == nil {
+		panic("collector: Register collector is nil")
+	}
+	if _, dup := registry.collectors[c.Name()]; dup {
+		panic(fmt.Sprintf("collector: Register called twice for collector %s", c.Name()))
+	}
+	registry.collectors[c.Name()] = c
+}
+
+func Unregister(name string) {
+	registry.mx.Lock()
+	defer registry.mx.Unlock()
+	delete(registry.collectors, name)
+}
+
+// Collectors returns registered collectors sorted by name.
+func Collectors() []Collector {
+	registry.mx.RLock()
+	defer registry.mx.RUnlock()
+	collectors := make([]Collector, 0, len(registry.collectors))
+	for _, c := range registry.collectors {
+		collectors = append(collectors, c)
+	}
+	sort.Slice(collectors, func(i, j int) bool {
+		return collectors[i].Name() < collectors[j].Name()
+	})
+	return collectors
+}
+
+// Gauges converts a name to value map into metrics sorted by name.
+func Gauges(values map[string]internal.Gauge) []serializer.Metrics {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	metrics := make([]serializer.Metrics, 0, len(values))
+	for _, name := range names {
+		metrics = append(metrics, serializer.NewGauge(name, values[name]))
+	}
+	return metrics
+}
@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/serializer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stubCollector struct {
+	name string
+}
+
+func (c *stubCollector) Name() string {
+	return c.name
+}
+
+func (c *stubCollector) Collect(context.Context) ([]serializer.Metrics, error) {
+	return nil, nil
+}
+
+func TestRegister(t *testing.T) {
+	Register(&stubCollector{name: "b"})
+	Register(&stubCollector{name: "a"})
+	defer Unregister("a")
+	defer Unregister("b")
+
+	collectors := Collectors()
+	require.Len(t, collectors, 2)
+	assert.Equal(t, "a", collectors[0].Name())
+	assert.Equal(t, "b", collectors[1].Name())
+	assert.Panics(t, func() { Register(&stubCollector{name: "a"}) })
+}
+
+func TestRuntimeCollector_Collect(t *testing.T) {
+	metrics, err := (&RuntimeCollector{}).Collect(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, metrics, len(runtimeGauges))
+	for _, m := range metrics {
+		assert.Equal(t, string(internal.GaugeName), m.MType)
+		assert.NotNil(t, m.Value, m.ID)
+	}
+}
@@ -0,0 +1,63 @@
+package collector
+
+import (
+	"context"
+	"math/rand"
+	"runtime"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/serializer"
+)
+
+const RuntimeCollectorName = "runtime"
+
+func mb(v uint64) internal.Gauge {
+	return internal.Gauge(v) / (1024 * 1024)
+}
+
+var runtimeGauges = map[string]func(m *runtime.MemStats) internal.Gauge{
+	"Alloc":         func(m *runtime.MemStats) internal.Gauge { return mb(m.Alloc) },
+	"BuckHashSys":   func(m *runtime.MemStats) internal.Gauge { return mb(m.BuckHashSys) },
+	"Frees":         func(m *runtime.MemStats) internal.Gauge { return mb(m.Frees) },
+	"GCCPUFraction": func(m *runtime.MemStats) internal.Gauge { return internal.Gauge(m.GCCPUFraction) / (1024 * 1024) },
+	"GCSys":         func(m *runtime.MemStats) internal.Gauge { return mb(m.GCSys) },
+	"HeapAlloc":     func(m *runtime.MemStats) internal.Gauge { return mb(m.HeapAlloc) },
+	"HeapIdle":      func(m *runtime.MemStats) internal.Gauge { return mb(m.HeapIdle) },
+	"HeapInuse":     func(m *runtime.MemStats) internal.Gauge { return mb(m.HeapInuse) },
+	"HeapObjects":   func(m *runtime.MemStats) internal.Gauge { return mb(m.HeapObjects) },
+	"HeapReleased":  func(m *runtime.MemStats) internal.Gauge { return mb(m.HeapReleased) },
+	"HeapSys":       func(m *runtime.MemStats) internal.Gauge { return mb(m.HeapSys) },
+	"LastGC":        func(m *runtime.MemStats) internal.Gauge { return mb(m.LastGC) },
+	"Lookups":       func(m *runtime.MemStats) internal.Gauge { return mb(m.Lookups) },
+	"MCacheInuse":   func(m *runtime.MemStats) internal.Gauge { return mb(m.MCacheInuse) },
+	"MCacheSys":     func(m *runtime.MemStats) internal.Gauge { return mb(m.MCacheSys) },
+	"MSpanInuse":    func(m *runtime.MemStats) internal.Gauge { return mb(m.MSpanInuse) },
+	"MSpanSys":      func(m *runtime.MemStats) internal.Gauge { return mb(m.MSpanSys) },
+	"Mallocs":       func(m *runtime.MemStats) internal.Gauge { return mb(m.Mallocs) },
+	"NextGC":        func(m *runtime.MemStats) internal.Gauge { return mb(m.NextGC) },
+	"NumForcedGC":   func(m *runtime.MemStats) internal.Gauge { return mb(uint64(m.NumForcedGC)) },
+	"NumGC":         func(m *runtime.MemStats) internal.Gauge { return mb(uint64(m.NumGC)) },
+	"OtherSys":      func(m *runtime.MemStats) internal.Gauge { return mb(m.OtherSys) },
+	"PauseTotalNs":  func(m *runtime.MemStats) internal.Gauge { return mb(m.PauseTotalNs) },
+	"StackInuse":    func(m *runtime.MemStats) internal.Gauge { return mb(m.StackInuse) },
+	"StackSys":      func(m *runtime.MemStats) internal.Gauge { return mb(m.StackSys) },
+	"Sys":           func(m *runtime.MemStats) internal.Gauge { return mb(m.Sys) },
+	"TotalAlloc":    func(m *runtime.MemStats) internal.Gauge { return mb(m.TotalAlloc) },
+	"RandomValue":   func(*runtime.MemStats) internal.Gauge { return internal.Gauge(rand.Float64()) * 1000 },
+}
+
+type RuntimeCollector struct{}
+
+func (c *RuntimeCollector) Name() string {
+	return RuntimeCollectorName
+}
+
+func (c *RuntimeCollector) Collect(context.Context) ([]serializer.Metrics, error) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	values := make(map[string]internal.Gauge, len(runtimeGauges))
+	for name, value := range runtimeGauges {
+		values[name] = value(&m)
+	}
+	return Gauges(values), nil
+}
@@ -1,9 +1,12 @@
 package gzip
 
 import (
+	"bufio"
 	"bytes"
 	"compress/gzip"
+	"errors"
 	"io"
+	"net"
 	"net/http"
 	"strings"
 
@@ -16,6 +19,7 @@ type compressWriter struct {
 	responseData struct {
 		status           int
 		compressibleType bool
+		compressed       bool
 	}
 }
 
@@ -36,6 +40,9 @@ func (c *compressWriter) Write(p []byte) (int, error) {
 		strings.Contains(contentType, "text/html")
 	if c.responseData.status < 300 && c.responseData.compressibleType {
 		c.w.Header().Set("Content-Encoding", "gzip")
+		// the length set by the handler is the uncompressed one
+		c.w.Header().Del("Content-Length")
+		c.responseData.compressed = true
 		return c.zw.Write(p)
 	}
 	return c.w.Write(p)
@@ -47,15 +54,37 @@ func (c *compressWriter) WriteHeader(statusCode int) {
 		strings.Contains(contentType, "text/html")
 	if c.responseData.status < 300 && c.responseData.compressibleType {
 		c.w.Header().Set("Content-Encoding", "gzip")
+		c.w.Header().Del("Content-Length")
 	}
 	c.w.WriteHeader(statusCode)
 	c.responseData.status = statusCode
 }
 
+// Close finishes the gzip stream, unless the response was written uncompressed.
 func (c *compressWriter) Close() error {
+	if !c.responseData.compressed {
+		return nil
+	}
 	return c.zw.Close()
 }
 
+func (c *compressWriter) Flush() {
+	if c.responseData.compressed {
+		_ = c.zw.Flush()
+	}
+	if f, ok := c.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (c *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := c.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return h.Hijack()
+}
+
 type compressReader struct {
 	r  io.ReadCloser
 	zr *gzip.Reader
@@ -1,13 +1,45 @@
 package internal
 
 type Config struct {
-	ServerAddress   string `env:"ADDRESS"`
-	PollInterval    int64  `env:"POLL_INTERVAL"`
-	ReportInterval  int64  `env:"REPORT_INTERVAL"`
-	LogLevel        string `env:"LOG_LEVEL"`
-	StoreInterval   int64  `env:"STORE_INTERVAL"`
-	FileStoragePath string `env:"FILE_STORAGE_PATH"`
-	Restore         bool   `env:"RESTORE"`
-	DatabaseDsn     string `env:"DATABASE_DSN"`
-	HashKey         string `env:"KEY"`
+	ServerAddress    string  `env:"ADDRESS"`
+	GRPCAddress      string  `env:"GRPC_ADDRESS"`
+	Transport        string  `env:"TRANSPORT"`
+	PollInterval     int64   `env:"POLL_INTERVAL"`
+	ReportInterval   int64   `env:"REPORT_INTERVAL"`
+	LogLevel         string  `env:"LOG_LEVEL"`
+	StoreInterval    int64   `env:"STORE_INTERVAL"`
+	FileStoragePath  string  `env:"FILE_STORAGE_PATH"`
+	Restore          bool    `env:"RESTORE"`
+	DatabaseDsn      string  `env:"DATABASE_DSN"`
+	HashKey          string  `env:"KEY"`
+	CryptoKey        string  `env:"CRYPTO_KEY"`
+	TLS              bool    `env:"TLS"`
+	TLSCert          string  `env:"TLS_CERT"`
+	TLSKey           string  `env:"TLS_KEY"`
+	TLSCA            string  `env:"TLS_CA"`
+	TLSClientCA      string  `env:"TLS_CLIENT_CA"`
+	TrustedSubnet    string  `env:"TRUSTED_SUBNET"`
+	Auth             bool    `env:"AUTH"`
+	AuthTokens       string  `env:"AUTH_TOKENS"`
+	AdminToken       string  `env:"ADMIN_TOKEN"`
+	Token            string  `env:"TOKEN"`
+	HistogramBuckets string  `env:"HISTOGRAM_BUCKETS"`
+	SummaryAccuracy  float64 `env:"SUMMARY_ACCURACY"`
+	SetPrecision     uint    `env:"SET_PRECISION"`
+	HistoryRetention int64   `env:"HISTORY_RETENTION"`
+	HistoryPolicies  string  `env:"HISTORY_POLICIES"`
+	StatsdAddress    string  `env:"STATSD_ADDRESS"`
+	StatsdFlush      int64   `env:"STATSD_FLUSH_INTERVAL"`
+	GraphiteAddress  string  `env:"GRAPHITE_ADDRESS"`
+	GraphiteRules    string  `env:"GRAPHITE_RULES"`
+	LineCounters     string  `env:"LINE_PROTOCOL_COUNTERS"`
+	StreamBuffer     int64   `env:"STREAM_BUFFER"`
+	AlertRules       string  `env:"ALERT_RULES"`
+	RateLimit        int64   `env:"RATE_LIMIT"`
+	SpoolDir         string  `env:"SPOOL_DIR"`
+	SpoolMaxSize     int64   `env:"SPOOL_MAX_SIZE"`
+	SpoolMaxAge      int64   `env:"SPOOL_MAX_AGE"`
+	Labels           string  `env:"LABELS"`
+	HostCollectors   string  `env:"HOST_COLLECTORS"`
+	DiskMounts       string  `env:"DISK_MOUNTS"`
 }
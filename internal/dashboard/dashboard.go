@@ -0,0 +1,35 @@
+// Package dashboard serves the built-in web UI. Its assets are embedded in the
+// binary and it loads data from the server's JSON endpoints only, so it works
+// without access to the internet.
+package dashboard
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// Handler serves index.html at "/" and the other assets by file name.
+type Handler struct {
+	files http.Handler
+}
+
+func New() *Handler {
+	sub, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err)
+	}
+	return &Handler{files: http.FileServer(http.FS(sub))}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Only GET requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	h.files.ServeHTTP(w, r)
+}
@@ -0,0 +1,36 @@
+package dashboard
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		code        int
+		contentType string
+		contains    string
+	}{
+		{name: "index", method: http.MethodGet, path: "/", code: http.StatusOK, contentType: "text/html", contains: `<script src="/dashboard/app.js">`},
+		{name: "script", method: http.MethodGet, path: "/app.js", code: http.StatusOK, contentType: "javascript", contains: `request("/json")`},
+		{name: "style", method: http.MethodGet, path: "/style.css", code: http.StatusOK, contentType: "text/css"},
+		{name: "missing", method: http.MethodGet, path: "/missing.js", code: http.StatusNotFound},
+		{name: "wrong method", method: http.MethodPost, path: "/", code: http.StatusMethodNotAllowed},
+	}
+	h := New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+			assert.Equal(t, tt.code, w.Code)
+			assert.Contains(t, w.Header().Get("Content-Type"), tt.contentType)
+			assert.Contains(t, w.Body.String(), tt.contains)
+		})
+	}
+}
@@ -0,0 +1,343 @@
+// The dashboard only talks to the server's own JSON endpoints:
+// GET /json for the metric table, POST /value for the current value
+// of one series and GET /series/{type}/{name} for its history.
+(function () {
+  "use strict";
+
+  const state = {
+    metrics: [],
+    sort: { key: "id", dir: 1 },
+    timer: null,
+  };
+
+  const $ = (id) => document.getElementById(id);
+
+  function el(tag, attrs, ...children) {
+    const node = document.createElement(tag);
+    for (const [k, v] of Object.entries(attrs || {})) {
+      if (k === "class") node.className = v;
+      else node.setAttribute(k, v);
+    }
+    for (const child of children) {
+      if (child == null) continue;
+      node.append(child instanceof Node ? child : String(child));
+    }
+    return node;
+  }
+
+  function svg(tag, attrs, ...children) {
+    const node = document.createElementNS("http://www.w3.org/2000/svg", tag);
+    for (const [k, v] of Object.entries(attrs || {})) node.setAttribute(k, v);
+    for (const child of children) node.append(child);
+    return node;
+  }
+
+  function showError(err) {
+    $("error").hidden = !err;
+    $("error").textContent = err ? String(err.message || err) : "";
+  }
+
+  const tokenKey = "metrics-token";
+
+  async function request(url, options) {
+    options = Object.assign({}, options);
+    const token = localStorage.getItem(tokenKey);
+    if (token) {
+      options.headers = Object.assign({}, options.headers, { Authorization: "Bearer " + token });
+    }
+    const resp = await fetch(url, options);
+    if (resp.status === 401) {
+      throw new Error("The server requires a token with the reader role, set one with the Token button.");
+    }
+    if (!resp.ok) {
+      const text = (await resp.text()).trim();
+      const err = new Error(text || resp.status + " " + resp.statusText);
+      err.status = resp.status;
+      throw err;
+    }
+    return resp.json();
+  }
+
+  function formatNumber(v) {
+    if (v == null || Number.isNaN(v)) return "—";
+    if (Number.isInteger(v)) return v.toLocaleString("en-US");
+    return v.toLocaleString("en-US", { maximumSignificantDigits: 6 });
+  }
+
+  function labelText(labels) {
+    return Object.keys(labels || {}).sort().map((k) => k + "=" + labels[k]).join(",");
+  }
+
+  function labelNodes(labels) {
+    return Object.keys(labels || {}).sort().map((k) => el("span", { class: "label" }, k + "=" + labels[k]));
+  }
+
+  // value is what the table shows and sorts by for each metric type.
+  function value(m) {
+    switch (m.type) {
+      case "gauge":
+        return m.value;
+      case "counter":
+        return m.delta;
+      case "histogram":
+        return m.histogram ? m.histogram.count : null;
+      case "summary":
+        return m.summary ? m.summary.count : null;
+      default:
+        return null;
+    }
+  }
+
+  function valueText(m) {
+    switch (m.type) {
+      case "histogram":
+      case "summary":
+        return formatNumber(value(m)) + " obs";
+      case "set":
+        return "—";
+      default:
+        return formatNumber(value(m));
+    }
+  }
+
+  function detailHash(m) {
+    const params = new URLSearchParams(m.labels || {}).toString();
+    return "#/metric/" + encodeURIComponent(m.type) + "/" + encodeURIComponent(m.id) + (params ? "?" + params : "");
+  }
+
+  // matches reports whether m matches every word of the filter: name substrings
+  // and key=value label pairs.
+  function matches(m, words, type) {
+    if (type && m.type !== type) return false;
+    const labels = m.labels || {};
+    return words.every((word) => {
+      const eq = word.indexOf("=");
+      if (eq > 0) {
+        const k = word.slice(0, eq);
+        return k in labels && labels[k].toLowerCase().includes(word.slice(eq + 1));
+      }
+      return m.id.toLowerCase().includes(word) || labelText(labels).toLowerCase().includes(word);
+    });
+  }
+
+  function compare(a, b) {
+    const { key, dir } = state.sort;
+    let x;
+    let y;
+    switch (key) {
+      case "value":
+        x = value(a);
+        y = value(b);
+        if (x == null && y == null) return 0;
+        if (x == null) return 1;
+        if (y == null) return -1;
+        return (x - y) * dir;
+      case "labels":
+        x = labelText(a.labels);
+        y = labelText(b.labels);
+        break;
+      default:
+        x = a[key];
+        y = b[key];
+    }
+    return x.localeCompare(y, undefined, { numeric: true }) * dir || a.id.localeCompare(b.id);
+  }
+
+  function renderTable() {
+    const words = $("filter").value.toLowerCase().split(/\s+/).filter(Boolean);
+    const type = $("type-filter").value;
+    const rows = state.metrics.filter((m) => matches(m, words, type)).sort(compare);
+    $("metrics").tBodies[0].replaceChildren(...rows.map((m) =>
+      el("tr", {},
+        el("td", {}, el("a", { href: detailHash(m) }, m.id)),
+        el("td", {}, m.type),
+        el("td", {}, ...labelNodes(m.labels)),
+        el("td", { class: "num" }, valueText(m)))));
+    $("count").textContent = rows.length + " of " + state.metrics.length;
+    for (const th of document.querySelectorAll("#metrics th")) {
+      th.classList.toggle("asc", th.dataset.sort === state.sort.key && state.sort.dir > 0);
+      th.classList.toggle("desc", th.dataset.sort === state.sort.key && state.sort.dir < 0);
+    }
+  }
+
+  async function loadList() {
+    state.metrics = (await request("/json")) || [];
+    renderTable();
+  }
+
+  function detailRow(dl, name, v) {
+    dl.append(el("dt", {}, name), el("dd", {}, v));
+  }
+
+  function renderValue(m) {
+    const dl = $("detail-value");
+    dl.replaceChildren();
+    switch (m.type) {
+      case "gauge":
+        detailRow(dl, "value", formatNumber(m.value));
+        break;
+      case "counter":
+        detailRow(dl, "value", formatNumber(m.delta));
+        break;
+      case "histogram": {
+        const h = m.histogram;
+        detailRow(dl, "count", formatNumber(h.count));
+        detailRow(dl, "sum", formatNumber(h.sum));
+        detailRow(dl, "mean", formatNumber(h.count ? h.sum / h.count : null));
+        let cumulative = 0;
+        h.counts.forEach((c, i) => {
+          cumulative += c;
+          const bound = i < h.bounds.length ? "≤ " + formatNumber(h.bounds[i]) : "+Inf";
+          detailRow(dl, bound, formatNumber(cumulative));
+        });
+        break;
+      }
+      case "summary": {
+        const s = m.summary;
+        detailRow(dl, "count", formatNumber(s.count));
+        detailRow(dl, "sum", formatNumber(s.sum));
+        detailRow(dl, "min", formatNumber(s.min));
+        detailRow(dl, "max", formatNumber(s.max));
+        detailRow(dl, "mean", formatNumber(s.count ? s.sum / s.count : null));
+        break;
+      }
+      case "set":
+        detailRow(dl, "distinct members", "~" + formatNumber(m.value));
+        break;
+    }
+  }
+
+  // renderChart draws points as a line with min/max value and start/end time ticks.
+  function renderChart(points) {
+    const chart = $("chart");
+    if (!points.length) {
+      chart.replaceChildren(el("p", { class: "muted" }, "No points in this range."));
+      return;
+    }
+    const width = 1000;
+    const height = 320;
+    const pad = { left: 70, right: 10, top: 10, bottom: 25 };
+    const t0 = points[0].timestamp;
+    const t1 = points[points.length - 1].timestamp;
+    let v0 = Math.min(...points.map((p) => p.value));
+    let v1 = Math.max(...points.map((p) => p.value));
+    if (v0 === v1) {
+      v0 -= 1;
+      v1 += 1;
+    }
+    const x = (t) => pad.left + (t1 === t0 ? 0.5 : (t - t0) / (t1 - t0)) * (width - pad.left - pad.right);
+    const y = (v) => pad.top + (1 - (v - v0) / (v1 - v0)) * (height - pad.top - pad.bottom);
+    const d = points.map((p, i) => (i ? "L" : "M") + x(p.timestamp).toFixed(1) + "," + y(p.value).toFixed(1)).join("");
+    const time = (t) => new Date(t).toLocaleString();
+    const hover = svg("text", { class: "tick", x: width - pad.right, y: pad.top + 12, "text-anchor": "end" });
+
+    const root = svg("svg", { viewBox: "0 0 " + width + " " + height, preserveAspectRatio: "none" },
+      svg("line", { class: "axis", x1: pad.left, y1: pad.top, x2: pad.left, y2: height - pad.bottom }),
+      svg("line", { class: "axis", x1: pad.left, y1: height - pad.bottom, x2: width - pad.right, y2: height - pad.bottom }),
+      svg("text", { class: "tick", x: pad.left - 6, y: y(v1) + 4, "text-anchor": "end" }, formatNumber(v1)),
+      svg("text", { class: "tick", x: pad.left - 6, y: y(v0) + 4, "text-anchor": "end" }, formatNumber(v0)),
+      svg("text", { class: "tick", x: pad.left, y: height - 6 }, time(t0)),
+      svg("text", { class: "tick", x: width - pad.right, y: height - 6, "text-anchor": "end" }, time(t1)),
+      svg("path", { class: "line", d: d }),
+      hover);
+    root.addEventListener("mousemove", (e) => {
+      const box = root.getBoundingClientRect();
+      const t = t0 + ((e.clientX - box.left) / box.width * width - pad.left) / (width - pad.left - pad.right) * (t1 - t0);
+      let nearest = points[0];
+      for (const p of points) {
+        if (Math.abs(p.timestamp - t) < Math.abs(nearest.timestamp - t)) nearest = p;
+      }
+      hover.textContent = time(nearest.timestamp) + "  " + formatNumber(nearest.value);
+    });
+    root.addEventListener("mouseleave", () => { hover.textContent = ""; });
+    chart.replaceChildren(root);
+  }
+
+  async function loadHistory(type, id, labels) {
+    if (type !== "gauge" && type !== "counter") {
+      $("chart").replaceChildren(el("p", { class: "muted" }, "History is kept for gauges and counters only."));
+      return;
+    }
+    const range = Number($("range").value);
+    const now = Date.now() / 1000;
+    const params = new URLSearchParams(labels);
+    params.set("from", String(now - range));
+    params.set("step", String(Math.max(1, Math.ceil(range / 300))));
+    params.set("agg", $("agg").value);
+    try {
+      const resp = await request("/series/" + encodeURIComponent(type) + "/" + encodeURIComponent(id) + "?" + params);
+      renderChart(resp.points || []);
+    } catch (err) {
+      if (err.status !== 404) throw err;
+      $("chart").replaceChildren(el("p", { class: "muted" }, "No history: " + err.message));
+    }
+  }
+
+  async function loadDetail(type, id, labels) {
+    $("detail-title").textContent = id;
+    const metric = await request("/value", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({ id: id, type: type, labels: labels }),
+    });
+    $("detail-labels").replaceChildren(el("span", { class: "label" }, type), ...labelNodes(metric.labels));
+    renderValue(metric);
+    await loadHistory(type, id, metric.labels || labels);
+  }
+
+  // route parses #/ and #/metric/{type}/{name}?label=value.
+  function route() {
+    const match = location.hash.match(/^#\/metric\/([^/]+)\/([^?]+)(?:\?(.*))?$/);
+    if (!match) return { view: "list" };
+    return {
+      view: "detail",
+      type: decodeURIComponent(match[1]),
+      id: decodeURIComponent(match[2]),
+      labels: Object.fromEntries(new URLSearchParams(match[3] || "")),
+    };
+  }
+
+  async function refresh() {
+    const r = route();
+    $("list-view").hidden = r.view !== "list";
+    $("detail-view").hidden = r.view !== "detail";
+    try {
+      if (r.view === "list") await loadList();
+      else await loadDetail(r.type, r.id, r.labels);
+      showError(null);
+      $("updated").textContent = "updated " + new Date().toLocaleTimeString();
+    } catch (err) {
+      showError(err);
+    }
+  }
+
+  function schedule() {
+    clearInterval(state.timer);
+    const seconds = Number($("refresh").value);
+    state.timer = seconds > 0 ? setInterval(refresh, seconds * 1000) : null;
+  }
+
+  for (const th of document.querySelectorAll("#metrics th")) {
+    th.addEventListener("click", () => {
+      const key = th.dataset.sort;
+      state.sort = { key: key, dir: state.sort.key === key ? -state.sort.dir : 1 };
+      renderTable();
+    });
+  }
+  $("token").addEventListener("click", () => {
+    const token = prompt("Bearer token, empty to forget it:", localStorage.getItem(tokenKey) || "");
+    if (token === null) return;
+    if (token.trim()) localStorage.setItem(tokenKey, token.trim());
+    else localStorage.removeItem(tokenKey);
+    refresh();
+  });
+  $("filter").addEventListener("input", renderTable);
+  $("type-filter").addEventListener("change", renderTable);
+  $("refresh").addEventListener("change", schedule);
+  $("range").addEventListener("change", refresh);
+  $("agg").addEventListener("change", refresh);
+  window.addEventListener("hashchange", refresh);
+
+  refresh();
+  schedule();
+})();
@@ -65,7 +65,55 @@ func CreateTable(ctx context.Context, db *sql.DB) error {
 			id VARCHAR PRIMARY KEY,
 			mtype VARCHAR NOT NULL,
 			delta BIGINT DEFAULT NULL,
-			mvalue FLOAT DEFAULT NULL
+			mvalue FLOAT DEFAULT NULL,
+			mdata TEXT DEFAULT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `ALTER TABLE metrics ADD COLUMN IF NOT EXISTS mdata TEXT DEFAULT NULL`)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS series_points (
+			key VARCHAR NOT NULL,
+			ts BIGINT NOT NULL,
+			value DOUBLE PRECISION NOT NULL
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS series_points_key_ts ON series_points (key, ts)`)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS series_rollups (
+			key VARCHAR NOT NULL,
+			resolution BIGINT NOT NULL,
+			ts BIGINT NOT NULL,
+			min DOUBLE PRECISION NOT NULL,
+			max DOUBLE PRECISION NOT NULL,
+			sum DOUBLE PRECISION NOT NULL,
+			count BIGINT NOT NULL,
+			last DOUBLE PRECISION NOT NULL,
+			PRIMARY KEY (key, resolution, ts)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS api_tokens (
+			id VARCHAR PRIMARY KEY,
+			name VARCHAR NOT NULL,
+			hash VARCHAR NOT NULL UNIQUE,
+			roles VARCHAR NOT NULL,
+			prefixes VARCHAR NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL
 		)
 	`)
 	if err != nil {
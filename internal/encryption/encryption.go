@@ -0,0 +1,235 @@
+// Package encryption hides request bodies from anyone but the server. The agent
+// encrypts a random AES-256-GCM key for the server's RSA (OAEP) or X25519 public
+// key and seals the body with it. Keys are PEM files, e.g. made with
+//
+//	openssl genpkey -algorithm X25519 -out private.pem
+//	openssl pkey -in private.pem -pubout -out public.pem
+package encryption
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Header names the scheme an encrypted body was sealed with.
+const Header = "Encryption"
+
+const (
+	SchemeRSA    = "rsa-oaep-aes256gcm"
+	SchemeX25519 = "x25519-aes256gcm"
+)
+
+var oaepLabel = []byte("metrics")
+
+var ErrDecrypt = errors.New("failed to decrypt body")
+
+type PublicKey struct {
+	key crypto.PublicKey
+}
+
+type PrivateKey struct {
+	key crypto.PrivateKey
+}
+
+func LoadPublicKey(path string) (*PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePublicKey(data)
+}
+
+// ParsePublicKey accepts a PKIX "PUBLIC KEY" or a PKCS #1 "RSA PUBLIC KEY" block.
+func ParsePublicKey(data []byte) (*PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found in public key")
+	}
+	var key crypto.PublicKey
+	var err error
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unexpected PEM block %q in public key", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+	case *ecdh.PublicKey:
+		if key.Curve() != ecdh.X25519() {
+			return nil, errors.New("only X25519 ECDH keys are supported")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T, expected RSA or X25519", key)
+	}
+	return &PublicKey{key: key}, nil
+}
+
+func LoadPrivateKey(path string) (*PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKey(data)
+}
+
+// ParsePrivateKey accepts a PKCS #8 "PRIVATE KEY" or a PKCS #1 "RSA PRIVATE KEY" block.
+func ParsePrivateKey(data []byte) (*PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found in private key")
+	}
+	var key crypto.PrivateKey
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unexpected PEM block %q in private key", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+	case *ecdh.PrivateKey:
+		if key.Curve() != ecdh.X25519() {
+			return nil, errors.New("only X25519 ECDH keys are supported")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T, expected RSA or X25519", key)
+	}
+	return &PrivateKey{key: key}, nil
+}
+
+func (k *PublicKey) Scheme() string {
+	if _, ok := k.key.(*rsa.PublicKey); ok {
+		return SchemeRSA
+	}
+	return SchemeX25519
+}
+
+func (k *PrivateKey) Scheme() string {
+	if _, ok := k.key.(*rsa.PrivateKey); ok {
+		return SchemeRSA
+	}
+	return SchemeX25519
+}
+
+// Encrypt returns the encrypted content key (RSA) or the ephemeral public key
+// (X25519), followed by the GCM nonce and the sealed plaintext.
+func (k *PublicKey) Encrypt(plaintext []byte) ([]byte, error) {
+	var header, contentKey []byte
+	switch key := k.key.(type) {
+	case *rsa.PublicKey:
+		contentKey = make([]byte, 32)
+		if _, err := rand.Read(contentKey); err != nil {
+			return nil, err
+		}
+		var err error
+		header, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, key, contentKey, oaepLabel)
+		if err != nil {
+			return nil, err
+		}
+	case *ecdh.PublicKey:
+		ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		secret, err := ephemeral.ECDH(key)
+		if err != nil {
+			return nil, err
+		}
+		header = ephemeral.PublicKey().Bytes()
+		contentKey = deriveKey(secret, header, key.Bytes())
+	}
+	aead, err := newAEAD(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(header)+aead.NonceSize(), len(header)+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	copy(out, header)
+	nonce := out[len(header):]
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(out, nonce, plaintext, nil), nil
+}
+
+func (k *PrivateKey) Decrypt(data []byte) ([]byte, error) {
+	var contentKey []byte
+	switch key := k.key.(type) {
+	case *rsa.PrivateKey:
+		size := key.Size()
+		if len(data) < size {
+			return nil, ErrDecrypt
+		}
+		var err error
+		contentKey, err = rsa.DecryptOAEP(sha256.New(), nil, key, data[:size], oaepLabel)
+		if err != nil {
+			return nil, ErrDecrypt
+		}
+		data = data[size:]
+	case *ecdh.PrivateKey:
+		size := len(key.PublicKey().Bytes())
+		if len(data) < size {
+			return nil, ErrDecrypt
+		}
+		ephemeral, err := ecdh.X25519().NewPublicKey(data[:size])
+		if err != nil {
+			return nil, ErrDecrypt
+		}
+		secret, err := key.ECDH(ephemeral)
+		if err != nil {
+			return nil, ErrDecrypt
+		}
+		contentKey = deriveKey(secret, data[:size], key.PublicKey().Bytes())
+		data = data[size:]
+	}
+	aead, err := newAEAD(contentKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// deriveKey binds the AES key to both public keys of the exchange.
+func deriveKey(secret, ephemeral, recipient []byte) []byte {
+	h := sha256.New()
+	h.Write(secret)
+	h.Write(ephemeral)
+	h.Write(recipient)
+	return h.Sum(nil)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,165 @@
+package encryption
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/compress/gzip"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/hash"
+	customHttp "github.com/krm-shrftdnv/go-musthave-metrics/internal/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeKeys writes the PEM encoded key pair to a temp dir and returns their paths.
+func writeKeys(t *testing.T, private any, public any) (string, string) {
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	require.NoError(t, err)
+	dir := t.TempDir()
+	privatePath := filepath.Join(dir, "private.pem")
+	publicPath := filepath.Join(dir, "public.pem")
+	require.NoError(t, os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600))
+	require.NoError(t, os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0644))
+	return privatePath, publicPath
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	x25519Key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		private any
+		public  any
+		scheme  string
+	}{
+		{name: "rsa", private: rsaKey, public: &rsaKey.PublicKey, scheme: SchemeRSA},
+		{name: "x25519", private: x25519Key, public: x25519Key.PublicKey(), scheme: SchemeX25519},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			privatePath, publicPath := writeKeys(t, tt.private, tt.public)
+			privateKey, err := LoadPrivateKey(privatePath)
+			require.NoError(t, err)
+			publicKey, err := LoadPublicKey(publicPath)
+			require.NoError(t, err)
+			assert.Equal(t, tt.scheme, publicKey.Scheme())
+			assert.Equal(t, tt.scheme, privateKey.Scheme())
+
+			plaintext := []byte(`[{"id":"PollCount","type":"counter","delta":1}]`)
+			ciphertext, err := publicKey.Encrypt(plaintext)
+			require.NoError(t, err)
+			assert.NotContains(t, string(ciphertext), "PollCount")
+			decrypted, err := privateKey.Decrypt(ciphertext)
+			require.NoError(t, err)
+			assert.Equal(t, plaintext, decrypted)
+
+			ciphertext[len(ciphertext)-1] ^= 1
+			_, err = privateKey.Decrypt(ciphertext)
+			assert.ErrorIs(t, err, ErrDecrypt)
+			_, err = privateKey.Decrypt(ciphertext[:10])
+			assert.ErrorIs(t, err, ErrDecrypt)
+		})
+	}
+}
+
+func TestLoadKey_errors(t *testing.T) {
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	privatePath, publicPath := writeKeys(t, ecdsaKey, &ecdsaKey.PublicKey)
+	_, err = LoadPrivateKey(privatePath)
+	assert.ErrorContains(t, err, "unsupported private key type")
+	_, err = LoadPublicKey(publicPath)
+	assert.ErrorContains(t, err, "unsupported public key type")
+
+	_, err = LoadPublicKey(filepath.Join(t.TempDir(), "missing.pem"))
+	assert.Error(t, err)
+	_, err = ParsePublicKey([]byte("not a key"))
+	assert.Error(t, err)
+	_, err = ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{1}}))
+	assert.Error(t, err)
+}
+
+func TestDecryptRequestBody(t *testing.T) {
+	x25519Key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	privatePath, publicPath := writeKeys(t, x25519Key, x25519Key.PublicKey())
+	privateKey, err := LoadPrivateKey(privatePath)
+	require.NoError(t, err)
+	publicKey, err := LoadPublicKey(publicPath)
+	require.NoError(t, err)
+	otherKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, otherPublicPath := writeKeys(t, otherKey, otherKey.PublicKey())
+	otherPublicKey, err := LoadPublicKey(otherPublicPath)
+	require.NoError(t, err)
+
+	const hashKey = "secret"
+	var received string
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		received = string(body)
+	}
+	srv := httptest.NewServer(DecryptRequestBody(privateKey)(gzip.CompressRequestBody(hash.New(hashKey)(http.HandlerFunc(handler)))))
+	defer srv.Close()
+
+	tests := []struct {
+		name      string
+		transport http.RoundTripper
+		code      int
+	}{
+		{
+			name:      "encrypted",
+			transport: customHttp.Chain(nil, EncryptRequest(publicKey), gzip.CompressRequest(), hash.HashRequest(hashKey)),
+			code:      http.StatusOK,
+		},
+		{
+			name:      "plain",
+			transport: customHttp.Chain(nil, gzip.CompressRequest(), hash.HashRequest(hashKey)),
+			code:      http.StatusOK,
+		},
+		{
+			name:      "wrong key",
+			transport: customHttp.Chain(nil, EncryptRequest(otherPublicKey), gzip.CompressRequest()),
+			code:      http.StatusBadRequest,
+		},
+		{
+			name: "wrong scheme",
+			transport: customHttp.InternalRoundTripper(func(req *http.Request) (*http.Response, error) {
+				req.Header.Set(Header, SchemeRSA)
+				return http.DefaultTransport.RoundTrip(req)
+			}),
+			code: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			received = ""
+			client := http.Client{Transport: tt.transport}
+			resp, err := client.Post(srv.URL, "application/json", strings.NewReader(`{"id":"Alloc"}`))
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.code, resp.StatusCode)
+			if tt.code == http.StatusOK {
+				assert.Equal(t, `{"id":"Alloc"}`, received)
+			}
+		})
+	}
+}
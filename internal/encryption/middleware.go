@@ -0,0 +1,88 @@
+package encryption
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	customHttp "github.com/krm-shrftdnv/go-musthave-metrics/internal/http"
+)
+
+// DecryptRequestBody opens bodies sent with the Encryption header. It has to run
+// before gzip decompression and hash checks, since the agent encrypts last.
+// Requests without the header pass as they are.
+func DecryptRequestBody(key *PrivateKey) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		decryptFn := func(w http.ResponseWriter, r *http.Request) {
+			scheme := r.Header.Get(Header)
+			if scheme == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if key == nil {
+				http.Error(w, "encrypted bodies are not accepted, no crypto key is configured", http.StatusBadRequest)
+				return
+			}
+			if scheme != key.Scheme() {
+				http.Error(w, "unexpected encryption scheme "+scheme+", expected "+key.Scheme(), http.StatusBadRequest)
+				return
+			}
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			err = r.Body.Close()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			plaintext, err := key.Decrypt(body)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			r.Header.Del(Header)
+			r.Body = io.NopCloser(bytes.NewReader(plaintext))
+			r.ContentLength = int64(len(plaintext))
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(decryptFn)
+	}
+}
+
+// EncryptRequest encrypts request bodies for the server's key. It should be the
+// innermost middleware so that it seals the body as it goes over the wire.
+func EncryptRequest(key *PublicKey) customHttp.Middleware {
+	if key == nil {
+		return nil
+	}
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return customHttp.InternalRoundTripper(func(req *http.Request) (*http.Response, error) {
+			if req.Body == nil {
+				return rt.RoundTrip(req)
+			}
+			body, err := io.ReadAll(req.Body)
+			if err != nil {
+				return nil, err
+			}
+			err = req.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			ciphertext, err := key.Encrypt(body)
+			if err != nil {
+				return nil, err
+			}
+			header := req.Header
+			if header == nil {
+				header = make(http.Header)
+			}
+			header.Set(Header, key.Scheme())
+			req.Header = header
+			req.Body = io.NopCloser(bytes.NewReader(ciphertext))
+			req.ContentLength = int64(len(ciphertext))
+			return rt.RoundTrip(req)
+		})
+	}
+}
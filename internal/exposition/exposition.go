@@ -0,0 +1,284 @@
+// Package exposition renders metrics in the Prometheus text and OpenMetrics formats.
+package exposition
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/serializer"
+)
+
+type Format int
+
+const (
+	TextFormat Format = iota
+	OpenMetricsFormat
+)
+
+const (
+	TextContentType        = "text/plain; version=0.0.4; charset=utf-8"
+	OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+var summaryQuantiles = []float64{0.5, 0.9, 0.99}
+
+// Negotiate picks OpenMetrics when the Accept header asks for it.
+func Negotiate(accept string) Format {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, _ := strings.Cut(part, ";")
+		if strings.TrimSpace(mediaType) == "application/openmetrics-text" {
+			return OpenMetricsFormat
+		}
+	}
+	return TextFormat
+}
+
+func (f Format) ContentType() string {
+	if f == OpenMetricsFormat {
+		return OpenMetricsContentType
+	}
+	return TextContentType
+}
+
+type family struct {
+	name    string
+	mtype   string
+	metrics []serializer.Metrics
+}
+
+// Write renders metrics grouped into families by sanitized name. Series whose
+// sanitized name clashes with a family of another type are skipped.
+func Write(w io.Writer, metrics []serializer.Metrics, format Format) error {
+	families := make(map[string]*family)
+	for _, m := range metrics {
+		mtype := promType(internal.MetricTypeName(m.MType))
+		if mtype == "" {
+			continue
+		}
+		name := SanitizeName(m.ID)
+		if format == OpenMetricsFormat && mtype == "counter" {
+			name = strings.TrimSuffix(name, "_total")
+		}
+		f, ok := families[name]
+		if !ok {
+			f = &family{name: name, mtype: mtype}
+			families[name] = f
+		}
+		if f.mtype != mtype {
+			continue
+		}
+		f.metrics = append(f.metrics, m)
+	}
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		writeFamily(bw, families[name], format)
+	}
+	if format == OpenMetricsFormat {
+		bw.WriteString("# EOF\n")
+	}
+	return bw.Flush()
+}
+
+func promType(t internal.MetricTypeName) string {
+	switch t {
+	case internal.CounterName:
+		return "counter"
+	case internal.GaugeName, internal.SetName:
+		return "gauge"
+	case internal.HistogramName:
+		return "histogram"
+	case internal.SummaryName:
+		return "summary"
+	default:
+		return ""
+	}
+}
+
+func writeFamily(w *bufio.Writer, f *family, format Format) {
+	w.WriteString("# TYPE ")
+	w.WriteString(f.name)
+	w.WriteByte(' ')
+	w.WriteString(f.mtype)
+	w.WriteByte('\n')
+	for _, m := range f.metrics {
+		labels, ok := sanitizeLabels(m.Labels, reservedLabel(internal.MetricTypeName(m.MType)))
+		if !ok {
+			continue
+		}
+		switch internal.MetricTypeName(m.MType) {
+		case internal.CounterName:
+			if m.Delta == nil {
+				continue
+			}
+			name := f.name
+			if format == OpenMetricsFormat {
+				name += "_total"
+			}
+			writeSample(w, name, labels, "", "", float64(*m.Delta))
+		case internal.GaugeName:
+			if m.Value != nil {
+				writeSample(w, f.name, labels, "", "", float64(*m.Value))
+			}
+		case internal.SetName:
+			if m.Set != nil {
+				writeSample(w, f.name, labels, "", "", float64(m.Set.Estimate()))
+			}
+		case internal.HistogramName:
+			if m.Histogram != nil {
+				writeHistogram(w, f.name, labels, m.Histogram)
+			}
+		case internal.SummaryName:
+			if m.Summary != nil {
+				writeSummary(w, f.name, labels, m.Summary)
+			}
+		}
+	}
+}
+
+// reservedLabel returns the label the type adds to its samples.
+func reservedLabel(t internal.MetricTypeName) string {
+	switch t {
+	case internal.HistogramName:
+		return "le"
+	case internal.SummaryName:
+		return "quantile"
+	default:
+		return ""
+	}
+}
+
+// sanitizeLabels sanitizes label names and drops the reserved one. It reports
+// false when two names sanitize to the same one, as Prometheus rejects such series.
+func sanitizeLabels(labels internal.Labels, reserved string) (internal.Labels, bool) {
+	sanitized := make(internal.Labels, len(labels))
+	for k, v := range labels {
+		k = SanitizeLabelName(k)
+		if k == reserved {
+			continue
+		}
+		if _, ok := sanitized[k]; ok {
+			return nil, false
+		}
+		sanitized[k] = v
+	}
+	return sanitized, true
+}
+
+func writeHistogram(w *bufio.Writer, name string, labels internal.Labels, h *internal.Histogram) {
+	var cumulative uint64
+	for i, count := range h.Counts {
+		cumulative += count
+		le := math.Inf(1)
+		if i < len(h.Bounds) {
+			le = h.Bounds[i]
+		}
+		writeSample(w, name+"_bucket", labels, "le", formatFloat(le), float64(cumulative))
+	}
+	writeSample(w, name+"_sum", labels, "", "", h.Sum)
+	writeSample(w, name+"_count", labels, "", "", float64(h.Count))
+}
+
+func writeSummary(w *bufio.Writer, name string, labels internal.Labels, s *internal.Summary) {
+	if s.Count > 0 {
+		for _, q := range summaryQuantiles {
+			value, err := s.Quantile(q)
+			if err != nil {
+				continue
+			}
+			writeSample(w, name, labels, "quantile", formatFloat(q), value)
+		}
+	}
+	writeSample(w, name+"_sum", labels, "", "", s.Sum)
+	writeSample(w, name+"_count", labels, "", "", float64(s.Count))
+}
+
+// writeSample writes a sample line with sanitized labels; extraName adds a label
+// like le or quantile.
+func writeSample(w *bufio.Writer, name string, labels internal.Labels, extraName, extraValue string, value float64) {
+	w.WriteString(name)
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	if len(names) > 0 || extraName != "" {
+		w.WriteByte('{')
+		for i, k := range names {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, k, labels[k])
+		}
+		if extraName != "" {
+			if len(names) > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, extraName, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeLabel(w *bufio.Writer, name, value string) {
+	w.WriteString(name)
+	w.WriteString(`="`)
+	labelValueReplacer.WriteString(w, value)
+	w.WriteByte('"')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// SanitizeName replaces characters not allowed in metric names with underscores.
+func SanitizeName(name string) string {
+	return sanitize(name, true)
+}
+
+// SanitizeLabelName replaces characters not allowed in label names with underscores.
+func SanitizeLabelName(name string) string {
+	return sanitize(name, false)
+}
+
+func sanitize(name string, allowColon bool) string {
+	if name == "" {
+		return "_"
+	}
+	b := []byte(name)
+	for i, c := range b {
+		valid := c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+			allowColon && c == ':' || i > 0 && c >= '0' && c <= '9'
+		if !valid {
+			b[i] = '_'
+		}
+	}
+	if name[0] >= '0' && name[0] <= '9' {
+		return "_" + name[:1] + string(b[1:])
+	}
+	return string(b)
+}
@@ -0,0 +1,139 @@
+package exposition
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/serializer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testMetrics() []serializer.Metrics {
+	histogram := internal.NewHistogram([]float64{1, 5})
+	histogram.Observe(0.5)
+	histogram.Observe(3)
+	histogram.Observe(7)
+	alloc := serializer.NewGauge("Alloc", 1.5)
+	alloc.Labels = internal.Labels{"host": "a\"b", "dc-name": "eu\\1"}
+	return []serializer.Metrics{
+		serializer.NewCounter("PollCount", 5),
+		serializer.NewCounter("requests_total", 2),
+		alloc,
+		serializer.NewGauge("cpu.utilization", 0.25),
+		// clashes with the counter family and is skipped
+		serializer.NewGauge("PollCount", 1),
+		serializer.NewHistogram("Latency", histogram),
+	}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		want   string
+	}{
+		{
+			name:   "text",
+			format: TextFormat,
+			want: `# TYPE Alloc gauge
+Alloc{dc_name="eu\\1",host="a\"b"} 1.5
+# TYPE Latency histogram
+Latency_bucket{le="1"} 1
+Latency_bucket{le="5"} 2
+Latency_bucket{le="+Inf"} 3
+Latency_sum 10.5
+Latency_count 3
+# TYPE PollCount counter
+PollCount 5
+# TYPE cpu_utilization gauge
+cpu_utilization 0.25
+# TYPE requests_total counter
+requests_total 2
+`,
+		},
+		{
+			name:   "openmetrics",
+			format: OpenMetricsFormat,
+			want: `# TYPE Alloc gauge
+Alloc{dc_name="eu\\1",host="a\"b"} 1.5
+# TYPE Latency histogram
+Latency_bucket{le="1"} 1
+Latency_bucket{le="5"} 2
+Latency_bucket{le="+Inf"} 3
+Latency_sum 10.5
+Latency_count 3
+# TYPE PollCount counter
+PollCount_total 5
+# TYPE cpu_utilization gauge
+cpu_utilization 0.25
+# TYPE requests counter
+requests_total 2
+# EOF
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sb := &strings.Builder{}
+			require.NoError(t, Write(sb, testMetrics(), tt.format))
+			assert.Equal(t, tt.want, sb.String())
+		})
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   Format
+	}{
+		{accept: "", want: TextFormat},
+		{accept: "text/plain;version=0.0.4;q=0.5,*/*;q=0.1", want: TextFormat},
+		{accept: "application/openmetrics-text;version=1.0.0,application/openmetrics-text;version=0.0.1;q=0.75,text/plain;version=0.0.4;q=0.5", want: OpenMetricsFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			assert.Equal(t, tt.want, Negotiate(tt.accept))
+		})
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	assert.Equal(t, "http_requests:rate5m", SanitizeName("http.requests:rate5m"))
+	assert.Equal(t, "_9lives", SanitizeName("9lives"))
+	assert.Equal(t, "a_b", SanitizeLabelName("a:b"))
+}
+
+func TestWrite_labels(t *testing.T) {
+	histogram := internal.NewHistogram([]float64{1})
+	histogram.Observe(0.5)
+	latency := serializer.NewHistogram("Latency", histogram)
+	latency.Labels = internal.Labels{"le": "5", "host": "a"}
+	summary := internal.NewSummary(0.01)
+	summary.Observe(2)
+	size := serializer.NewSummary("Size", summary)
+	size.Labels = internal.Labels{"quantile": "0.5"}
+	// a-b and a_b sanitize to the same label name
+	clash := serializer.NewGauge("Alloc", 1)
+	clash.Labels = internal.Labels{"a-b": "1", "a_b": "2"}
+	alloc := serializer.NewGauge("Alloc", 2)
+	alloc.Labels = internal.Labels{"a-b": "1"}
+
+	sb := &strings.Builder{}
+	require.NoError(t, Write(sb, []serializer.Metrics{latency, size, clash, alloc}, TextFormat))
+	assert.Equal(t, `# TYPE Alloc gauge
+Alloc{a_b="1"} 2
+# TYPE Latency histogram
+Latency_bucket{host="a",le="1"} 1
+Latency_bucket{host="a",le="+Inf"} 1
+Latency_sum{host="a"} 0.5
+Latency_count{host="a"} 1
+# TYPE Size summary
+Size{quantile="0.5"} 2
+Size{quantile="0.9"} 2
+Size{quantile="0.99"} 2
+Size_sum 2
+Size_count 1
+`, sb.String())
+}
@@ -0,0 +1,155 @@
+// Package graphite receives metrics in the Graphite plaintext protocol over TCP.
+package graphite
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/logger"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/subnet"
+)
+
+// Sink stores a gauge value under a series key.
+type Sink interface {
+	SetGauge(key string, value internal.Gauge, t time.Time)
+}
+
+type Line struct {
+	Path  string
+	Tags  internal.Labels
+	Value float64
+	// Time is zero when the timestamp is missing or -1
+	Time time.Time
+}
+
+// Parse parses "path value timestamp" where path may carry tags as "path;tag=value".
+func Parse(s string) (Line, error) {
+	var l Line
+	fields := strings.Fields(s)
+	if len(fields) < 2 || len(fields) > 3 {
+		return l, errors.New("expected \"path value timestamp\"")
+	}
+	parts := strings.Split(fields[0], ";")
+	l.Path = parts[0]
+	if l.Path == "" {
+		return l, errors.New("empty path")
+	}
+	for _, tag := range parts[1:] {
+		name, value, ok := strings.Cut(tag, "=")
+		if !ok || name == "" || value == "" {
+			return l, fmt.Errorf("invalid tag %q", tag)
+		}
+		if l.Tags == nil {
+			l.Tags = make(internal.Labels)
+		}
+		l.Tags[name] = value
+	}
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil || math.IsNaN(value) {
+		return l, fmt.Errorf("invalid value %q", fields[1])
+	}
+	l.Value = value
+	if len(fields) == 3 && fields[2] != "-1" {
+		ts, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			return l, fmt.Errorf("invalid timestamp %q", fields[2])
+		}
+		l.Time = time.UnixMilli(int64(ts * 1000))
+	}
+	return l, nil
+}
+
+// Listener accepts Graphite connections on Addr and maps paths to series with Rules.
+type Listener struct {
+	Addr  string
+	Rules Rules
+	Sink  Sink
+	// Trusted refuses connections from other addresses, empty accepts everyone
+	Trusted subnet.Subnets
+}
+
+func (l *Listener) ListenAndServe(ctx context.Context) error {
+	ln, err := net.Listen("tcp", l.Addr)
+	if err != nil {
+		return err
+	}
+	return l.Serve(ctx, ln)
+}
+
+func (l *Listener) Serve(ctx context.Context, ln net.Listener) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	logger.Log.Infoln("Receiving Graphite on ", ln.Addr())
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		if !l.Trusted.AllowsAddr(conn.RemoteAddr()) {
+			logger.Log.Warnf("refusing graphite connection from untrusted %s", conn.RemoteAddr())
+			conn.Close()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.handleConn(ctx, conn)
+		}()
+	}
+}
+
+func (l *Listener) handleConn(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if err := l.HandleLine(line); err != nil {
+			logger.Log.Warnf("skipping graphite line %q from %s: %v", line, conn.RemoteAddr(), err)
+		}
+	}
+}
+
+func (l *Listener) HandleLine(s string) error {
+	line, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	name, labels, ok := l.Rules.Apply(line.Path)
+	if !ok {
+		return nil
+	}
+	t := line.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	l.Sink.SetGauge(internal.SeriesKey(name, labels.Merge(line.Tags)), internal.Gauge(line.Value), t)
+	return nil
+}
@@ -0,0 +1,171 @@
+package graphite
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/logger"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/subnet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSink struct {
+	mx     sync.Mutex
+	gauges map[string]internal.Gauge
+	times  map[string]time.Time
+}
+
+func (s *testSink) SetGauge(key string, value internal.Gauge, t time.Time) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.gauges[key] = value
+	s.times[key] = t
+}
+
+func (s *testSink) get(key string) (internal.Gauge, bool) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	value, ok := s.gauges[key]
+	return value, ok
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Line
+		wantErr bool
+	}{
+		{name: "plain", line: "servers.a.load 0.5 1700000000", want: Line{Path: "servers.a.load", Value: 0.5, Time: time.Unix(1700000000, 0)}},
+		{name: "no timestamp", line: "servers.a.load 2", want: Line{Path: "servers.a.load", Value: 2}},
+		{name: "now", line: "servers.a.load 2 -1", want: Line{Path: "servers.a.load", Value: 2}},
+		{
+			name: "tagged",
+			line: "disk.used;host=a;mount=/ 42 1700000000",
+			want: Line{Path: "disk.used", Tags: internal.Labels{"host": "a", "mount": "/"}, Value: 42, Time: time.Unix(1700000000, 0)},
+		},
+		{name: "bad value", line: "servers.a.load high 1700000000", wantErr: true},
+		{name: "bad timestamp", line: "servers.a.load 1 now", wantErr: true},
+		{name: "bad tag", line: "disk.used;host 42 1700000000", wantErr: true},
+		{name: "too many fields", line: "servers.a.load 1 2 3", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRules_Apply(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+rules:
+  - match: "collectd.*.cpu-*.cpu-*"
+    name: "collectd_cpu_${3}"
+    labels:
+      host: "$1"
+      cpu: "$2"
+  - match: "carbon.*.*"
+    drop: true
+`), 0644))
+	rules, err := LoadRules(path)
+	require.NoError(t, err)
+
+	tests := []struct {
+		path       string
+		wantName   string
+		wantLabels internal.Labels
+		wantOK     bool
+	}{
+		{path: "collectd.web1.cpu-0.cpu-idle", wantName: "collectd_cpu_idle", wantLabels: internal.Labels{"host": "web1", "cpu": "0"}, wantOK: true},
+		{path: "collectd.web1.cpu-0.cpu-idle.extra", wantName: "collectd.web1.cpu-0.cpu-idle.extra", wantLabels: internal.Labels{}, wantOK: true},
+		{path: "carbon.agents.cpuUsage", wantOK: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			name, labels, ok := rules.Apply(tt.path)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantName, name)
+			assert.Equal(t, tt.wantLabels, labels)
+		})
+	}
+
+	require.NoError(t, os.WriteFile(path, []byte("rules:\n  - match: \"a.*\"\n"), 0644))
+	_, err = LoadRules(path)
+	assert.Error(t, err)
+}
+
+func TestListener_Serve(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+	rules := Rules{{Match: "servers.*.load", Name: "load", Labels: map[string]string{"host": "$1"}}}
+	require.NoError(t, rules.Compile())
+	sink := &testSink{gauges: make(map[string]internal.Gauge), times: make(map[string]time.Time)}
+	l := &Listener{Rules: rules, Sink: sink}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- l.Serve(ctx, ln)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	_, err = conn.Write([]byte("servers.a.load 0.5 1700000000\nbroken line\nusers;dc=eu 12 1700000000\n"))
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, ok := sink.get(`users{dc="eu"}`)
+		return ok
+	}, time.Second, 10*time.Millisecond)
+	value, ok := sink.get(`load{host="a"}`)
+	assert.True(t, ok)
+	assert.Equal(t, internal.Gauge(0.5), value)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestListener_Serve_untrusted(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+	trusted, err := subnet.Parse("10.0.0.0/8")
+	require.NoError(t, err)
+	sink := &testSink{gauges: make(map[string]internal.Gauge), times: make(map[string]time.Time)}
+	l := &Listener{Sink: sink, Trusted: trusted}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- l.Serve(ctx, ln)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, _ = conn.Write([]byte("load 0.5 1700000000\n"))
+	// the server closes the connection without reading it
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = conn.Read(make([]byte, 1))
+	var netErr net.Error
+	require.Error(t, err)
+	assert.False(t, errors.As(err, &netErr) && netErr.Timeout(), "connection wasn't closed")
+	_, ok := sink.get("load")
+	assert.False(t, ok)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,82 @@
+package graphite
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"gopkg.in/yaml.v3"
+)
+
+// Rule maps paths matching Match, where * stands for characters within one path
+// component, to a metric name and labels. Templates refer to the text matched by
+// each * as $1, $2 or ${1} when followed by a letter or digit.
+type Rule struct {
+	Match  string            `yaml:"match"`
+	Name   string            `yaml:"name"`
+	Labels map[string]string `yaml:"labels"`
+	// Drop discards matching paths
+	Drop bool `yaml:"drop"`
+
+	re *regexp.Regexp
+}
+
+type Rules []Rule
+
+// LoadRules reads rules from a YAML file with a top-level rules list.
+func LoadRules(path string) (Rules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Rules Rules `yaml:"rules"`
+	}
+	if err = yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse graphite rules: %w", err)
+	}
+	if err = file.Rules.Compile(); err != nil {
+		return nil, err
+	}
+	return file.Rules, nil
+}
+
+func (rules Rules) Compile() error {
+	for i := range rules {
+		if rules[i].Match == "" {
+			return fmt.Errorf("graphite rule %d: match is required", i+1)
+		}
+		if rules[i].Name == "" && !rules[i].Drop {
+			return fmt.Errorf("graphite rule %q: name is required", rules[i].Match)
+		}
+		parts := strings.Split(rules[i].Match, ".")
+		for j, part := range parts {
+			parts[j] = strings.ReplaceAll(regexp.QuoteMeta(part), `\*`, `([^.]+)`)
+		}
+		rules[i].re = regexp.MustCompile(`^` + strings.Join(parts, `\.`) + `$`)
+	}
+	return nil
+}
+
+// Apply returns the metric name and labels of the first rule matching path.
+// Paths no rule matches keep the path as the name; ok is false for dropped paths.
+func (rules Rules) Apply(path string) (name string, labels internal.Labels, ok bool) {
+	for _, rule := range rules {
+		match := rule.re.FindStringSubmatchIndex(path)
+		if match == nil {
+			continue
+		}
+		if rule.Drop {
+			return "", nil, false
+		}
+		name = string(rule.re.ExpandString(nil, rule.Name, path, match))
+		labels = make(internal.Labels, len(rule.Labels))
+		for k, v := range rule.Labels {
+			labels[k] = string(rule.re.ExpandString(nil, v, path, match))
+		}
+		return name, labels, true
+	}
+	return path, internal.Labels{}, true
+}
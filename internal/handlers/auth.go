@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/auth"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/logger"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/serializer"
+)
+
+// TokensHandler is the admin API for tokens: GET lists them, POST creates one and
+// DELETE /{id} revokes one.
+type TokensHandler struct {
+	Store auth.Store
+}
+
+type createTokenRequest struct {
+	Name     string      `json:"name"`
+	Roles    []auth.Role `json:"roles"`
+	Prefixes []string    `json:"prefixes,omitempty"`
+}
+
+// tokenResponse leaves the hash out. Token is the secret, set only on creation.
+type tokenResponse struct {
+	ID        string      `json:"id"`
+	Name      string      `json:"name"`
+	Roles     []auth.Role `json:"roles"`
+	Prefixes  []string    `json:"prefixes,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	Token     string      `json:"token,omitempty"`
+}
+
+func newTokenResponse(token auth.Token) tokenResponse {
+	return tokenResponse{
+		ID:        token.ID,
+		Name:      token.Name,
+		Roles:     token.Roles,
+		Prefixes:  token.Prefixes,
+		CreatedAt: token.CreatedAt,
+	}
+}
+
+func (h *TokensHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	switch {
+	case r.Method == http.MethodGet && id == "":
+		h.list(w, r)
+	case r.Method == http.MethodPost && id == "":
+		h.create(w, r)
+	case r.Method == http.MethodDelete && id != "":
+		h.revoke(w, r, id)
+	default:
+		http.Error(w, "Only GET and POST to /admin/tokens and DELETE of /admin/tokens/{id} are allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *TokensHandler) list(w http.ResponseWriter, r *http.Request) {
+	tokens, err := h.Store.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp := make([]tokenResponse, 0, len(tokens))
+	for _, token := range tokens {
+		resp = append(resp, newTokenResponse(token))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *TokensHandler) create(w http.ResponseWriter, r *http.Request) {
+	var req createTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	token, secret, err := auth.NewToken(req.Name, req.Roles, req.Prefixes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = h.Store.Create(r.Context(), token); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Log.Infof("created token %s (%s) with roles %v", token.ID, token.Name, token.Roles)
+	resp := newTokenResponse(token)
+	resp.Token = secret
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func (h *TokensHandler) revoke(w http.ResponseWriter, r *http.Request, id string) {
+	err := h.Store.Revoke(r.Context(), id)
+	if errors.Is(err, auth.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	logger.Log.Infof("revoked token %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, err = w.Write(resp)
+	if err != nil {
+		logger.Log.Errorln(err)
+	}
+}
+
+// allowed answers 403 when the request token is scoped to other metric names.
+func allowed(w http.ResponseWriter, r *http.Request, name string) bool {
+	if !auth.Allows(r.Context(), name) {
+		http.Error(w, auth.ErrForbidden.Error(), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// scopeMetrics leaves out metrics outside the request token scope.
+func scopeMetrics(ctx context.Context, metrics []serializer.Metrics) []serializer.Metrics {
+	if !auth.Scoped(ctx) {
+		return metrics
+	}
+	scoped := make([]serializer.Metrics, 0, len(metrics))
+	for _, m := range metrics {
+		if auth.Allows(ctx, m.ID) {
+			scoped = append(scoped, m)
+		}
+	}
+	return scoped
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/auth"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokensHandler(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+	store, err := auth.NewFileStore(filepath.Join(t.TempDir(), "tokens.json"))
+	require.NoError(t, err)
+	handler := &TokensHandler{Store: store}
+	r := chi.NewRouter()
+	r.Handle("/admin/tokens", handler)
+	r.Handle("/admin/tokens/{id}", handler)
+
+	serve := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+
+	w := serve(http.MethodPost, "/admin/tokens", `{"name":"agent","roles":["writer"],"prefixes":["Heap"]}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created tokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.Token)
+	token, err := store.Lookup(context.Background(), auth.Hash(created.Token))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Heap"}, token.Prefixes)
+
+	w = serve(http.MethodPost, "/admin/tokens", `{"name":"agent","roles":["owner"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve(http.MethodGet, "/admin/tokens", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), token.Hash)
+	assert.NotContains(t, w.Body.String(), created.Token)
+	var listed []tokenResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	require.Len(t, listed, 1)
+	assert.Equal(t, created.ID, listed[0].ID)
+
+	w = serve(http.MethodDelete, "/admin/tokens/"+created.ID, "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = serve(http.MethodDelete, "/admin/tokens/"+created.ID, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
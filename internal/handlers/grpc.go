@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/auth"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/logger"
+	pb "github.com/krm-shrftdnv/go-musthave-metrics/internal/proto"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/serializer"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MetricsServer serves the gRPC API on the same storages as the HTTP handlers.
+type MetricsServer struct {
+	pb.UnimplementedMetricsServer
+	UpdateMetricHandler
+}
+
+func (s *MetricsServer) UpdateMetrics(ctx context.Context, req *pb.UpdateMetricsRequest) (*pb.UpdateMetricsResponse, error) {
+	metrics := make([]serializer.Metrics, 0, len(req.GetMetrics()))
+	for _, m := range req.GetMetrics() {
+		metrics = append(metrics, m.ToMetrics())
+	}
+	err := s.addMetrics(ctx, metrics)
+	if errors.Is(err, auth.ErrForbidden) {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	s.save(ctx)
+	return &pb.UpdateMetricsResponse{Metrics: req.GetMetrics()}, nil
+}
+
+func (s *MetricsServer) GetMetric(ctx context.Context, req *pb.GetMetricRequest) (*pb.GetMetricResponse, error) {
+	if !auth.Allows(ctx, req.GetId()) {
+		return nil, status.Error(codes.PermissionDenied, auth.ErrForbidden.Error())
+	}
+	metric, err := s.find(req.GetId(), pb.TypeName(req.GetType()), req.GetLabels())
+	if err != nil {
+		return nil, err
+	}
+	m, err := pb.FromMetrics(metric)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.GetMetricResponse{Metric: m}, nil
+}
+
+func (s *MetricsServer) ListMetrics(ctx context.Context, req *pb.ListMetricsRequest) (*pb.ListMetricsResponse, error) {
+	metrics := scopeMetrics(ctx, storage.SingletonOperator.FilterMetrics(req.GetLabels()))
+	resp := &pb.ListMetricsResponse{Metrics: make([]*pb.Metric, 0, len(metrics))}
+	for _, metric := range metrics {
+		m, err := pb.FromMetrics(metric)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		resp.Metrics = append(resp.Metrics, m)
+	}
+	return resp, nil
+}
+
+// PushMetrics applies metrics as they arrive. Invalid ones are skipped, so the client
+// can compare the accepted count with the number it sent.
+func (s *MetricsServer) PushMetrics(stream pb.Metrics_PushMetricsServer) error {
+	var accepted uint64
+	for {
+		m, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		metric := m.ToMetrics()
+		if !auth.Allows(stream.Context(), metric.ID) {
+			logger.Log.Warnf("skipping pushed metric %s: %v", metric.ID, auth.ErrForbidden)
+			continue
+		}
+		metric.Labels = sourceLabels(stream.Context(), metric.Labels)
+		if err = s.addMetric(internal.SeriesKey(metric.ID, metric.Labels), metric); err != nil {
+			logger.Log.Warnf("skipping pushed metric %s: %v", metric.ID, err)
+			continue
+		}
+		accepted++
+	}
+	s.save(stream.Context())
+	return stream.SendAndClose(&pb.PushMetricsResponse{Accepted: accepted})
+}
+
+// save stores metrics right away when the server is configured to store synchronously.
+func (s *MetricsServer) save(ctx context.Context) {
+	if s.FileStoragePath == "" {
+		return
+	}
+	if err := storage.SingletonOperator.SaveAllMetrics(ctx); err != nil {
+		logger.Log.Errorln(err)
+	}
+}
+
+// find looks up one series of a metric like JSONMetricStateHandler does.
+func (s *MetricsServer) find(id string, metricType internal.MetricTypeName, filter internal.Labels) (serializer.Metrics, error) {
+	metric := serializer.Metrics{ID: id, MType: string(metricType)}
+	var key string
+	var err error
+	switch metricType {
+	case internal.GaugeName:
+		key, metric.Value, err = storage.Find(s.GaugeStorage, id, filter)
+	case internal.CounterName:
+		key, metric.Delta, err = storage.Find(s.CounterStorage, id, filter)
+	case internal.HistogramName:
+		if s.HistogramStorage == nil {
+			return metric, status.Error(codes.Unimplemented, "histograms are not supported")
+		}
+		key, metric.Histogram, err = storage.Find(s.HistogramStorage, id, filter)
+	case internal.SummaryName:
+		if s.SummaryStorage == nil {
+			return metric, status.Error(codes.Unimplemented, "summaries are not supported")
+		}
+		key, metric.Summary, err = storage.Find(s.SummaryStorage, id, filter)
+	case internal.SetName:
+		if s.SetStorage == nil {
+			return metric, status.Error(codes.Unimplemented, "sets are not supported")
+		}
+		key, metric.Set, err = storage.Find[internal.Set](s.SetStorage, id, filter)
+		if err == nil {
+			estimate := internal.Gauge(metric.Set.Estimate())
+			metric.Value = &estimate
+		}
+	default:
+		return metric, status.Error(codes.InvalidArgument, metricTypeError)
+	}
+	if err != nil {
+		return metric, status.Error(findErrorCode(err), err.Error())
+	}
+	_, metric.Labels, err = internal.ParseSeriesKey(key)
+	if err != nil {
+		return metric, status.Error(codes.Internal, err.Error())
+	}
+	return metric, nil
+}
+
+func findErrorCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return codes.NotFound
+	case errors.Is(err, storage.ErrAmbiguous):
+		return codes.InvalidArgument
+	default:
+		return codes.Internal
+	}
+}
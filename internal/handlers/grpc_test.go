@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/hash"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/logger"
+	pb "github.com/krm-shrftdnv/go-musthave-metrics/internal/proto"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestMetricsClient(t *testing.T, serverKey, clientKey string) pb.MetricsClient {
+	require.NoError(t, logger.Initialize("error"))
+	var gaugeStorage storage.MemStorage[internal.Gauge]
+	var counterStorage storage.MemStorage[internal.Counter]
+	gaugeStorage.Init()
+	counterStorage.Init()
+	operator := storage.SingletonOperator
+	storage.SingletonOperator = &storage.Operator{GaugeStorage: &gaugeStorage, CounterStorage: &counterStorage}
+	t.Cleanup(func() {
+		storage.SingletonOperator = operator
+	})
+
+	ln := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(logger.UnaryWithLogging, hash.NewUnaryInterceptor(serverKey)),
+		grpc.StreamInterceptor(logger.StreamWithLogging),
+	)
+	pb.RegisterMetricsServer(s, &MetricsServer{
+		UpdateMetricHandler: UpdateMetricHandler{
+			GaugeStorage:   &gaugeStorage,
+			CounterStorage: &counterStorage,
+		},
+	})
+	go func() {
+		_ = s.Serve(ln)
+	}()
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.Dial(
+		"bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return ln.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithChainUnaryInterceptor(hash.HashUnaryRequest(clientKey)),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return pb.NewMetricsClient(conn)
+}
+
+func TestMetricsServer(t *testing.T) {
+	client := newTestMetricsClient(t, "secret", "secret")
+	ctx := context.Background()
+	delta := int64(3)
+	value := 1.5
+
+	var header metadata.MD
+	_, err := client.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+		{Id: "PollCount", Type: pb.Metric_COUNTER, Delta: &delta},
+		{Id: "Alloc", Type: pb.Metric_GAUGE, Value: &value, Labels: map[string]string{"host": "a"}},
+	}}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.NotEmpty(t, header.Get("hashsha256"))
+
+	stream, err := client.PushMetrics(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&pb.Metric{Id: "PollCount", Type: pb.Metric_COUNTER, Delta: &delta}))
+	require.NoError(t, stream.Send(&pb.Metric{Id: "Alloc", Type: pb.Metric_GAUGE}))
+	pushed, err := stream.CloseAndRecv()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), pushed.GetAccepted())
+
+	resp, err := client.GetMetric(ctx, &pb.GetMetricRequest{Id: "PollCount", Type: pb.Metric_COUNTER})
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), resp.GetMetric().GetDelta())
+
+	resp, err = client.GetMetric(ctx, &pb.GetMetricRequest{Id: "Alloc", Type: pb.Metric_GAUGE})
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, resp.GetMetric().GetValue())
+	assert.Equal(t, map[string]string{"host": "a"}, resp.GetMetric().GetLabels())
+
+	_, err = client.GetMetric(ctx, &pb.GetMetricRequest{Id: "Frees", Type: pb.Metric_GAUGE})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	list, err := client.ListMetrics(ctx, &pb.ListMetricsRequest{Labels: map[string]string{"host": "a"}})
+	require.NoError(t, err)
+	require.Len(t, list.GetMetrics(), 1)
+	assert.Equal(t, "Alloc", list.GetMetrics()[0].GetId())
+
+	_, err = client.UpdateMetrics(ctx, &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{{Id: "Alloc", Type: pb.Metric_GAUGE}}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestMetricsServer_hashMismatch(t *testing.T) {
+	client := newTestMetricsClient(t, "secret", "other")
+	delta := int64(1)
+	_, err := client.UpdateMetrics(context.Background(), &pb.UpdateMetricsRequest{Metrics: []*pb.Metric{
+		{Id: "PollCount", Type: pb.Metric_COUNTER, Delta: &delta},
+	}})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -2,50 +2,108 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/alert"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/auth"
 	"github.com/krm-shrftdnv/go-musthave-metrics/internal/db"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/exposition"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/lineprotocol"
 	"github.com/krm-shrftdnv/go-musthave-metrics/internal/logger"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/mtls"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/otlp"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/remotewrite"
 	"github.com/krm-shrftdnv/go-musthave-metrics/internal/serializer"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/series"
 	"github.com/krm-shrftdnv/go-musthave-metrics/internal/storage"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/stream"
 )
 
 type UpdateMetricHandler struct {
-	GaugeStorage    storage.Storage[internal.Gauge]
-	CounterStorage  storage.Storage[internal.Counter]
+	GaugeStorage     storage.Storage[internal.Gauge]
+	CounterStorage   storage.Storage[internal.Counter]
+	HistogramStorage storage.Storage[internal.Histogram]
+	HistogramBuckets []float64
+	SummaryStorage   storage.Storage[internal.Summary]
+	SummaryAccuracy  float64
+	SetStorage       *storage.SetStorage
+	History          *series.Store
+	// Hub receives metrics accepted by /update/ and /updates/
+	Hub             *stream.Hub
 	FileStoragePath string
 }
 
+const metricTypeError = "Metric type should be \"gauge\", \"counter\", \"histogram\", \"summary\" or \"set\""
+
 func (h *UpdateMetricHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Only POST requests are allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if !allowed(w, r, chi.URLParam(r, "metricName")) {
+		return
+	}
 	metricType := chi.URLParam(r, "metricType")
-	key := chi.URLParam(r, "metricName")
+	labels := sourceLabels(r.Context(), queryLabels(r))
+	key := internal.SeriesKey(chi.URLParam(r, "metricName"), labels)
 	value := chi.URLParam(r, "metricValue")
 	switch internal.MetricTypeName(metricType) {
 	case internal.GaugeName:
 		value, err := strconv.ParseFloat(value, 64)
 		if err != nil {
 			http.Error(w, "Value should be float", http.StatusBadRequest)
+			return
 		}
 		h.addGauge(key, internal.Gauge(value))
 	case internal.CounterName:
 		value, err := strconv.ParseInt(value, 10, 64)
 		if err != nil {
 			http.Error(w, "Value should be int", http.StatusBadRequest)
+			return
 		}
 		h.addCounter(key, internal.Counter(value))
+	case internal.HistogramName:
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			http.Error(w, "Value should be float", http.StatusBadRequest)
+			return
+		}
+		if err = h.observeHistogram(key, value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case internal.SummaryName:
+		value, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			http.Error(w, "Value should be float", http.StatusBadRequest)
+			return
+		}
+		if err = h.observeSummary(key, value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case internal.SetName:
+		if err := h.addMembers(key, value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 	default:
-		http.Error(w, "Metric type should be \"gauge\" or \"counter\"", http.StatusBadRequest)
+		http.Error(w, metricTypeError, http.StatusBadRequest)
+		return
 	}
+	h.publish(key, serializer.Metrics{ID: chi.URLParam(r, "metricName"), MType: metricType, Labels: labels})
 	if h.FileStoragePath != "" {
 		err := storage.SingletonOperator.SaveAllMetrics(r.Context())
 		if err != nil {
@@ -55,21 +113,420 @@ func (h *UpdateMetricHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *UpdateMetricHandler) addGauge(key string, value internal.Gauge) {
+	h.setGauge(key, value, time.Now())
+}
+
+func (h *UpdateMetricHandler) setGauge(key string, value internal.Gauge, t time.Time) {
 	h.GaugeStorage.Set(key, value)
+	h.record(internal.GaugeName, key, t, float64(value))
+}
+
+// addGaugeDelta atomically shifts a gauge, which starts from zero when missing.
+func (h *UpdateMetricHandler) addGaugeDelta(key string, delta internal.Gauge) {
+	value := h.GaugeStorage.Update(key, func(old *internal.Gauge) internal.Gauge {
+		if old == nil {
+			return delta
+		}
+		return *old + delta
+	})
+	h.record(internal.GaugeName, key, time.Now(), float64(value))
 }
 
 func (h *UpdateMetricHandler) addCounter(key string, value internal.Counter) {
-	oldValue, ok := h.CounterStorage.Get(key)
-	if !ok {
-		h.CounterStorage.Set(key, value)
-	} else {
-		h.CounterStorage.Set(key, *oldValue+value)
+	h.addCounterAt(key, value, time.Now())
+}
+
+func (h *UpdateMetricHandler) addCounterAt(key string, delta internal.Counter, t time.Time) {
+	value := h.CounterStorage.Update(key, func(old *internal.Counter) internal.Counter {
+		if old == nil {
+			return delta
+		}
+		return *old + delta
+	})
+	h.record(internal.CounterName, key, t, float64(value))
+}
+
+// setCounter stores the total of a counter, as opposed to addCounter which adds a delta.
+func (h *UpdateMetricHandler) setCounter(key string, value internal.Counter, t time.Time) {
+	h.CounterStorage.Set(key, value)
+	h.record(internal.CounterName, key, t, float64(value))
+}
+
+func (h *UpdateMetricHandler) record(metricType internal.MetricTypeName, key string, t time.Time, value float64) {
+	if h.History != nil {
+		h.History.Append(series.Key(metricType, key), t, value)
+	}
+}
+
+func (h *UpdateMetricHandler) newHistogram() internal.Histogram {
+	buckets := h.HistogramBuckets
+	if buckets == nil {
+		buckets = internal.DefaultHistogramBuckets
+	}
+	return internal.NewHistogram(buckets)
+}
+
+// observeHistogram atomically adds observations to a histogram, which starts
+// with the configured buckets when missing.
+func (h *UpdateMetricHandler) observeHistogram(key string, values ...float64) error {
+	if h.HistogramStorage == nil {
+		return errors.New("histograms are not supported")
+	}
+	if err := finite(values...); err != nil {
+		return err
+	}
+	h.HistogramStorage.Update(key, func(old *internal.Histogram) internal.Histogram {
+		histogram := h.newHistogram()
+		if old != nil {
+			histogram = old.Clone()
+		}
+		for _, value := range values {
+			histogram.Observe(value)
+		}
+		return histogram
+	})
+	return nil
+}
+
+// addHistogram atomically merges value into the stored histogram and leaves it
+// unchanged when the buckets don't match.
+func (h *UpdateMetricHandler) addHistogram(key string, value internal.Histogram) error {
+	if h.HistogramStorage == nil {
+		return errors.New("histograms are not supported")
+	}
+	if err := value.Validate(); err != nil {
+		return err
+	}
+	var err error
+	h.HistogramStorage.Update(key, func(old *internal.Histogram) internal.Histogram {
+		if old == nil {
+			return value.Clone()
+		}
+		histogram := old.Clone()
+		if err = histogram.Merge(value); err != nil {
+			return *old
+		}
+		return histogram
+	})
+	return err
+}
+
+// setHistogram replaces a histogram with a cumulative one, as opposed to addHistogram which merges.
+func (h *UpdateMetricHandler) setHistogram(key string, value internal.Histogram) error {
+	if h.HistogramStorage == nil {
+		return errors.New("histograms are not supported")
+	}
+	if err := value.Validate(); err != nil {
+		return err
+	}
+	h.HistogramStorage.Set(key, value.Clone())
+	return nil
+}
+
+func (h *UpdateMetricHandler) newSummary() internal.Summary {
+	accuracy := h.SummaryAccuracy
+	if accuracy == 0 {
+		accuracy = internal.DefaultSummaryAccuracy
+	}
+	return internal.NewSummary(accuracy)
+}
+
+// observeSummary atomically adds observations to a summary, which starts
+// with the configured accuracy when missing.
+func (h *UpdateMetricHandler) observeSummary(key string, values ...float64) error {
+	if h.SummaryStorage == nil {
+		return errors.New("summaries are not supported")
+	}
+	if err := finite(values...); err != nil {
+		return err
+	}
+	h.SummaryStorage.Update(key, func(old *internal.Summary) internal.Summary {
+		summary := h.newSummary()
+		if old != nil {
+			summary = old.Clone()
+		}
+		for _, value := range values {
+			summary.Observe(value)
+		}
+		return summary
+	})
+	return nil
+}
+
+// addSummary atomically merges value into the stored summary and leaves it
+// unchanged when the accuracies don't match.
+func (h *UpdateMetricHandler) addSummary(key string, value internal.Summary) error {
+	if h.SummaryStorage == nil {
+		return errors.New("summaries are not supported")
+	}
+	if err := value.Validate(); err != nil {
+		return err
+	}
+	var err error
+	h.SummaryStorage.Update(key, func(old *internal.Summary) internal.Summary {
+		if old == nil {
+			return value.Clone()
+		}
+		summary := old.Clone()
+		if err = summary.Merge(value); err != nil {
+			return *old
+		}
+		return summary
+	})
+	return err
+}
+
+func (h *UpdateMetricHandler) addMembers(key string, members ...string) error {
+	if h.SetStorage == nil {
+		return errors.New("sets are not supported")
+	}
+	h.SetStorage.Add(key, members...)
+	return nil
+}
+
+func (h *UpdateMetricHandler) addSet(key string, value internal.Set) error {
+	if h.SetStorage == nil {
+		return errors.New("sets are not supported")
+	}
+	return h.SetStorage.Merge(key, value)
+}
+
+// current fills metric with the stored state of the series at key, as the JSON API reports it.
+func (h *UpdateMetricHandler) current(key string, metric serializer.Metrics) (serializer.Metrics, bool) {
+	var ok bool
+	switch internal.MetricTypeName(metric.MType) {
+	case internal.GaugeName:
+		metric.Value, ok = h.GaugeStorage.Get(key)
+	case internal.CounterName:
+		metric.Delta, ok = h.CounterStorage.Get(key)
+	case internal.HistogramName:
+		metric.Value, metric.Observations = nil, nil
+		metric.Histogram, ok = h.HistogramStorage.Get(key)
+	case internal.SummaryName:
+		metric.Value, metric.Observations = nil, nil
+		metric.Summary, ok = h.SummaryStorage.Get(key)
+	case internal.SetName:
+		metric.Value, metric.Members = nil, nil
+		metric.Set, ok = h.SetStorage.Get(key)
+		if ok {
+			estimate := internal.Gauge(metric.Set.Estimate())
+			metric.Value = &estimate
+		}
+	}
+	return metric, ok
+}
+
+// publish sends the stored state of an updated series to stream subscribers.
+func (h *UpdateMetricHandler) publish(key string, metric serializer.Metrics) {
+	if h.Hub == nil {
+		return
+	}
+	if len(metric.Labels) == 0 {
+		metric.Labels = nil
+	}
+	if metric, ok := h.current(key, metric); ok {
+		h.Hub.Publish(metric)
+	}
+}
+
+// addMetric applies histogram, summary and set updates either as a whole sketch to merge
+// or as raw observations passed in observations, members or value.
+func (h *UpdateMetricHandler) addMetric(key string, metric serializer.Metrics) error {
+	if err := requireValue(metric); err != nil {
+		return err
+	}
+	switch internal.MetricTypeName(metric.MType) {
+	case internal.GaugeName:
+		h.addGauge(key, *metric.Value)
+	case internal.CounterName:
+		h.addCounter(key, *metric.Delta)
+	case internal.HistogramName:
+		switch {
+		case metric.Histogram != nil:
+			return h.addHistogram(key, *metric.Histogram)
+		case len(metric.Observations) > 0:
+			return h.observeHistogram(key, metric.Observations...)
+		default:
+			return h.observeHistogram(key, float64(*metric.Value))
+		}
+	case internal.SummaryName:
+		switch {
+		case metric.Summary != nil:
+			return h.addSummary(key, *metric.Summary)
+		case len(metric.Observations) > 0:
+			return h.observeSummary(key, metric.Observations...)
+		default:
+			return h.observeSummary(key, float64(*metric.Value))
+		}
+	case internal.SetName:
+		if metric.Set != nil {
+			return h.addSet(key, *metric.Set)
+		}
+		return h.addMembers(key, metric.Members...)
+	}
+	return nil
+}
+
+// requireValue reports a metric missing the fields its type is updated with.
+func requireValue(metric serializer.Metrics) error {
+	switch internal.MetricTypeName(metric.MType) {
+	case internal.GaugeName:
+		if metric.Value == nil {
+			return errors.New("gauge value is required")
+		}
+	case internal.CounterName:
+		if metric.Delta == nil {
+			return errors.New("counter delta is required")
+		}
+	case internal.HistogramName:
+		if metric.Histogram == nil && len(metric.Observations) == 0 && metric.Value == nil {
+			return errors.New("histogram, observations or value is required")
+		}
+	case internal.SummaryName:
+		if metric.Summary == nil && len(metric.Observations) == 0 && metric.Value == nil {
+			return errors.New("summary, observations or value is required")
+		}
+	case internal.SetName:
+		if metric.Set == nil && len(metric.Members) == 0 {
+			return errors.New("set or members is required")
+		}
+	default:
+		return errors.New(metricTypeError)
+	}
+	return nil
+}
+
+// observations are the values a histogram or summary update without a sketch observes.
+func observations(metric serializer.Metrics) []float64 {
+	if len(metric.Observations) > 0 {
+		return metric.Observations
+	}
+	return []float64{float64(*metric.Value)}
+}
+
+// finite rejects NaN and infinite observations, which would spoil sums for good.
+func finite(values ...float64) error {
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return fmt.Errorf("observation %v should be finite", v)
+		}
+	}
+	return nil
+}
+
+// checkMetrics applies a batch to copies of the stored sketches, so a batch
+// that would fail partway is rejected before any of it is stored.
+func (h *UpdateMetricHandler) checkMetrics(metrics []serializer.Metrics) error {
+	histograms := make(map[string]internal.Histogram)
+	summaries := make(map[string]internal.Summary)
+	sets := make(map[string]internal.Set)
+	for _, metric := range metrics {
+		key := internal.SeriesKey(metric.ID, metric.Labels)
+		if err := h.checkMetric(key, metric, histograms, summaries, sets); err != nil {
+			return fmt.Errorf("%s: %w", metric.ID, err)
+		}
 	}
+	return nil
+}
+
+func (h *UpdateMetricHandler) checkMetric(
+	key string,
+	metric serializer.Metrics,
+	histograms map[string]internal.Histogram,
+	summaries map[string]internal.Summary,
+	sets map[string]internal.Set,
+) error {
+	if err := requireValue(metric); err != nil {
+		return err
+	}
+	switch internal.MetricTypeName(metric.MType) {
+	case internal.HistogramName:
+		if h.HistogramStorage == nil {
+			return errors.New("histograms are not supported")
+		}
+		histogram, ok := histograms[key]
+		if !ok {
+			if stored, found := h.HistogramStorage.Get(key); found {
+				histogram, ok = stored.Clone(), true
+			}
+		}
+		if metric.Histogram == nil {
+			if !ok {
+				histograms[key] = h.newHistogram()
+			}
+			return finite(observations(metric)...)
+		}
+		if err := metric.Histogram.Validate(); err != nil {
+			return err
+		}
+		if !ok {
+			histograms[key] = metric.Histogram.Clone()
+			return nil
+		}
+		if err := histogram.Merge(*metric.Histogram); err != nil {
+			return err
+		}
+		histograms[key] = histogram
+	case internal.SummaryName:
+		if h.SummaryStorage == nil {
+			return errors.New("summaries are not supported")
+		}
+		summary, ok := summaries[key]
+		if !ok {
+			if stored, found := h.SummaryStorage.Get(key); found {
+				summary, ok = stored.Clone(), true
+			}
+		}
+		if metric.Summary == nil {
+			if !ok {
+				summaries[key] = h.newSummary()
+			}
+			return finite(observations(metric)...)
+		}
+		if err := metric.Summary.Validate(); err != nil {
+			return err
+		}
+		if !ok {
+			summaries[key] = metric.Summary.Clone()
+			return nil
+		}
+		if err := summary.Merge(*metric.Summary); err != nil {
+			return err
+		}
+		summaries[key] = summary
+	case internal.SetName:
+		if h.SetStorage == nil {
+			return errors.New("sets are not supported")
+		}
+		set, ok := sets[key]
+		if !ok {
+			if stored, found := h.SetStorage.Get(key); found {
+				set, ok = stored.Clone(), true
+			} else {
+				set = internal.NewSet(h.SetStorage.Precision)
+			}
+		}
+		if metric.Set != nil {
+			if err := metric.Set.Validate(); err != nil {
+				return err
+			}
+			if !ok {
+				set = metric.Set.Clone()
+			} else if err := set.Merge(*metric.Set); err != nil {
+				return err
+			}
+		}
+		sets[key] = set
+	}
+	return nil
 }
 
 type StorageStateHandler struct {
-	GaugeStorage   storage.Storage[internal.Gauge]
-	CounterStorage storage.Storage[internal.Counter]
+	GaugeStorage     storage.Storage[internal.Gauge]
+	CounterStorage   storage.Storage[internal.Counter]
+	HistogramStorage storage.Storage[internal.Histogram]
+	SummaryStorage   storage.Storage[internal.Summary]
+	SetStorage       storage.Storage[internal.Set]
 }
 
 func (h *StorageStateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -77,11 +534,27 @@ func (h *StorageStateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Only GET requests are allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if auth.Scoped(r.Context()) {
+		http.Error(w, "scoped tokens can't read the whole storage, use /json", http.StatusForbidden)
+		return
+	}
 	sb := strings.Builder{}
 	sb.WriteString(h.CounterStorage.String())
 	sb.WriteString("\n")
 	sb.WriteString(h.GaugeStorage.String())
-	w.Header().Set("Content-Type", "text/html")
+	if h.HistogramStorage != nil {
+		sb.WriteString("\n")
+		sb.WriteString(h.HistogramStorage.String())
+	}
+	if h.SummaryStorage != nil {
+		sb.WriteString("\n")
+		sb.WriteString(h.SummaryStorage.String())
+	}
+	if h.SetStorage != nil {
+		sb.WriteString("\n")
+		sb.WriteString(h.SetStorage.String())
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	_, err := w.Write([]byte(sb.String()))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -89,8 +562,11 @@ func (h *StorageStateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request)
 }
 
 type MetricStateHandler struct {
-	GaugeStorage   storage.Storage[internal.Gauge]
-	CounterStorage storage.Storage[internal.Counter]
+	GaugeStorage     storage.Storage[internal.Gauge]
+	CounterStorage   storage.Storage[internal.Counter]
+	HistogramStorage storage.Storage[internal.Histogram]
+	SummaryStorage   storage.Storage[internal.Summary]
+	SetStorage       storage.Storage[internal.Set]
 }
 
 func (h *MetricStateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -99,25 +575,75 @@ func (h *MetricStateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	metricType := chi.URLParam(r, "metricType")
-	key := chi.URLParam(r, "metricName")
+	name := chi.URLParam(r, "metricName")
+	if !allowed(w, r, name) {
+		return
+	}
+	filter := queryLabels(r, "q")
 	var value string
 	switch internal.MetricTypeName(metricType) {
 	case internal.GaugeName:
-		element, ok := h.GaugeStorage.Get(key)
-		if !ok {
-			http.Error(w, "element not found", http.StatusNotFound)
+		_, element, err := storage.Find(h.GaugeStorage, name, filter)
+		if err != nil {
+			http.Error(w, err.Error(), findErrorStatus(err))
 			return
 		}
 		value = element.String()
 	case internal.CounterName:
-		element, ok := h.CounterStorage.Get(key)
-		if !ok {
-			http.Error(w, "element not found", http.StatusNotFound)
+		_, element, err := storage.Find(h.CounterStorage, name, filter)
+		if err != nil {
+			http.Error(w, err.Error(), findErrorStatus(err))
+			return
+		}
+		value = element.String()
+	case internal.HistogramName:
+		if h.HistogramStorage == nil {
+			http.Error(w, "histograms are not supported", http.StatusBadRequest)
+			return
+		}
+		_, element, err := storage.Find(h.HistogramStorage, name, filter)
+		if err != nil {
+			http.Error(w, err.Error(), findErrorStatus(err))
+			return
+		}
+		value = element.String()
+	case internal.SummaryName:
+		if h.SummaryStorage == nil {
+			http.Error(w, "summaries are not supported", http.StatusBadRequest)
+			return
+		}
+		_, element, err := storage.Find(h.SummaryStorage, name, filter)
+		if err != nil {
+			http.Error(w, err.Error(), findErrorStatus(err))
+			return
+		}
+		value = element.String()
+		if r.URL.Query().Has("q") {
+			q, err := strconv.ParseFloat(r.URL.Query().Get("q"), 64)
+			if err != nil {
+				http.Error(w, "Quantile should be float", http.StatusBadRequest)
+				return
+			}
+			quantile, err := element.Quantile(q)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			value = strconv.FormatFloat(quantile, 'f', -1, 64)
+		}
+	case internal.SetName:
+		if h.SetStorage == nil {
+			http.Error(w, "sets are not supported", http.StatusBadRequest)
+			return
+		}
+		_, element, err := storage.Find(h.SetStorage, name, filter)
+		if err != nil {
+			http.Error(w, err.Error(), findErrorStatus(err))
 			return
 		}
 		value = element.String()
 	default:
-		http.Error(w, "Metric type should be \"gauge\" or \"counter\"", http.StatusBadRequest)
+		http.Error(w, metricTypeError, http.StatusBadRequest)
 		return
 	}
 	w.Header().Set("Content-Type", "text/html")
@@ -147,27 +673,23 @@ func (h *JSONUpdateMetricHandler) ServeHTTP(w http.ResponseWriter, r *http.Reque
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	switch internal.MetricTypeName(metric.MType) {
-	case internal.GaugeName:
-		h.addGauge(metric.ID, *metric.Value)
-		value, ok := h.GaugeStorage.Get(metric.ID)
-		if !ok {
-			http.Error(w, "element not found", http.StatusNotFound)
-			return
-		}
-		metric.Value = value
-	case internal.CounterName:
-		h.addCounter(metric.ID, *metric.Delta)
-		delta, ok := h.CounterStorage.Get(metric.ID)
-		if !ok {
-			http.Error(w, "element not found", http.StatusNotFound)
-			return
-		}
-		metric.Delta = delta
-	default:
-		http.Error(w, "Metric type should be \"gauge\" or \"counter\"", http.StatusBadRequest)
+	if !allowed(w, r, metric.ID) {
+		return
+	}
+	metric.Labels = sourceLabels(r.Context(), metric.Labels)
+	key := internal.SeriesKey(metric.ID, metric.Labels)
+	if err = h.addMetric(key, metric); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	metric, ok := h.current(key, metric)
+	if !ok {
+		http.Error(w, "element not found", http.StatusNotFound)
 		return
 	}
+	if h.Hub != nil {
+		h.Hub.Publish(metric)
+	}
 	resp, err := json.Marshal(metric)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -202,7 +724,14 @@ func (h *JSONUpdateMetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Requ
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	h.addMetrics(metrics)
+	if err = h.addMetrics(r.Context(), metrics); errors.Is(err, auth.ErrForbidden) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	resp, err := json.Marshal(metrics)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -217,15 +746,26 @@ func (h *JSONUpdateMetricsHandler) ServeHTTP(w http.ResponseWriter, r *http.Requ
 	}
 }
 
-func (h *JSONUpdateMetricsHandler) addMetrics(metrics []serializer.Metrics) {
+// addMetrics labels metrics with the client identity in place, so callers can
+// echo them back. Nothing is stored if a metric is outside the token scope.
+func (h *UpdateMetricHandler) addMetrics(ctx context.Context, metrics []serializer.Metrics) error {
+	for i, metric := range metrics {
+		if !auth.Allows(ctx, metric.ID) {
+			return fmt.Errorf("%s: %w", metric.ID, auth.ErrForbidden)
+		}
+		metrics[i].Labels = sourceLabels(ctx, metric.Labels)
+	}
+	if err := h.checkMetrics(metrics); err != nil {
+		return err
+	}
 	for _, metric := range metrics {
-		switch internal.MetricTypeName(metric.MType) {
-		case internal.GaugeName:
-			h.addGauge(metric.ID, *metric.Value)
-		case internal.CounterName:
-			h.addCounter(metric.ID, *metric.Delta)
+		key := internal.SeriesKey(metric.ID, metric.Labels)
+		if err := h.addMetric(key, metric); err != nil {
+			return fmt.Errorf("%s: %w", metric.ID, err)
 		}
+		h.publish(key, metric)
 	}
+	return nil
 }
 
 type JSONStorageStateHandler struct {
@@ -237,7 +777,7 @@ func (h *JSONStorageStateHandler) ServeHTTP(w http.ResponseWriter, r *http.Reque
 		http.Error(w, "Only GET requests are allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	metrics := storage.SingletonOperator.GetAllMetrics()
+	metrics := scopeMetrics(r.Context(), storage.SingletonOperator.FilterMetrics(queryLabels(r)))
 	resp, err := json.Marshal(metrics)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -272,23 +812,71 @@ func (h *JSONMetricStateHandler) ServeHTTP(w http.ResponseWriter, r *http.Reques
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if !allowed(w, r, metric.ID) {
+		return
+	}
+	var key string
 	switch internal.MetricTypeName(metric.MType) {
 	case internal.GaugeName:
-		element, ok := h.GaugeStorage.Get(metric.ID)
-		if !ok {
-			http.Error(w, "element not found", http.StatusNotFound)
+		var element *internal.Gauge
+		key, element, err = storage.Find(h.GaugeStorage, metric.ID, metric.Labels)
+		if err != nil {
+			http.Error(w, err.Error(), findErrorStatus(err))
 			return
 		}
 		metric.Value = element
 	case internal.CounterName:
-		element, ok := h.CounterStorage.Get(metric.ID)
-		if !ok {
-			http.Error(w, "element not found", http.StatusNotFound)
+		var element *internal.Counter
+		key, element, err = storage.Find(h.CounterStorage, metric.ID, metric.Labels)
+		if err != nil {
+			http.Error(w, err.Error(), findErrorStatus(err))
 			return
 		}
 		metric.Delta = element
+	case internal.HistogramName:
+		if h.HistogramStorage == nil {
+			http.Error(w, "histograms are not supported", http.StatusBadRequest)
+			return
+		}
+		var element *internal.Histogram
+		key, element, err = storage.Find(h.HistogramStorage, metric.ID, metric.Labels)
+		if err != nil {
+			http.Error(w, err.Error(), findErrorStatus(err))
+			return
+		}
+		metric.Histogram = element
+	case internal.SummaryName:
+		if h.SummaryStorage == nil {
+			http.Error(w, "summaries are not supported", http.StatusBadRequest)
+			return
+		}
+		var element *internal.Summary
+		key, element, err = storage.Find(h.SummaryStorage, metric.ID, metric.Labels)
+		if err != nil {
+			http.Error(w, err.Error(), findErrorStatus(err))
+			return
+		}
+		metric.Summary = element
+	case internal.SetName:
+		if h.SetStorage == nil {
+			http.Error(w, "sets are not supported", http.StatusBadRequest)
+			return
+		}
+		var element *internal.Set
+		key, element, err = storage.Find(h.SetStorage, metric.ID, metric.Labels)
+		if err != nil {
+			http.Error(w, err.Error(), findErrorStatus(err))
+			return
+		}
+		estimate := internal.Gauge(element.Estimate())
+		metric.Set, metric.Value = element, &estimate
 	default:
-		http.Error(w, "Metric type should be \"gauge\" or \"counter\"", http.StatusBadRequest)
+		http.Error(w, metricTypeError, http.StatusBadRequest)
+		return
+	}
+	_, metric.Labels, err = internal.ParseSeriesKey(key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	resp, err := json.Marshal(metric)
@@ -305,6 +893,414 @@ func (h *JSONMetricStateHandler) ServeHTTP(w http.ResponseWriter, r *http.Reques
 	}
 }
 
+type SeriesHandler struct {
+	History *series.Store
+}
+
+type seriesResponse struct {
+	ID     string          `json:"id"`
+	MType  string          `json:"type"`
+	Labels internal.Labels `json:"labels,omitempty"`
+	Points []series.Point  `json:"points"`
+}
+
+func (h *SeriesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.History == nil {
+		http.Error(w, "history is disabled", http.StatusNotFound)
+		return
+	}
+	if !allowed(w, r, chi.URLParam(r, "metricName")) {
+		return
+	}
+	metricType := internal.MetricTypeName(chi.URLParam(r, "metricType"))
+	if metricType != internal.GaugeName && metricType != internal.CounterName {
+		http.Error(w, "History is kept for \"gauge\" and \"counter\" metrics only", http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	to, err := parseTime(query.Get("to"), time.Now())
+	if err != nil {
+		http.Error(w, "to: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	step, err := parseStep(query.Get("step"))
+	if err != nil {
+		http.Error(w, "step: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	agg, err := series.ParseAggregation(query.Get("agg"))
+	if err != nil {
+		http.Error(w, "agg: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	key, err := h.History.Find(r.Context(), metricType, chi.URLParam(r, "metricName"), queryLabels(r, "from", "to", "step", "agg"))
+	if err != nil {
+		http.Error(w, err.Error(), findErrorStatus(err))
+		return
+	}
+	// by default cover the retention of the tier the step is served from
+	_, tier := h.History.Policy(key).Tier(step)
+	defaultFrom := time.UnixMilli(0)
+	if tier.Retention > 0 {
+		defaultFrom = to.Add(-tier.Retention)
+	}
+	from, err := parseTime(query.Get("from"), defaultFrom)
+	if err != nil {
+		http.Error(w, "from: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	points, err := h.History.Query(r.Context(), key, series.Range{From: from, To: to, Step: step, Aggregation: agg})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name, labels, err := internal.ParseSeriesKey(strings.TrimPrefix(key, series.Key(metricType, "")))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp, err := json.Marshal(seriesResponse{ID: name, MType: string(metricType), Labels: labels, Points: points})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// parseTime accepts Unix seconds or RFC 3339.
+func parseTime(s string, def time.Time) (time.Time, error) {
+	if s == "" {
+		return def, nil
+	}
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.UnixMilli(int64(seconds * 1000)), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, errors.New("time should be Unix seconds or RFC 3339")
+	}
+	return t, nil
+}
+
+// parseStep accepts seconds or a Go duration like 30s.
+func parseStep(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if seconds, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	step, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.New("step should be seconds or a duration like 30s")
+	}
+	return step, nil
+}
+
+type RemoteWriteHandler struct {
+	UpdateMetricHandler
+}
+
+func (h *RemoteWriteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req, err := remotewrite.Decode(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = h.write(r.Context(), req); errors.Is(err, auth.ErrForbidden) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// write stores the samples of counters, known from metadata or by the _total suffix,
+// as counter totals and the samples of everything else as gauges.
+func (h *RemoteWriteHandler) write(ctx context.Context, req *remotewrite.WriteRequest) error {
+	keys := make([]string, len(req.Timeseries))
+	counters := make([]bool, len(req.Timeseries))
+	for i, ts := range req.Timeseries {
+		name, labels, err := ts.Name()
+		if err != nil {
+			return err
+		}
+		if !auth.Allows(ctx, name) {
+			return fmt.Errorf("%s: %w", name, auth.ErrForbidden)
+		}
+		keys[i] = internal.SeriesKey(name, sourceLabels(ctx, labels))
+		counters[i] = strings.HasSuffix(name, "_total") ||
+			req.Types[name] == remotewrite.Counter ||
+			req.Types[strings.TrimSuffix(name, "_total")] == remotewrite.Counter
+	}
+	for i, ts := range req.Timeseries {
+		for _, sample := range ts.Samples {
+			if sample.IsStale() || math.IsNaN(sample.Value) {
+				continue
+			}
+			t := time.UnixMilli(sample.Timestamp)
+			if counters[i] {
+				h.setCounter(keys[i], internal.Counter(math.Round(sample.Value)), t)
+			} else {
+				h.setGauge(keys[i], internal.Gauge(sample.Value), t)
+			}
+		}
+	}
+	return nil
+}
+
+type LineProtocolHandler struct {
+	UpdateMetricHandler
+	Counters lineprotocol.Counters
+}
+
+// ServeHTTP applies every line that parses and answers 400 listing the lines that don't.
+func (h *LineProtocolHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	precision, err := lineprotocol.ParsePrecision(r.URL.Query().Get("precision"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	points, lineErrs := lineprotocol.Parse(r.Body, precision)
+	for _, p := range points {
+		for _, f := range p.Fields {
+			if !allowed(w, r, p.FieldName(f)) {
+				return
+			}
+		}
+	}
+	for _, p := range points {
+		p.Tags = sourceLabels(r.Context(), p.Tags)
+		h.addPoint(p)
+	}
+	if len(lineErrs) > 0 {
+		messages := make([]string, 0, len(lineErrs))
+		for _, err := range lineErrs {
+			messages = append(messages, err.Error())
+		}
+		http.Error(w, strings.Join(messages, "\n"), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// addPoint stores numeric and boolean fields as gauges and the fields matching Counters
+// as counter totals. String fields carry no numbers and are skipped.
+func (h *LineProtocolHandler) addPoint(p lineprotocol.Point) {
+	t := p.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	for _, f := range p.Fields {
+		key := internal.SeriesKey(p.FieldName(f), p.Tags)
+		switch {
+		case f.Kind == lineprotocol.String:
+		case h.Counters.Match(p, f):
+			h.setCounter(key, internal.Counter(math.Round(f.Value)), t)
+		default:
+			h.setGauge(key, internal.Gauge(f.Value), t)
+		}
+	}
+}
+
+type OTLPHandler struct {
+	UpdateMetricHandler
+}
+
+// ServeHTTP answers with a partial success listing the data points that were rejected.
+func (h *OTLPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	format, err := otlp.ParseContentType(r.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req, err := otlp.Unmarshal(body, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	points, errs := otlp.Points(req)
+	for _, p := range points {
+		if !auth.Allows(r.Context(), p.Name) {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, auth.ErrForbidden))
+			continue
+		}
+		p.Labels = sourceLabels(r.Context(), p.Labels)
+		if err = h.addPoint(p); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.Name, err))
+		}
+	}
+	resp, err := otlp.MarshalResponse(errs, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentType())
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// addPoint stores monotonic sums as counters, cumulative ones as totals and delta ones
+// as increments. Other sums and gauges become gauges, and histograms are replaced when
+// cumulative or merged when delta.
+func (h *OTLPHandler) addPoint(p otlp.Point) error {
+	t := p.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	key := internal.SeriesKey(p.Name, p.Labels)
+	switch {
+	case p.Kind == otlp.Histogram && p.Cumulative:
+		return h.setHistogram(key, p.Histogram)
+	case p.Kind == otlp.Histogram:
+		return h.addHistogram(key, p.Histogram)
+	case p.Kind == otlp.Sum && p.Monotonic && p.Cumulative:
+		h.setCounter(key, internal.Counter(math.Round(p.Value)), t)
+	case p.Kind == otlp.Sum && p.Monotonic:
+		h.addCounterAt(key, internal.Counter(math.Round(p.Value)), t)
+	case p.Kind == otlp.Sum && !p.Cumulative:
+		h.addGaugeDelta(key, internal.Gauge(p.Value))
+	default:
+		h.setGauge(key, internal.Gauge(p.Value), t)
+	}
+	return nil
+}
+
+// StatsDSink applies metrics received by the StatsD listener.
+type StatsDSink struct {
+	UpdateMetricHandler
+}
+
+func (h *StatsDSink) AddCounter(key string, delta internal.Counter) {
+	h.addCounter(key, delta)
+}
+
+func (h *StatsDSink) SetGauge(key string, value internal.Gauge) {
+	h.addGauge(key, value)
+}
+
+func (h *StatsDSink) AddGauge(key string, delta internal.Gauge) {
+	h.addGaugeDelta(key, delta)
+}
+
+func (h *StatsDSink) ObserveHistogram(key string, value float64) bool {
+	if h.HistogramStorage == nil {
+		return false
+	}
+	if _, ok := h.HistogramStorage.Get(key); !ok {
+		return false
+	}
+	return h.observeHistogram(key, value) == nil
+}
+
+func (h *StatsDSink) AddMember(key string, member string) {
+	if err := h.addMembers(key, member); err != nil {
+		logger.Log.Warnf("skipping statsd set %s: %v", key, err)
+	}
+}
+
+// GraphiteSink applies metrics received by the Graphite listener.
+type GraphiteSink struct {
+	UpdateMetricHandler
+}
+
+func (h *GraphiteSink) SetGauge(key string, value internal.Gauge, t time.Time) {
+	h.setGauge(key, value, t)
+}
+
+type PrometheusHandler struct{}
+
+func (h *PrometheusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	format := exposition.Negotiate(r.Header.Get("Accept"))
+	var buf bytes.Buffer
+	err := exposition.Write(&buf, scopeMetrics(r.Context(), storage.SingletonOperator.GetAllMetrics()), format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", format.ContentType())
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(buf.Bytes())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+type AlertsHandler struct {
+	Engine *alert.Engine
+}
+
+func (h *AlertsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	alerts := make([]alert.Alert, 0)
+	if h.Engine != nil {
+		for _, a := range h.Engine.Alerts() {
+			if auth.Allows(r.Context(), a.Metric) {
+				alerts = append(alerts, a)
+			}
+		}
+	}
+	resp, err := json.Marshal(alerts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
 type DBPingHandler struct {
 	DB *sql.DB
 }
@@ -322,3 +1318,39 @@ func (h *DBPingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html")
 	w.WriteHeader(http.StatusOK)
 }
+
+// queryLabels treats every query parameter except the reserved ones as a label.
+func queryLabels(r *http.Request, reserved ...string) internal.Labels {
+	query := r.URL.Query()
+	for _, name := range reserved {
+		query.Del(name)
+	}
+	labels := make(internal.Labels, len(query))
+	for name, values := range query {
+		if len(values) > 0 {
+			labels[name] = values[0]
+		}
+	}
+	return labels
+}
+
+// sourceLabels adds the identity of a client with a verified certificate,
+// replacing any source label the client sent itself.
+func sourceLabels(ctx context.Context, labels internal.Labels) internal.Labels {
+	source := mtls.Source(ctx)
+	if source == "" {
+		return labels
+	}
+	return labels.Merge(internal.Labels{mtls.SourceLabel: source})
+}
+
+func findErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, storage.ErrNotFound), errors.Is(err, series.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, storage.ErrAmbiguous), errors.Is(err, series.ErrAmbiguous):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -1,17 +1,27 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-resty/resty/v2"
 	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/auth"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/lineprotocol"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/mtls"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/remotewrite"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/series"
 	"github.com/krm-shrftdnv/go-musthave-metrics/internal/storage"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestStorageStateHandler_ServeHTTP(t *testing.T) {
@@ -306,3 +316,741 @@ func TestMetricStateHandler_ServeHTTP(t *testing.T) {
 		})
 	}
 }
+
+func TestMetricStateHandler_labels(t *testing.T) {
+	var gaugeStorage storage.MemStorage[internal.Gauge]
+	var counterStorage storage.MemStorage[internal.Counter]
+	gaugeStorage.Init()
+	counterStorage.Init()
+
+	gaugeStorage.Set(internal.SeriesKey("Alloc", internal.Labels{"host": "a", "env": "prod"}), 1)
+	gaugeStorage.Set(internal.SeriesKey("Alloc", internal.Labels{"host": "b", "env": "prod"}), 2)
+	gaugeStorage.Set(internal.SeriesKey("HeapAlloc", internal.Labels{"host": "a"}), 3)
+
+	metricStateHandler := MetricStateHandler{
+		GaugeStorage:   &gaugeStorage,
+		CounterStorage: &counterStorage,
+	}
+	r := chi.NewRouter()
+	r.Handle("/value/{metricType}/{metricName}", &metricStateHandler)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	tests := []struct {
+		name         string
+		target       string
+		code         int
+		responseBody string
+	}{
+		{name: "exact labels", target: "/value/gauge/Alloc?host=b&env=prod", code: http.StatusOK, responseBody: "2"},
+		{name: "single matching series", target: "/value/gauge/Alloc?host=a", code: http.StatusOK, responseBody: "1"},
+		{name: "only series of name", target: "/value/gauge/HeapAlloc", code: http.StatusOK, responseBody: "3"},
+		{name: "ambiguous", target: "/value/gauge/Alloc?env=prod", code: http.StatusBadRequest},
+		{name: "no matching labels", target: "/value/gauge/Alloc?host=c", code: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := resty.New().R().Get(srv.URL + tt.target)
+			assert.NoError(t, err, "error making HTTP request")
+			assert.Equal(t, tt.code, resp.StatusCode(), "Response code didn't match expected")
+			if tt.responseBody != "" {
+				assert.Equal(t, tt.responseBody, string(resp.Body()))
+			}
+		})
+	}
+}
+
+func TestUpdateMetricHandler_source(t *testing.T) {
+	var gaugeStorage storage.MemStorage[internal.Gauge]
+	var counterStorage storage.MemStorage[internal.Counter]
+	gaugeStorage.Init()
+	counterStorage.Init()
+	updateMetricHandler := UpdateMetricHandler{
+		GaugeStorage:   &gaugeStorage,
+		CounterStorage: &counterStorage,
+	}
+	r := chi.NewRouter()
+	r.Handle("/update", &JSONUpdateMetricHandler{UpdateMetricHandler: updateMetricHandler})
+	r.Handle("/updates", &JSONUpdateMetricsHandler{UpdateMetricHandler: updateMetricHandler})
+	r.Handle("/update/{metricType}/{metricName}/{metricValue}", &updateMetricHandler)
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		key    string
+	}{
+		{name: "plain", target: "/update/gauge/Alloc/1?host=a", key: `Alloc{host="a",source="agent-1"}`},
+		{name: "json", target: "/update", body: `{"id":"Alloc","type":"gauge","value":2}`, key: `Alloc{source="agent-1"}`},
+		{name: "batch overrides source", target: "/updates", body: `[{"id":"PollCount","type":"counter","delta":1,"labels":{"source":"forged"}}]`, key: `PollCount{source="agent-1"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			req = req.WithContext(mtls.WithSource(req.Context(), "agent-1"))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			_, gauge := gaugeStorage.Get(tt.key)
+			_, counter := counterStorage.Get(tt.key)
+			assert.True(t, gauge || counter, "series %s wasn't stored", tt.key)
+		})
+	}
+}
+
+func TestUpdateMetricHandler_scope(t *testing.T) {
+	var gaugeStorage storage.MemStorage[internal.Gauge]
+	var counterStorage storage.MemStorage[internal.Counter]
+	gaugeStorage.Init()
+	counterStorage.Init()
+	updateMetricHandler := UpdateMetricHandler{
+		GaugeStorage:   &gaugeStorage,
+		CounterStorage: &counterStorage,
+	}
+	r := chi.NewRouter()
+	r.Handle("/update/{metricType}/{metricName}/{metricValue}", &updateMetricHandler)
+	r.Handle("/updates", &JSONUpdateMetricsHandler{UpdateMetricHandler: updateMetricHandler})
+	r.Handle("/value", &JSONMetricStateHandler{MetricStateHandler: MetricStateHandler{GaugeStorage: &gaugeStorage, CounterStorage: &counterStorage}})
+	token := &auth.Token{Roles: []auth.Role{auth.Writer}, Prefixes: []string{"Heap"}}
+
+	tests := []struct {
+		name   string
+		target string
+		body   string
+		code   int
+	}{
+		{name: "in scope", target: "/update/gauge/HeapAlloc/1", code: http.StatusOK},
+		{name: "out of scope", target: "/update/gauge/Alloc/1", code: http.StatusForbidden},
+		{name: "batch with one metric out of scope", target: "/updates", body: `[{"id":"HeapSys","type":"gauge","value":1},{"id":"PollCount","type":"counter","delta":1}]`, code: http.StatusForbidden},
+		{name: "value out of scope", target: "/value", body: `{"id":"Alloc","type":"gauge"}`, code: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			req = req.WithContext(auth.WithToken(req.Context(), token))
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			assert.Equal(t, tt.code, w.Code, w.Body.String())
+		})
+	}
+	// the rejected batch stores nothing
+	_, ok := gaugeStorage.Get("HeapSys")
+	assert.False(t, ok)
+}
+
+func TestJSONUpdateMetricHandler_histogram(t *testing.T) {
+	var gaugeStorage storage.MemStorage[internal.Gauge]
+	var counterStorage storage.MemStorage[internal.Counter]
+	var histogramStorage storage.MemStorage[internal.Histogram]
+	gaugeStorage.Init()
+	counterStorage.Init()
+	histogramStorage.Init()
+
+	updateMetricHandler := UpdateMetricHandler{
+		GaugeStorage:     &gaugeStorage,
+		CounterStorage:   &counterStorage,
+		HistogramStorage: &histogramStorage,
+		HistogramBuckets: []float64{1, 5},
+	}
+	jsonUpdateMetricHandler := JSONUpdateMetricHandler{UpdateMetricHandler: updateMetricHandler}
+	r := chi.NewRouter()
+	r.Handle("/update/", &jsonUpdateMetricHandler)
+	r.Handle("/update/{metricType}/{metricName}/{metricValue}", &updateMetricHandler)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		target     string
+		body       string
+		code       int
+		wantCounts []uint64
+	}{
+		{name: "observation in url", target: "/update/histogram/Latency/0.5", code: http.StatusOK, wantCounts: []uint64{1, 0, 0}},
+		{name: "observation in value", target: "/update/", body: `{"id":"Latency","type":"histogram","value":3}`, code: http.StatusOK, wantCounts: []uint64{1, 1, 0}},
+		{
+			name:       "merge histogram",
+			target:     "/update/",
+			body:       `{"id":"Latency","type":"histogram","histogram":{"bounds":[1,5],"counts":[1,2,3],"sum":40,"count":6}}`,
+			code:       http.StatusOK,
+			wantCounts: []uint64{2, 3, 3},
+		},
+		{
+			name:       "bounds mismatch",
+			target:     "/update/",
+			body:       `{"id":"Latency","type":"histogram","histogram":{"bounds":[2,5],"counts":[1,2,3],"sum":40,"count":6}}`,
+			code:       http.StatusBadRequest,
+			wantCounts: []uint64{2, 3, 3},
+		},
+		{name: "NaN observation", target: "/update/histogram/Latency/NaN", code: http.StatusBadRequest, wantCounts: []uint64{2, 3, 3}},
+		{name: "infinite observation", target: "/update/histogram/Latency/-Inf", code: http.StatusBadRequest, wantCounts: []uint64{2, 3, 3}},
+		{
+			name:       "invalid histogram",
+			target:     "/update/",
+			body:       `{"id":"Latency","type":"histogram","histogram":{"bounds":[1,5],"counts":[1,2],"sum":4,"count":3}}`,
+			code:       http.StatusBadRequest,
+			wantCounts: []uint64{2, 3, 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := resty.New().R().
+				SetHeader("Content-Type", "application/json").
+				SetBody(tt.body).
+				Post(srv.URL + tt.target)
+			assert.NoError(t, err, "error making HTTP request")
+			assert.Equal(t, tt.code, resp.StatusCode(), "Response code didn't match expected")
+			histogram, ok := histogramStorage.Get("Latency")
+			assert.True(t, ok)
+			assert.Equal(t, tt.wantCounts, histogram.Counts)
+		})
+	}
+}
+
+func TestJSONUpdateMetricsHandler_atomic(t *testing.T) {
+	var gaugeStorage storage.MemStorage[internal.Gauge]
+	var counterStorage storage.MemStorage[internal.Counter]
+	var histogramStorage storage.MemStorage[internal.Histogram]
+	gaugeStorage.Init()
+	counterStorage.Init()
+	histogramStorage.Init()
+	histogramStorage.Set("Latency", internal.NewHistogram([]float64{1, 5}))
+	handler := &JSONUpdateMetricsHandler{UpdateMetricHandler: UpdateMetricHandler{
+		GaugeStorage:     &gaugeStorage,
+		CounterStorage:   &counterStorage,
+		HistogramStorage: &histogramStorage,
+	}}
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "missing gauge value", body: `[{"id":"PollCount","type":"counter","delta":1},{"id":"Alloc","type":"gauge"}]`},
+		{name: "stored bounds mismatch", body: `[{"id":"PollCount","type":"counter","delta":1},{"id":"Latency","type":"histogram","histogram":{"bounds":[2],"counts":[0,0],"count":0}}]`},
+		{name: "bounds mismatch within batch", body: `[{"id":"PollCount","type":"counter","delta":1},{"id":"Size","type":"histogram","histogram":{"bounds":[1],"counts":[1,0],"count":1}},{"id":"Size","type":"histogram","histogram":{"bounds":[2],"counts":[1,0],"count":1}}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/updates", strings.NewReader(tt.body)))
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			_, ok := counterStorage.Get("PollCount")
+			assert.False(t, ok, "counter from a rejected batch was stored")
+			_, ok = histogramStorage.Get("Size")
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestUpdateMetricHandler_concurrentHistogram(t *testing.T) {
+	var histogramStorage storage.MemStorage[internal.Histogram]
+	histogramStorage.Init()
+	h := UpdateMetricHandler{HistogramStorage: &histogramStorage, HistogramBuckets: []float64{1}}
+	merged := internal.NewHistogram([]float64{1})
+	merged.Observe(2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, h.observeHistogram("Latency", 0.5))
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, h.addHistogram("Latency", merged))
+		}()
+	}
+	wg.Wait()
+	histogram, ok := histogramStorage.Get("Latency")
+	require.True(t, ok)
+	assert.Equal(t, []uint64{50, 50}, histogram.Counts)
+}
+
+func TestUpdateMetricHandler_concurrentSummary(t *testing.T) {
+	var summaryStorage storage.MemStorage[internal.Summary]
+	summaryStorage.Init()
+	h := UpdateMetricHandler{SummaryStorage: &summaryStorage}
+	merged := internal.NewSummary(internal.DefaultSummaryAccuracy)
+	merged.Observe(2)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, h.observeSummary("Latency", 0.5))
+		}()
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, h.addSummary("Latency", merged))
+		}()
+	}
+	wg.Wait()
+	summary, ok := summaryStorage.Get("Latency")
+	require.True(t, ok)
+	assert.Equal(t, uint64(100), summary.Count)
+}
+
+func TestMetricStateHandler_summary(t *testing.T) {
+	var gaugeStorage storage.MemStorage[internal.Gauge]
+	var counterStorage storage.MemStorage[internal.Counter]
+	var summaryStorage storage.MemStorage[internal.Summary]
+	gaugeStorage.Init()
+	counterStorage.Init()
+	summaryStorage.Init()
+
+	updateMetricHandler := UpdateMetricHandler{
+		GaugeStorage:    &gaugeStorage,
+		CounterStorage:  &counterStorage,
+		SummaryStorage:  &summaryStorage,
+		SummaryAccuracy: internal.DefaultSummaryAccuracy,
+	}
+	jsonUpdateMetricsHandler := JSONUpdateMetricsHandler{UpdateMetricHandler: updateMetricHandler}
+	metricStateHandler := MetricStateHandler{
+		GaugeStorage:   &gaugeStorage,
+		CounterStorage: &counterStorage,
+		SummaryStorage: &summaryStorage,
+	}
+	r := chi.NewRouter()
+	r.Handle("/updates/", &jsonUpdateMetricsHandler)
+	r.Handle("/value/{metricType}/{metricName}", &metricStateHandler)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	resp, err := resty.New().R().
+		SetHeader("Content-Type", "application/json").
+		SetBody(`[
+			{"id":"Duration","type":"summary","observations":[1,2,3,4,5,6,7,8,9,10],"labels":{"host":"a"}},
+			{"id":"Duration","type":"summary","summary":{"alpha":0.01,"bins":{"116":1},"count":1,"sum":10,"min":10,"max":10},"labels":{"host":"a"}}
+		]`).
+		Post(srv.URL + "/updates/")
+	assert.NoError(t, err, "error making HTTP request")
+	assert.Equal(t, http.StatusOK, resp.StatusCode(), string(resp.Body()))
+	assert.NoError(t, updateMetricHandler.observeSummary("Size", 1))
+	assert.Error(t, updateMetricHandler.observeSummary("Size", math.Inf(1)))
+	summary, ok := summaryStorage.Get("Size")
+	require.True(t, ok)
+	assert.Equal(t, uint64(1), summary.Count)
+
+	tests := []struct {
+		name   string
+		target string
+		code   int
+		want   string
+	}{
+		{name: "max quantile", target: "/value/summary/Duration?q=1", code: http.StatusOK, want: "10"},
+		{name: "min quantile with labels", target: "/value/summary/Duration?q=0&host=a", code: http.StatusOK, want: "1"},
+		{name: "quantile out of range", target: "/value/summary/Duration?q=2", code: http.StatusBadRequest},
+		{name: "bad quantile", target: "/value/summary/Duration?q=p99", code: http.StatusBadRequest},
+		{name: "unknown summary", target: "/value/summary/Latency?q=0.5", code: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := resty.New().R().Get(srv.URL + tt.target)
+			assert.NoError(t, err, "error making HTTP request")
+			assert.Equal(t, tt.code, resp.StatusCode(), "Response code didn't match expected")
+			if tt.want != "" {
+				assert.Equal(t, tt.want, string(resp.Body()))
+			}
+		})
+	}
+}
+
+func TestMetricStateHandler_set(t *testing.T) {
+	var gaugeStorage storage.MemStorage[internal.Gauge]
+	var counterStorage storage.MemStorage[internal.Counter]
+	setStorage := storage.NewSetStorage(&storage.MemStorage[internal.Set]{}, internal.DefaultSetPrecision)
+	gaugeStorage.Init()
+	counterStorage.Init()
+
+	updateMetricHandler := UpdateMetricHandler{
+		GaugeStorage:   &gaugeStorage,
+		CounterStorage: &counterStorage,
+		SetStorage:     setStorage,
+	}
+	jsonUpdateMetricsHandler := JSONUpdateMetricsHandler{UpdateMetricHandler: updateMetricHandler}
+	metricStateHandler := MetricStateHandler{
+		GaugeStorage:   &gaugeStorage,
+		CounterStorage: &counterStorage,
+		SetStorage:     setStorage,
+	}
+	r := chi.NewRouter()
+	r.Handle("/update/{metricType}/{metricName}/{metricValue}", &updateMetricHandler)
+	r.Handle("/updates/", &jsonUpdateMetricsHandler)
+	r.Handle("/value/{metricType}/{metricName}", &metricStateHandler)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	agentSet := internal.NewSet(internal.DefaultSetPrecision)
+	agentSet.Add("carol")
+	agentSet.Add("alice")
+	agentSetJSON, err := json.Marshal(agentSet)
+	require.NoError(t, err)
+
+	for _, member := range []string{"alice", "bob", "alice"} {
+		resp, err := resty.New().R().Post(srv.URL + "/update/set/Visitors/" + member)
+		assert.NoError(t, err, "error making HTTP request")
+		assert.Equal(t, http.StatusOK, resp.StatusCode())
+	}
+	resp, err := resty.New().R().
+		SetHeader("Content-Type", "application/json").
+		SetBody(`[
+			{"id":"Visitors","type":"set","members":["dave","bob"]},
+			{"id":"Visitors","type":"set","set":` + string(agentSetJSON) + `}
+		]`).
+		Post(srv.URL + "/updates/")
+	assert.NoError(t, err, "error making HTTP request")
+	assert.Equal(t, http.StatusOK, resp.StatusCode(), string(resp.Body()))
+
+	tests := []struct {
+		name   string
+		target string
+		code   int
+		want   string
+	}{
+		{name: "cardinality", target: "/value/set/Visitors", code: http.StatusOK, want: "4"},
+		{name: "unknown set", target: "/value/set/Hosts", code: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := resty.New().R().Get(srv.URL + tt.target)
+			assert.NoError(t, err, "error making HTTP request")
+			assert.Equal(t, tt.code, resp.StatusCode(), "Response code didn't match expected")
+			if tt.want != "" {
+				assert.Equal(t, tt.want, string(resp.Body()))
+			}
+		})
+	}
+}
+
+func TestSeriesHandler(t *testing.T) {
+	var gaugeStorage storage.MemStorage[internal.Gauge]
+	var counterStorage storage.MemStorage[internal.Counter]
+	gaugeStorage.Init()
+	counterStorage.Init()
+	history := series.NewStore(series.Policies{{Pattern: "*", Tiers: []series.Tier{{Retention: time.Hour}}}})
+
+	updateMetricHandler := UpdateMetricHandler{
+		GaugeStorage:   &gaugeStorage,
+		CounterStorage: &counterStorage,
+		History:        history,
+	}
+	seriesHandler := SeriesHandler{History: history}
+	r := chi.NewRouter()
+	r.Handle("/update/{metricType}/{metricName}/{metricValue}", &updateMetricHandler)
+	r.Handle("/series/{metricType}/{metricName}", &seriesHandler)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	start := time.Now()
+	for _, target := range []string{"/update/counter/PollCount/2", "/update/counter/PollCount/3", "/update/gauge/Alloc/1.5?host=a"} {
+		resp, err := resty.New().R().Post(srv.URL + target)
+		assert.NoError(t, err, "error making HTTP request")
+		assert.Equal(t, http.StatusOK, resp.StatusCode())
+	}
+	// one hour around the updates, so they fall into a single one-hour step
+	from := strconv.FormatInt(start.Add(-30*time.Minute).Unix(), 10)
+	to := strconv.FormatInt(start.Add(30*time.Minute).Unix(), 10)
+	rng := "from=" + from + "&to=" + to
+
+	tests := []struct {
+		name       string
+		target     string
+		code       int
+		wantValues []float64
+	}{
+		{name: "counter totals", target: "/series/counter/PollCount?" + rng, code: http.StatusOK, wantValues: []float64{2, 5}},
+		{name: "one step", target: "/series/counter/PollCount?step=1h&" + rng, code: http.StatusOK, wantValues: []float64{5}},
+		{name: "count per step", target: "/series/counter/PollCount?step=1h&agg=count&" + rng, code: http.StatusOK, wantValues: []float64{2}},
+		{name: "bad aggregation", target: "/series/counter/PollCount?step=1h&agg=median", code: http.StatusBadRequest},
+		{name: "gauge by label", target: "/series/gauge/Alloc?host=a&" + rng, code: http.StatusOK, wantValues: []float64{1.5}},
+		{name: "empty range", target: "/series/gauge/Alloc?from=2020-01-01T00:00:00Z&to=2020-01-02T00:00:00Z", code: http.StatusOK, wantValues: []float64{}},
+		{name: "bad step", target: "/series/gauge/Alloc?step=often", code: http.StatusBadRequest},
+		{name: "unknown series", target: "/series/gauge/PollCount", code: http.StatusNotFound},
+		{name: "unsupported type", target: "/series/summary/Alloc", code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body struct {
+				Points []series.Point `json:"points"`
+			}
+			resp, err := resty.New().R().SetResult(&body).Get(srv.URL + tt.target)
+			assert.NoError(t, err, "error making HTTP request")
+			assert.Equal(t, tt.code, resp.StatusCode(), string(resp.Body()))
+			if tt.wantValues != nil {
+				values := make([]float64, 0, len(body.Points))
+				for _, p := range body.Points {
+					values = append(values, p.V)
+				}
+				assert.Equal(t, tt.wantValues, values)
+			}
+		})
+	}
+}
+
+func TestRemoteWriteHandler(t *testing.T) {
+	var gaugeStorage storage.MemStorage[internal.Gauge]
+	var counterStorage storage.MemStorage[internal.Counter]
+	gaugeStorage.Init()
+	counterStorage.Init()
+	remoteWriteHandler := RemoteWriteHandler{
+		UpdateMetricHandler: UpdateMetricHandler{
+			GaugeStorage:   &gaugeStorage,
+			CounterStorage: &counterStorage,
+		},
+	}
+	r := chi.NewRouter()
+	r.Handle("/api/v1/write", &remoteWriteHandler)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		body     []byte
+		code     int
+		gauges   map[string]internal.Gauge
+		counters map[string]internal.Counter
+	}{
+		{
+			name: "gauges and counters",
+			body: remotewrite.Encode(&remotewrite.WriteRequest{
+				Timeseries: []remotewrite.TimeSeries{
+					{
+						Labels:  []remotewrite.Label{{Name: remotewrite.NameLabel, Value: "node_load1"}, {Name: "instance", Value: "a:9100"}},
+						Samples: []remotewrite.Sample{{Value: 0.5, Timestamp: 1000}, {Value: 0.75, Timestamp: 2000}},
+					},
+					{
+						Labels:  []remotewrite.Label{{Name: remotewrite.NameLabel, Value: "http_requests_total"}},
+						Samples: []remotewrite.Sample{{Value: 41, Timestamp: 1000}, {Value: 42, Timestamp: 2000}},
+					},
+					{
+						Labels:  []remotewrite.Label{{Name: remotewrite.NameLabel, Value: "errors"}},
+						Samples: []remotewrite.Sample{{Value: 3, Timestamp: 1000}},
+					},
+				},
+				Types: map[string]remotewrite.MetricType{"errors": remotewrite.Counter},
+			}),
+			code:     http.StatusNoContent,
+			gauges:   map[string]internal.Gauge{`node_load1{instance="a:9100"}`: 0.75},
+			counters: map[string]internal.Counter{"http_requests_total": 42, "errors": 3},
+		},
+		{
+			name: "series without name",
+			body: remotewrite.Encode(&remotewrite.WriteRequest{
+				Timeseries: []remotewrite.TimeSeries{{Labels: []remotewrite.Label{{Name: "job", Value: "node"}}}},
+			}),
+			code: http.StatusBadRequest,
+		},
+		{name: "not snappy", body: []byte("node_load1 0.5"), code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := resty.New().R().
+				SetHeader("Content-Type", "application/x-protobuf").
+				SetHeader("Content-Encoding", "snappy").
+				SetBody(tt.body).
+				Post(srv.URL + "/api/v1/write")
+			assert.NoError(t, err, "error making HTTP request")
+			assert.Equal(t, tt.code, resp.StatusCode(), string(resp.Body()))
+			for key, want := range tt.gauges {
+				value, ok := gaugeStorage.Get(key)
+				require.True(t, ok, key)
+				assert.Equal(t, want, *value)
+			}
+			for key, want := range tt.counters {
+				value, ok := counterStorage.Get(key)
+				require.True(t, ok, key)
+				assert.Equal(t, want, *value)
+			}
+		})
+	}
+}
+
+func TestLineProtocolHandler(t *testing.T) {
+	var gaugeStorage storage.MemStorage[internal.Gauge]
+	var counterStorage storage.MemStorage[internal.Counter]
+	gaugeStorage.Init()
+	counterStorage.Init()
+	lineProtocolHandler := LineProtocolHandler{
+		UpdateMetricHandler: UpdateMetricHandler{
+			GaugeStorage:   &gaugeStorage,
+			CounterStorage: &counterStorage,
+		},
+		Counters: lineprotocol.Counters{"net_bytes_*"},
+	}
+	r := chi.NewRouter()
+	r.Handle("/write", &lineProtocolHandler)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	tests := []struct {
+		name     string
+		target   string
+		body     string
+		code     int
+		wantBody string
+		gauges   map[string]internal.Gauge
+		counters map[string]internal.Counter
+	}{
+		{
+			name:   "fields",
+			target: "/write?precision=s",
+			body:   "cpu,host=a usage_idle=98.5,up=true 1700000000\nmem total=8i\nmem total=8i,state=\"ok\"\n",
+			code:   http.StatusNoContent,
+			gauges: map[string]internal.Gauge{
+				`cpu_usage_idle{host="a"}`: 98.5,
+				`cpu_up{host="a"}`:         1,
+				"mem_total":                8,
+			},
+		},
+		{
+			name:   "counter totals",
+			target: "/write",
+			body:   "requests_total,path=/ value=2i\nrequests_total,path=/ value=3i\nnet,iface=eth0 bytes_recv=100u,drop_in=1i\n",
+			code:   http.StatusNoContent,
+			gauges: map[string]internal.Gauge{`net_drop_in{iface="eth0"}`: 1},
+			counters: map[string]internal.Counter{
+				`requests_total{path="/"}`:     3,
+				`net_bytes_recv{iface="eth0"}`: 100,
+			},
+		},
+		{
+			name:     "per line errors",
+			target:   "/write",
+			body:     "mem used=1.5\nmem used\n\nmem free=lots\n",
+			code:     http.StatusBadRequest,
+			wantBody: "line 2: invalid field \"used\"\nline 4: invalid value \"lots\" in field \"free\"\n",
+			gauges:   map[string]internal.Gauge{"mem_used": 1.5},
+		},
+		{name: "bad precision", target: "/write?precision=h", body: "mem used=1", code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := resty.New().R().SetBody(tt.body).Post(srv.URL + tt.target)
+			assert.NoError(t, err, "error making HTTP request")
+			assert.Equal(t, tt.code, resp.StatusCode(), string(resp.Body()))
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, string(resp.Body()))
+			}
+			for key, want := range tt.gauges {
+				value, ok := gaugeStorage.Get(key)
+				require.True(t, ok, key)
+				assert.Equal(t, want, *value)
+			}
+			for key, want := range tt.counters {
+				value, ok := counterStorage.Get(key)
+				require.True(t, ok, key)
+				assert.Equal(t, want, *value)
+			}
+		})
+	}
+}
+
+func TestOTLPHandler(t *testing.T) {
+	var gaugeStorage storage.MemStorage[internal.Gauge]
+	var counterStorage storage.MemStorage[internal.Counter]
+	var histogramStorage storage.MemStorage[internal.Histogram]
+	gaugeStorage.Init()
+	counterStorage.Init()
+	histogramStorage.Init()
+	otlpHandler := OTLPHandler{
+		UpdateMetricHandler: UpdateMetricHandler{
+			GaugeStorage:     &gaugeStorage,
+			CounterStorage:   &counterStorage,
+			HistogramStorage: &histogramStorage,
+		},
+	}
+	r := chi.NewRouter()
+	r.Handle("/v1/metrics", &otlpHandler)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	export := func(metrics string) string {
+		return `{"resourceMetrics":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"checkout"}}]},` +
+			`"scopeMetrics":[{"metrics":[` + metrics + `]}]}]}`
+	}
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		code        int
+		response    string
+		gauges      map[string]internal.Gauge
+		counters    map[string]internal.Counter
+		histograms  map[string]uint64
+	}{
+		{
+			name:        "cumulative sum, delta sum and gauge",
+			contentType: "application/json",
+			body: export(`{"name":"requests","sum":{"aggregationTemporality":2,"isMonotonic":true,"dataPoints":[{"asInt":"10","timeUnixNano":"1700000000000000000"}]}},` +
+				`{"name":"errors","sum":{"aggregationTemporality":1,"isMonotonic":true,"dataPoints":[{"asInt":"2"},{"asInt":"3"}]}},` +
+				`{"name":"queue","sum":{"aggregationTemporality":1,"dataPoints":[{"asDouble":5},{"asDouble":-2}]}},` +
+				`{"name":"temperature","gauge":{"dataPoints":[{"asDouble":21.5,"attributes":[{"key":"room","value":{"stringValue":"a"}}]}]}}`),
+			code:     http.StatusOK,
+			response: `{}`,
+			gauges: map[string]internal.Gauge{
+				`queue{service.name="checkout"}`:                3,
+				`temperature{room="a",service.name="checkout"}`: 21.5,
+			},
+			counters: map[string]internal.Counter{`requests{service.name="checkout"}`: 10, `errors{service.name="checkout"}`: 5},
+		},
+		{
+			name:        "cumulative sum is a total",
+			contentType: "application/json",
+			body:        export(`{"name":"requests","sum":{"aggregationTemporality":2,"isMonotonic":true,"dataPoints":[{"asInt":"12"}]}}`),
+			code:        http.StatusOK,
+			response:    `{}`,
+			counters:    map[string]internal.Counter{`requests{service.name="checkout"}`: 12},
+		},
+		{
+			name:        "histograms",
+			contentType: "application/json",
+			body: export(`{"name":"latency","histogram":{"aggregationTemporality":1,"dataPoints":[` +
+				`{"count":"3","sum":0.6,"bucketCounts":["1","2","0"],"explicitBounds":[0.1,0.5]},` +
+				`{"count":"1","sum":0.05,"bucketCounts":["1","0","0"],"explicitBounds":[0.1,0.5]}]}},` +
+				`{"name":"size","histogram":{"aggregationTemporality":2,"dataPoints":[{"count":"2","sum":300,"bucketCounts":["1","1"],"explicitBounds":[100]}]}}`),
+			code:       http.StatusOK,
+			response:   `{}`,
+			histograms: map[string]uint64{`latency{service.name="checkout"}`: 4, `size{service.name="checkout"}`: 2},
+		},
+		{
+			name:        "rejected data points",
+			contentType: "application/json",
+			body: export(`{"name":"rpc","summary":{"dataPoints":[{"count":"1","sum":1}]}},` +
+				`{"name":"latency","histogram":{"aggregationTemporality":1,"dataPoints":[{"count":"1","sum":1,"bucketCounts":["1","0"],"explicitBounds":[2]}]}}`),
+			code:     http.StatusOK,
+			response: `{"partialSuccess":{"rejectedDataPoints":"2","errorMessage":"rpc: summaries are not supported (and 1 more)"}}`,
+		},
+		{name: "malformed", contentType: "application/json", body: `{"resourceMetrics":`, code: http.StatusBadRequest},
+		{name: "unsupported content type", contentType: "text/plain", body: "requests 1", code: http.StatusUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := resty.New().R().
+				SetHeader("Content-Type", tt.contentType).
+				SetBody(tt.body).
+				Post(srv.URL + "/v1/metrics")
+			assert.NoError(t, err, "error making HTTP request")
+			assert.Equal(t, tt.code, resp.StatusCode(), string(resp.Body()))
+			if tt.response != "" {
+				assert.JSONEq(t, tt.response, string(resp.Body()))
+			}
+			for key, want := range tt.gauges {
+				value, ok := gaugeStorage.Get(key)
+				require.True(t, ok, key)
+				assert.Equal(t, want, *value)
+			}
+			for key, want := range tt.counters {
+				value, ok := counterStorage.Get(key)
+				require.True(t, ok, key)
+				assert.Equal(t, want, *value)
+			}
+			for key, want := range tt.histograms {
+				value, ok := histogramStorage.Get(key)
+				require.True(t, ok, key)
+				assert.Equal(t, want, value.Count)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/auth"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/logger"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/stream"
+)
+
+const (
+	streamPingInterval = 15 * time.Second
+	streamWriteTimeout = 10 * time.Second
+)
+
+var upgrader = websocket.Upgrader{}
+
+// streamFilter reads the type, prefix and name glob query parameters;
+// the other parameters are labels. A scoped token narrows the names further.
+func streamFilter(r *http.Request) (stream.Filter, error) {
+	query := r.URL.Query()
+	filter := stream.Filter{
+		Type:   internal.MetricTypeName(query.Get("type")),
+		Prefix: query.Get("prefix"),
+		Glob:   query.Get("name"),
+		Labels: queryLabels(r, "type", "prefix", "name"),
+	}
+	if token, ok := auth.FromContext(r.Context()); ok {
+		filter.Scope = token.Prefixes
+	}
+	switch filter.Type {
+	case "", internal.GaugeName, internal.CounterName, internal.HistogramName, internal.SummaryName, internal.SetName:
+	default:
+		return filter, errors.New(metricTypeError)
+	}
+	return filter, filter.Validate()
+}
+
+// StreamHandler pushes accepted updates as Server-Sent Events: a metric event with
+// the JSON metric per update, and a dropped event with the number of updates lost
+// because the client fell behind.
+type StreamHandler struct {
+	Hub *stream.Hub
+}
+
+func (h *StreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	filter, err := streamFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err = rc.Flush(); err != nil {
+		logger.Log.Errorln(err)
+		return
+	}
+	sub := h.Hub.Subscribe(filter)
+	defer h.Hub.Cancel(sub)
+	ticker := time.NewTicker(streamPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		case m, ok := <-sub.C():
+			if !ok {
+				return
+			}
+			if dropped := sub.Dropped(); dropped > 0 {
+				_, err = fmt.Fprintf(w, "event: dropped\ndata: %d\n\n", dropped)
+				if err != nil {
+					return
+				}
+			}
+			var data []byte
+			data, err = json.Marshal(m)
+			if err != nil {
+				logger.Log.Errorln(err)
+				continue
+			}
+			_, err = fmt.Fprintf(w, "event: metric\ndata: %s\n\n", data)
+		}
+		if err != nil {
+			return
+		}
+		if err = rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// WebSocketHandler pushes accepted updates as JSON text messages. When the client
+// fell behind, a {"dropped": n} message precedes the next update.
+type WebSocketHandler struct {
+	Hub *stream.Hub
+}
+
+func (h *WebSocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Only GET requests are allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	filter, err := streamFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already answered the client
+		return
+	}
+	defer conn.Close()
+	sub := h.Hub.Subscribe(filter)
+	defer h.Hub.Cancel(sub)
+
+	// the read loop handles control frames and notices the client going away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+	ticker := time.NewTicker(streamPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteTimeout))
+		case m, ok := <-sub.C():
+			if !ok {
+				return
+			}
+			_ = conn.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+			if dropped := sub.Dropped(); dropped > 0 {
+				if err = conn.WriteJSON(map[string]uint64{"dropped": dropped}); err != nil {
+					return
+				}
+			}
+			err = conn.WriteJSON(m)
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-resty/resty/v2"
+	"github.com/gorilla/websocket"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/compress/gzip"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/hash"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/logger"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/serializer"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/storage"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newStreamServer(t *testing.T) (*httptest.Server, *stream.Hub) {
+	require.NoError(t, logger.Initialize("error"))
+	var gaugeStorage storage.MemStorage[internal.Gauge]
+	var counterStorage storage.MemStorage[internal.Counter]
+	gaugeStorage.Init()
+	counterStorage.Init()
+	hub := stream.NewHub(16)
+	updateMetricHandler := UpdateMetricHandler{
+		GaugeStorage:   &gaugeStorage,
+		CounterStorage: &counterStorage,
+		Hub:            hub,
+	}
+	r := chi.NewRouter()
+	r.Use(logger.RequestWithLogging, gzip.CompressRequestBody, hash.New("secret"))
+	r.Handle("/update/{metricType}/{metricName}/{metricValue}", &updateMetricHandler)
+	r.Handle("/updates", &JSONUpdateMetricsHandler{UpdateMetricHandler: updateMetricHandler})
+	r.Handle("/stream", &StreamHandler{Hub: hub})
+	r.Handle("/stream/ws", &WebSocketHandler{Hub: hub})
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv, hub
+}
+
+func TestStreamHandler(t *testing.T) {
+	srv, hub := newStreamServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/stream?type=counter&prefix=Poll&host=a", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	require.Eventually(t, func() bool { return hub.Len() == 1 }, time.Second, 10*time.Millisecond)
+
+	for _, url := range []string{"/update/gauge/PollRate/1?host=a", "/update/counter/PollCount/2?host=b", "/update/counter/PollCount/3?host=a"} {
+		_, err = resty.New().R().Post(srv.URL + url)
+		require.NoError(t, err)
+	}
+	_, err = resty.New().R().
+		SetBody([]serializer.Metrics{{ID: "PollCount", MType: "counter", Delta: new(internal.Counter), Labels: internal.Labels{"host": "a"}}}).
+		Post(srv.URL + "/updates")
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(resp.Body)
+	var events []string
+	for len(events) < 2 {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		if strings.HasPrefix(line, "data: ") {
+			events = append(events, strings.TrimSpace(strings.TrimPrefix(line, "data: ")))
+		}
+	}
+	assert.JSONEq(t, `{"id":"PollCount","type":"counter","delta":3,"labels":{"host":"a"}}`, events[0])
+	assert.JSONEq(t, `{"id":"PollCount","type":"counter","delta":3,"labels":{"host":"a"}}`, events[1])
+
+	cancel()
+	assert.Eventually(t, func() bool { return hub.Len() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestWebSocketHandler(t *testing.T) {
+	srv, hub := newStreamServer(t)
+	resp, err := resty.New().R().Get(srv.URL + "/stream/ws?name=[")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode())
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/stream/ws?name=*Alloc", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Eventually(t, func() bool { return hub.Len() == 1 }, time.Second, 10*time.Millisecond)
+
+	for _, url := range []string{"/update/gauge/PollRate/1", "/update/gauge/HeapAlloc/2.5"} {
+		_, err = resty.New().R().Post(srv.URL + url)
+		require.NoError(t, err)
+	}
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var m serializer.Metrics
+	require.NoError(t, conn.ReadJSON(&m))
+	assert.Equal(t, "HeapAlloc", m.ID)
+	assert.Equal(t, internal.Gauge(2.5), *m.Value)
+
+	require.NoError(t, conn.Close())
+	assert.Eventually(t, func() bool { return hub.Len() == 0 }, time.Second, 10*time.Millisecond)
+}
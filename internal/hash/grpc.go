@@ -0,0 +1,75 @@
+package hash
+
+import (
+	"context"
+	"crypto/hmac"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// metadataKey is the HashSHA256 header in lower case as gRPC metadata requires.
+const metadataKey = "hashsha256"
+
+// NewUnaryInterceptor is the gRPC counterpart of New: it checks the hash of requests
+// that carry one and signs responses.
+func NewUnaryInterceptor(key string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if key == "" {
+			return handler(ctx, req)
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get(metadataKey); len(values) > 0 {
+			hash, err := hashMessage(req, key)
+			if err != nil {
+				return nil, status.Error(codes.Internal, err.Error())
+			}
+			if !hmac.Equal([]byte(hash), []byte(values[0])) {
+				return nil, status.Error(codes.InvalidArgument, "hash mismatch")
+			}
+		}
+		resp, err := handler(ctx, req)
+		if err != nil {
+			return resp, err
+		}
+		hash, err := hashMessage(resp, key)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if err = grpc.SetHeader(ctx, metadata.Pairs(metadataKey, hash)); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+}
+
+// HashUnaryRequest is the gRPC counterpart of HashRequest.
+func HashUnaryRequest(key string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if key != "" {
+			hash, err := hashMessage(req, key)
+			if err != nil {
+				return err
+			}
+			ctx = metadata.AppendToOutgoingContext(ctx, metadataKey, hash)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// hashMessage signs the deterministic encoding of a message, so that both sides
+// agree on the bytes regardless of map order.
+func hashMessage(m any, key string) (string, error) {
+	message, ok := m.(proto.Message)
+	if !ok {
+		return "", status.Errorf(codes.Internal, "%T is not a protobuf message", m)
+	}
+	body, err := proto.MarshalOptions{Deterministic: true}.Marshal(message)
+	if err != nil {
+		return "", err
+	}
+	return hash(body, key)
+}
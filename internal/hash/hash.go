@@ -1,11 +1,14 @@
 package hash
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"io"
+	"net"
 	"net/http"
 
 	customHttp "github.com/krm-shrftdnv/go-musthave-metrics/internal/http"
@@ -42,6 +45,20 @@ func (h *hashWriter) WriteHeader(statusCode int) {
 	h.w.WriteHeader(statusCode)
 }
 
+func (h *hashWriter) Flush() {
+	if f, ok := h.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (h *hashWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := h.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	return hj.Hijack()
+}
+
 func New(key string) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		hashFunc := func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var DefaultHistogramBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram counts observations in buckets with upper Bounds.
+// Counts are per bucket, not cumulative, and the last one is the +Inf bucket.
+type Histogram struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Sum    float64   `json:"sum"`
+	Count  uint64    `json:"count"`
+}
+
+func NewHistogram(bounds []float64) Histogram {
+	return Histogram{
+		Bounds: append([]float64(nil), bounds...),
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+func (h Histogram) GetTypeName() MetricTypeName {
+	return HistogramName
+}
+
+func (h Histogram) String() string {
+	sb := strings.Builder{}
+	sb.WriteString("count=")
+	sb.WriteString(strconv.FormatUint(h.Count, 10))
+	sb.WriteString(" sum=")
+	sb.WriteString(strconv.FormatFloat(h.Sum, 'f', -1, 64))
+	var cumulative uint64
+	for i, count := range h.Counts {
+		cumulative += count
+		sb.WriteString(" le_")
+		if i < len(h.Bounds) {
+			sb.WriteString(strconv.FormatFloat(h.Bounds[i], 'f', -1, 64))
+		} else {
+			sb.WriteString("+Inf")
+		}
+		sb.WriteByte('=')
+		sb.WriteString(strconv.FormatUint(cumulative, 10))
+	}
+	return sb.String()
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.Bounds, v)
+	h.Counts[i]++
+	h.Sum += v
+	h.Count++
+}
+
+// Merge adds bucket counts of other; both histograms must have the same bounds.
+func (h *Histogram) Merge(other Histogram) error {
+	if len(h.Bounds) != len(other.Bounds) {
+		return errors.New("histogram bounds mismatch")
+	}
+	for i := range h.Bounds {
+		if h.Bounds[i] != other.Bounds[i] {
+			return errors.New("histogram bounds mismatch")
+		}
+	}
+	for i := range h.Counts {
+		h.Counts[i] += other.Counts[i]
+	}
+	h.Sum += other.Sum
+	h.Count += other.Count
+	return nil
+}
+
+func (h Histogram) Validate() error {
+	if len(h.Counts) != len(h.Bounds)+1 {
+		return fmt.Errorf("histogram should have %d counts for %d bounds", len(h.Bounds)+1, len(h.Bounds))
+	}
+	for i, bound := range h.Bounds {
+		if math.IsNaN(bound) || math.IsInf(bound, 0) {
+			return errors.New("histogram bounds should be finite")
+		}
+		if i > 0 && bound <= h.Bounds[i-1] {
+			return errors.New("histogram bounds should be sorted in increasing order")
+		}
+	}
+	var total uint64
+	for _, count := range h.Counts {
+		total += count
+	}
+	if total != h.Count {
+		return errors.New("histogram count should be equal to the sum of bucket counts")
+	}
+	return nil
+}
+
+func (h Histogram) Clone() Histogram {
+	return Histogram{
+		Bounds: append([]float64(nil), h.Bounds...),
+		Counts: append([]uint64(nil), h.Counts...),
+		Sum:    h.Sum,
+		Count:  h.Count,
+	}
+}
+
+func ParseBuckets(s string) ([]float64, error) {
+	var bounds []float64
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		bound, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket bound %q: %w", field, err)
+		}
+		bounds = append(bounds, bound)
+	}
+	if err := NewHistogram(bounds).Validate(); err != nil {
+		return nil, err
+	}
+	return bounds, nil
+}
@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogram_Observe(t *testing.T) {
+	h := NewHistogram([]float64{1, 5})
+	for _, v := range []float64{0.5, 1, 3, 10} {
+		h.Observe(v)
+	}
+	assert.Equal(t, []uint64{2, 1, 1}, h.Counts)
+	assert.Equal(t, uint64(4), h.Count)
+	assert.Equal(t, 14.5, h.Sum)
+	assert.NoError(t, h.Validate())
+	assert.Equal(t, "count=4 sum=14.5 le_1=2 le_5=3 le_+Inf=4", h.String())
+}
+
+func TestHistogram_Merge(t *testing.T) {
+	tests := []struct {
+		name    string
+		other   Histogram
+		want    []uint64
+		wantErr bool
+	}{
+		{
+			name:  "same bounds",
+			other: Histogram{Bounds: []float64{1, 5}, Counts: []uint64{1, 2, 3}, Sum: 20, Count: 6},
+			want:  []uint64{2, 2, 3},
+		},
+		{
+			name:    "different bounds",
+			other:   Histogram{Bounds: []float64{1, 10}, Counts: []uint64{1, 2, 3}, Sum: 20, Count: 6},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHistogram([]float64{1, 5})
+			h.Observe(0.5)
+			err := h.Merge(tt.other)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, h.Counts)
+		})
+	}
+}
+
+func TestHistogram_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		h       Histogram
+		wantErr bool
+	}{
+		{name: "valid", h: Histogram{Bounds: []float64{1}, Counts: []uint64{1, 1}, Count: 2}},
+		{name: "counts length", h: Histogram{Bounds: []float64{1}, Counts: []uint64{1}, Count: 1}, wantErr: true},
+		{name: "unsorted bounds", h: Histogram{Bounds: []float64{2, 1}, Counts: []uint64{0, 0, 0}}, wantErr: true},
+		{name: "count mismatch", h: Histogram{Bounds: []float64{1}, Counts: []uint64{1, 1}, Count: 3}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantErr {
+				assert.Error(t, tt.h.Validate())
+			} else {
+				assert.NoError(t, tt.h.Validate())
+			}
+		})
+	}
+}
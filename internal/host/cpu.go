@@ -0,0 +1,90 @@
+package host
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+)
+
+type cpuTimes struct {
+	idle  uint64
+	total uint64
+}
+
+type CPUCollector struct {
+	ProcPath string
+
+	mx   sync.Mutex
+	prev map[string]cpuTimes
+}
+
+func (c *CPUCollector) collect() (map[string]internal.Gauge, error) {
+	lines, err := readLines(procPath(c.ProcPath, "stat"))
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]cpuTimes)
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") || fields[0] == "cpu" {
+			continue
+		}
+		times, err := parseCPUTimes(fields[1:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", fields[0], err)
+		}
+		current[fields[0]] = times
+	}
+	if len(current) == 0 {
+		return nil, errors.New("no per-core cpu lines found")
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	metrics := make(map[string]internal.Gauge, len(current))
+	for name, cur := range current {
+		core, err := strconv.Atoi(strings.TrimPrefix(name, "cpu"))
+		if err != nil {
+			continue
+		}
+		var utilization float64
+		if prev, ok := c.prev[name]; ok && cur.total > prev.total {
+			total := cur.total - prev.total
+			// iowait may go down between reads, so idle isn't monotonic
+			var idle uint64
+			if cur.idle > prev.idle {
+				idle = cur.idle - prev.idle
+			}
+			utilization = 100 * (1 - float64(idle)/float64(total))
+			utilization = math.Max(0, math.Min(100, utilization))
+		}
+		metrics[fmt.Sprintf("CPUutilization%d", core+1)] = internal.Gauge(utilization)
+	}
+	c.prev = current
+	return metrics, nil
+}
+
+// parseCPUTimes sums jiffies of a /proc/stat cpu line; idle includes iowait.
+func parseCPUTimes(fields []string) (cpuTimes, error) {
+	var times cpuTimes
+	for i, field := range fields {
+		v, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return cpuTimes{}, err
+		}
+		// guest and guest_nice are already accounted in user and nice
+		if i >= 8 {
+			break
+		}
+		times.total += v
+		if i == 3 || i == 4 {
+			times.idle += v
+		}
+	}
+	return times, nil
+}
@@ -0,0 +1,34 @@
+//go:build linux
+
+package host
+
+import (
+	"syscall"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+)
+
+type DiskCollector struct {
+	Mounts []string
+}
+
+func (c *DiskCollector) collect() (map[string]internal.Gauge, error) {
+	metrics := make(map[string]internal.Gauge, 3*len(c.Mounts))
+	for _, mount := range c.Mounts {
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(mount, &st); err != nil {
+			return nil, err
+		}
+		total := st.Blocks * uint64(st.Bsize)
+		free := st.Bavail * uint64(st.Bsize)
+		var usedPercent float64
+		if total > 0 {
+			usedPercent = 100 * float64(total-st.Bfree*uint64(st.Bsize)) / float64(total)
+		}
+		suffix := sanitize(mount)
+		metrics["DiskTotalBytes_"+suffix] = internal.Gauge(total)
+		metrics["DiskFreeBytes_"+suffix] = internal.Gauge(free)
+		metrics["DiskUsedPercent_"+suffix] = internal.Gauge(usedPercent)
+	}
+	return metrics, nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package host
+
+import (
+	"errors"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+)
+
+type DiskCollector struct {
+	Mounts []string
+}
+
+func (c *DiskCollector) collect() (map[string]internal.Gauge, error) {
+	return nil, errors.New("disk collector is supported on linux only")
+}
@@ -0,0 +1,107 @@
+package host
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/collector"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/serializer"
+)
+
+const DefaultProcPath = "/proc"
+
+const (
+	CPUCollectorName     = "cpu"
+	MemoryCollectorName  = "mem"
+	LoadCollectorName    = "load"
+	NetworkCollectorName = "net"
+	DiskCollectorName    = "disk"
+)
+
+func procPath(root string, elem ...string) string {
+	if root == "" {
+		root = DefaultProcPath
+	}
+	return filepath.Join(append([]string{root}, elem...)...)
+}
+
+func readLines(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	return lines, scanner.Err()
+}
+
+func sanitize(s string) string {
+	s = strings.Trim(s, "/")
+	if s == "" {
+		return "root"
+	}
+	return strings.NewReplacer("/", "_", ".", "_", "-", "_", " ", "_").Replace(s)
+}
+
+type gaugeCollector interface {
+	collect() (map[string]internal.Gauge, error)
+}
+
+func collect(ctx context.Context, c gaugeCollector) ([]serializer.Metrics, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	values, err := c.collect()
+	if err != nil {
+		return nil, err
+	}
+	return collector.Gauges(values), nil
+}
+
+func (c *CPUCollector) Name() string {
+	return CPUCollectorName
+}
+
+func (c *CPUCollector) Collect(ctx context.Context) ([]serializer.Metrics, error) {
+	return collect(ctx, c)
+}
+
+func (c *MemoryCollector) Name() string {
+	return MemoryCollectorName
+}
+
+func (c *MemoryCollector) Collect(ctx context.Context) ([]serializer.Metrics, error) {
+	return collect(ctx, c)
+}
+
+func (c *LoadCollector) Name() string {
+	return LoadCollectorName
+}
+
+func (c *LoadCollector) Collect(ctx context.Context) ([]serializer.Metrics, error) {
+	return collect(ctx, c)
+}
+
+func (c *NetworkCollector) Name() string {
+	return NetworkCollectorName
+}
+
+func (c *NetworkCollector) Collect(ctx context.Context) ([]serializer.Metrics, error) {
+	return collect(ctx, c)
+}
+
+func (c *DiskCollector) Name() string {
+	return DiskCollectorName
+}
+
+func (c *DiskCollector) Collect(ctx context.Context) ([]serializer.Metrics, error) {
+	return collect(ctx, c)
+}
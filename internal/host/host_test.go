@@ -0,0 +1,124 @@
+package host
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeProcFile(t *testing.T, root string, name string, content string) {
+	path := filepath.Join(root, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestCPUCollector_Collect(t *testing.T) {
+	root := t.TempDir()
+	c := &CPUCollector{ProcPath: root}
+
+	writeProcFile(t, root, "stat", "cpu  200 0 200 1600 0 0 0 0 0 0\n"+
+		"cpu0 100 0 100 800 0 0 0 0 0 0\n"+
+		"cpu1 100 0 100 800 0 0 0 0 0 0\n"+
+		"intr 1 2 3\n")
+	metrics, err := c.collect()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]internal.Gauge{"CPUutilization1": 0, "CPUutilization2": 0}, metrics)
+
+	writeProcFile(t, root, "stat", "cpu  300 0 300 1800 0 0 0 0 0 0\n"+
+		"cpu0 150 0 150 900 0 0 0 0 0 0\n"+
+		"cpu1 100 0 100 900 0 0 0 0 0 0\n")
+	metrics, err = c.collect()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]internal.Gauge{"CPUutilization1": 50, "CPUutilization2": 0}, metrics)
+
+	// iowait dropped by more than idle grew, which used to wrap the idle delta
+	writeProcFile(t, root, "stat", "cpu  300 0 300 1800 0 0 0 0 0 0\n"+
+		"cpu0 150 0 150 900 40 0 0 0 0 0\n"+
+		"cpu1 100 0 100 900 0 0 0 0 0 0\n")
+	_, err = c.collect()
+	require.NoError(t, err)
+	writeProcFile(t, root, "stat", "cpu  300 0 300 1800 0 0 0 0 0 0\n"+
+		"cpu0 200 0 150 910 0 0 0 0 0 0\n"+
+		"cpu1 100 0 100 900 0 0 0 0 0 0\n")
+	metrics, err = c.collect()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]internal.Gauge{"CPUutilization1": 100, "CPUutilization2": 0}, metrics)
+}
+
+func TestMemoryCollector_Collect(t *testing.T) {
+	root := t.TempDir()
+	writeProcFile(t, root, "meminfo", "MemTotal:        2048 kB\n"+
+		"MemFree:         1024 kB\n"+
+		"MemAvailable:    1536 kB\n"+
+		"Dirty:             12 kB\n")
+	metrics, err := (&MemoryCollector{ProcPath: root}).collect()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]internal.Gauge{
+		"TotalMemory":     2048 * 1024,
+		"FreeMemory":      1024 * 1024,
+		"AvailableMemory": 1536 * 1024,
+	}, metrics)
+}
+
+func TestLoadCollector_Collect(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]internal.Gauge
+		wantErr bool
+	}{
+		{
+			name:    "success",
+			content: "0.20 0.37 0.21 2/71 13104\n",
+			want: map[string]internal.Gauge{
+				"LoadAverage1":  0.2,
+				"LoadAverage5":  0.37,
+				"LoadAverage15": 0.21,
+			},
+		},
+		{
+			name:    "malformed",
+			content: "0.20\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeProcFile(t, root, "loadavg", tt.content)
+			metrics, err := (&LoadCollector{ProcPath: root}).collect()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, metrics)
+		})
+	}
+}
+
+func TestNetworkCollector_Collect(t *testing.T) {
+	root := t.TempDir()
+	now := time.Unix(100, 0)
+	c := &NetworkCollector{ProcPath: root, now: func() time.Time { return now }}
+	header := "Inter-|   Receive                                                |  Transmit\n" +
+		" face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed\n"
+
+	writeProcFile(t, root, "net/dev", header+"  eth0: 1000 10 0 0 0 0 0 0 2000 20 0 0 0 0 0 0\n")
+	_, err := c.collect()
+	require.NoError(t, err)
+
+	now = now.Add(10 * time.Second)
+	writeProcFile(t, root, "net/dev", header+"  eth0: 6000 10 0 0 0 0 0 0 3000 20 0 0 0 0 0 0\n")
+	metrics, err := c.collect()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]internal.Gauge{
+		"NetRxBytesRate_eth0": 500,
+		"NetTxBytesRate_eth0": 100,
+	}, metrics)
+}
@@ -0,0 +1,36 @@
+package host
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+)
+
+var loadMetricNames = []string{"LoadAverage1", "LoadAverage5", "LoadAverage15"}
+
+type LoadCollector struct {
+	ProcPath string
+}
+
+func (c *LoadCollector) collect() (map[string]internal.Gauge, error) {
+	content, err := os.ReadFile(procPath(c.ProcPath, "loadavg"))
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) < len(loadMetricNames) {
+		return nil, fmt.Errorf("unexpected loadavg format: %q", content)
+	}
+	metrics := make(map[string]internal.Gauge, len(loadMetricNames))
+	for i, name := range loadMetricNames {
+		v, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return nil, err
+		}
+		metrics[name] = internal.Gauge(v)
+	}
+	return metrics, nil
+}
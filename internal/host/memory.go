@@ -0,0 +1,53 @@
+package host
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+)
+
+var meminfoMetrics = map[string]string{
+	"MemTotal":     "TotalMemory",
+	"MemFree":      "FreeMemory",
+	"MemAvailable": "AvailableMemory",
+	"Buffers":      "BuffersMemory",
+	"Cached":       "CachedMemory",
+	"SwapTotal":    "TotalSwap",
+	"SwapFree":     "FreeSwap",
+}
+
+type MemoryCollector struct {
+	ProcPath string
+}
+
+func (c *MemoryCollector) collect() (map[string]internal.Gauge, error) {
+	lines, err := readLines(procPath(c.ProcPath, "meminfo"))
+	if err != nil {
+		return nil, err
+	}
+	metrics := make(map[string]internal.Gauge, len(meminfoMetrics))
+	for _, line := range lines {
+		key, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name, ok := meminfoMetrics[key]
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			v *= 1024
+		}
+		metrics[name] = internal.Gauge(v)
+	}
+	return metrics, nil
+}
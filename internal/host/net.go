@@ -0,0 +1,78 @@
+package host
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+)
+
+type netBytes struct {
+	rx uint64
+	tx uint64
+}
+
+type NetworkCollector struct {
+	ProcPath string
+
+	mx       sync.Mutex
+	prev     map[string]netBytes
+	prevTime time.Time
+	now      func() time.Time
+}
+
+func (c *NetworkCollector) collect() (map[string]internal.Gauge, error) {
+	lines, err := readLines(procPath(c.ProcPath, "net", "dev"))
+	if err != nil {
+		return nil, err
+	}
+	current := make(map[string]netBytes)
+	for _, line := range lines {
+		iface, rest, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		iface = strings.TrimSpace(iface)
+		fields := strings.Fields(rest)
+		if len(fields) < 9 {
+			return nil, fmt.Errorf("unexpected net/dev format for %s", iface)
+		}
+		rx, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		tx, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		current[iface] = netBytes{rx: rx, tx: tx}
+	}
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	now := time.Now()
+	if c.now != nil {
+		now = c.now()
+	}
+	elapsed := now.Sub(c.prevTime).Seconds()
+	metrics := make(map[string]internal.Gauge, 2*len(current))
+	for iface, cur := range current {
+		var rxRate, txRate float64
+		if prev, ok := c.prev[iface]; ok && elapsed > 0 {
+			if cur.rx >= prev.rx {
+				rxRate = float64(cur.rx-prev.rx) / elapsed
+			}
+			if cur.tx >= prev.tx {
+				txRate = float64(cur.tx-prev.tx) / elapsed
+			}
+		}
+		metrics["NetRxBytesRate_"+sanitize(iface)] = internal.Gauge(rxRate)
+		metrics["NetTxBytesRate_"+sanitize(iface)] = internal.Gauge(txRate)
+	}
+	c.prev = current
+	c.prevTime = now
+	return metrics, nil
+}
@@ -0,0 +1,147 @@
+package internal
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Labels map[string]string
+
+// escaped are the characters of metric and label names that SeriesKey prefixes
+// with a backslash, so any name reads back from the key.
+const escaped = `\{}=,`
+
+// SeriesKey identifies a series by metric name and sorted label set,
+// e.g. Alloc{env="prod",host="a"}. A metric without labels is keyed by its name.
+// Labels with an empty name are left out.
+func SeriesKey(name string, labels Labels) string {
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		if k != "" {
+			names = append(names, k)
+		}
+	}
+	if len(names) == 0 {
+		return escape(name)
+	}
+	sort.Strings(names)
+	sb := strings.Builder{}
+	sb.WriteString(escape(name))
+	sb.WriteByte('{')
+	for i, k := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(escape(k))
+		sb.WriteByte('=')
+		sb.WriteString(strconv.Quote(labels[k]))
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+// ParseSeriesKey is the reverse of SeriesKey.
+func ParseSeriesKey(key string) (string, Labels, error) {
+	name, start := unescapeUntil(key, '{')
+	if start == len(key) {
+		return name, nil, nil
+	}
+	if !strings.HasSuffix(key, "}") {
+		return "", nil, errors.New("malformed series key: missing closing brace")
+	}
+	rest := key[start+1 : len(key)-1]
+	labels := make(Labels)
+	for rest != "" {
+		labelName, eq := unescapeUntil(rest, '=')
+		if labelName == "" || eq == len(rest) {
+			return "", nil, errors.New("malformed series key: missing label name")
+		}
+		quoted, err := strconv.QuotedPrefix(rest[eq+1:])
+		if err != nil {
+			return "", nil, errors.New("malformed series key: bad label value")
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return "", nil, err
+		}
+		labels[labelName] = value
+		rest = strings.TrimPrefix(rest[eq+1+len(quoted):], ",")
+	}
+	return name, labels, nil
+}
+
+func escape(s string) string {
+	if !strings.ContainsAny(s, escaped) {
+		return s
+	}
+	sb := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(escaped, s[i]) >= 0 {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+// unescapeUntil reads s up to the first unescaped stop byte and returns the
+// unescaped text and the index of the stop byte, or len(s) without one.
+// A backslash before other characters is kept, as in keys stored before escaping.
+func unescapeUntil(s string, stop byte) (string, int) {
+	if !strings.Contains(s, `\`) {
+		if i := strings.IndexByte(s, stop); i >= 0 {
+			return s[:i], i
+		}
+		return s, len(s)
+	}
+	sb := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s) && strings.IndexByte(escaped, s[i+1]) >= 0:
+			i++
+			sb.WriteByte(s[i])
+		case s[i] == stop:
+			return sb.String(), i
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String(), len(s)
+}
+
+// Match reports whether labels contain every pair of the filter.
+func (l Labels) Match(filter Labels) bool {
+	for k, v := range filter {
+		if value, ok := l[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
+
+func (l Labels) Merge(other Labels) Labels {
+	if len(other) == 0 {
+		return l
+	}
+	merged := make(Labels, len(l)+len(other))
+	for k, v := range l {
+		merged[k] = v
+	}
+	for k, v := range other {
+		merged[k] = v
+	}
+	return merged
+}
+
+// Without returns labels except the pairs present in other.
+func (l Labels) Without(other Labels) Labels {
+	result := make(Labels, len(l))
+	for k, v := range l {
+		if value, ok := other[k]; !ok || value != v {
+			result[k] = v
+		}
+	}
+	return result
+}
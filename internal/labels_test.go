@@ -0,0 +1,79 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeriesKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		metricName string
+		labels     Labels
+		want       string
+	}{
+		{name: "no labels", metricName: "Alloc", want: "Alloc"},
+		{name: "empty labels", metricName: "Alloc", labels: Labels{}, want: "Alloc"},
+		{
+			name:       "sorted labels",
+			metricName: "Alloc",
+			labels:     Labels{"host": "a", "env": "prod"},
+			want:       `Alloc{env="prod",host="a"}`,
+		},
+		{
+			name:       "escaped value",
+			metricName: "Alloc",
+			labels:     Labels{"path": `C:\"x",y`},
+			want:       `Alloc{path="C:\\\"x\",y"}`,
+		},
+		{name: "braces in name", metricName: `Alloc{host="db1"}`, want: `Alloc\{host\="db1"\}`},
+		{
+			name:       "separators in label name",
+			metricName: `C:\Alloc`,
+			labels:     Labels{"a=b,c}": "1", "d{": "2"},
+			want:       `C:\\Alloc{a\=b\,c\}="1",d\{="2"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := SeriesKey(tt.metricName, tt.labels)
+			assert.Equal(t, tt.want, key)
+
+			name, labels, err := ParseSeriesKey(key)
+			require.NoError(t, err)
+			assert.Equal(t, tt.metricName, name)
+			if len(tt.labels) == 0 {
+				assert.Empty(t, labels)
+			} else {
+				assert.Equal(t, tt.labels, labels)
+			}
+		})
+	}
+}
+
+func TestSeriesKey_distinct(t *testing.T) {
+	assert.NotEqual(t, SeriesKey(`Alloc{host="db1"}`, nil), SeriesKey("Alloc", Labels{"host": "db1"}))
+	assert.Equal(t, "Alloc", SeriesKey("Alloc", Labels{"": "x"}))
+
+	// keys stored before escaping keep their backslashes
+	name, _, err := ParseSeriesKey(`C:\Alloc`)
+	require.NoError(t, err)
+	assert.Equal(t, `C:\Alloc`, name)
+}
+
+func TestParseSeriesKey_malformed(t *testing.T) {
+	for _, key := range []string{`Alloc{host="a"`, `Alloc{host=a}`, `Alloc{="a"}`} {
+		_, _, err := ParseSeriesKey(key)
+		assert.Error(t, err, key)
+	}
+}
+
+func TestLabels_Match(t *testing.T) {
+	labels := Labels{"host": "a", "env": "prod"}
+	assert.True(t, labels.Match(nil))
+	assert.True(t, labels.Match(Labels{"host": "a"}))
+	assert.False(t, labels.Match(Labels{"host": "b"}))
+	assert.False(t, labels.Match(Labels{"service": "x"}))
+}
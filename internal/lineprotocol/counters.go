@@ -0,0 +1,49 @@
+package lineprotocol
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Counters selects the numeric fields kept as counter totals, those whose key, or
+// measurement for a value field, has the _total suffix and those whose metric name
+// matches one of the patterns. Other fields are gauges, since line protocol doesn't
+// tell a total from a level.
+type Counters []string
+
+// ParseCounters reads comma-separated metric name patterns like "net_bytes_*".
+func ParseCounters(s string) (Counters, error) {
+	var counters Counters
+	for _, pattern := range strings.Split(s, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid counter pattern %q: %w", pattern, err)
+		}
+		counters = append(counters, pattern)
+	}
+	return counters, nil
+}
+
+func (c Counters) Match(p Point, f Field) bool {
+	if f.Kind == Boolean || f.Kind == String {
+		return false
+	}
+	key := f.Key
+	if key == "value" {
+		key = p.Measurement
+	}
+	if strings.HasSuffix(key, "_total") {
+		return true
+	}
+	name := p.FieldName(f)
+	for _, pattern := range c {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
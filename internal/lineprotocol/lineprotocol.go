@@ -0,0 +1,240 @@
+// Package lineprotocol parses the InfluxDB line protocol.
+package lineprotocol
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+)
+
+type Kind int
+
+const (
+	Float Kind = iota
+	Integer
+	Unsigned
+	Boolean
+	String
+)
+
+// Field is a field value; numbers and booleans are kept in Value, strings in Str.
+type Field struct {
+	Key   string
+	Kind  Kind
+	Value float64
+	Str   string
+}
+
+type Point struct {
+	Measurement string
+	Tags        internal.Labels
+	Fields      []Field
+	// Time is zero when the line has no timestamp
+	Time time.Time
+}
+
+// FieldName names the metric of a field measurement_field, or just measurement
+// for a field called value.
+func (p Point) FieldName(f Field) string {
+	if f.Key == "value" {
+		return p.Measurement
+	}
+	return p.Measurement + "_" + f.Key
+}
+
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// ParsePrecision maps the precision query parameter to a timestamp unit.
+func ParsePrecision(s string) (time.Duration, error) {
+	switch s {
+	case "", "ns", "n":
+		return time.Nanosecond, nil
+	case "us", "u":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	default:
+		return 0, fmt.Errorf("unknown precision %q", s)
+	}
+}
+
+// Parse parses every line of r, skipping blank lines and comments. Lines that
+// fail to parse are reported as *LineError and don't stop parsing.
+func Parse(r io.Reader, precision time.Duration) ([]Point, []error) {
+	var points []Point
+	var errs []error
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	n := 0
+	for scanner.Scan() {
+		n++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		point, err := ParseLine(line, precision)
+		if err != nil {
+			errs = append(errs, &LineError{Line: n, Err: err})
+			continue
+		}
+		points = append(points, point)
+	}
+	if err := scanner.Err(); err != nil {
+		errs = append(errs, &LineError{Line: n + 1, Err: err})
+	}
+	return points, errs
+}
+
+func ParseLine(line string, precision time.Duration) (Point, error) {
+	var p Point
+	measurement, i := scan(line, 0, ", ", false)
+	if measurement == "" {
+		return p, errors.New("missing measurement")
+	}
+	p.Measurement = unescape(measurement)
+	p.Tags = make(internal.Labels)
+	for i < len(line) && line[i] == ',' {
+		var tag string
+		tag, i = scan(line, i+1, ", ", false)
+		key, value, ok := cutUnescaped(tag, '=')
+		if !ok || key == "" || value == "" {
+			return p, fmt.Errorf("invalid tag %q", tag)
+		}
+		p.Tags[unescape(key)] = unescape(value)
+	}
+	if i >= len(line) {
+		return p, errors.New("missing fields")
+	}
+	i = skipSpaces(line, i)
+	for {
+		var field string
+		field, i = scan(line, i, ", ", true)
+		f, err := parseField(field)
+		if err != nil {
+			return p, err
+		}
+		p.Fields = append(p.Fields, f)
+		if i >= len(line) || line[i] != ',' {
+			break
+		}
+		i++
+	}
+	i = skipSpaces(line, i)
+	if i < len(line) {
+		ts, err := strconv.ParseInt(line[i:], 10, 64)
+		if err != nil {
+			return p, fmt.Errorf("invalid timestamp %q", line[i:])
+		}
+		p.Time = time.Unix(0, ts*int64(precision))
+	}
+	return p, nil
+}
+
+func parseField(field string) (Field, error) {
+	key, value, ok := cutUnescaped(field, '=')
+	if !ok || key == "" || value == "" {
+		return Field{}, fmt.Errorf("invalid field %q", field)
+	}
+	f := Field{Key: unescape(key)}
+	switch last := value[len(value)-1]; {
+	case value[0] == '"':
+		if len(value) < 2 || last != '"' {
+			return f, fmt.Errorf("unterminated string in field %q", f.Key)
+		}
+		f.Kind = String
+		f.Str = strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(value[1 : len(value)-1])
+	case last == 'i':
+		v, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+		if err != nil {
+			return f, fmt.Errorf("invalid integer %q in field %q", value, f.Key)
+		}
+		f.Kind, f.Value = Integer, float64(v)
+	case last == 'u':
+		v, err := strconv.ParseUint(value[:len(value)-1], 10, 64)
+		if err != nil {
+			return f, fmt.Errorf("invalid unsigned integer %q in field %q", value, f.Key)
+		}
+		f.Kind, f.Value = Unsigned, float64(v)
+	default:
+		switch value {
+		case "t", "T", "true", "True", "TRUE":
+			f.Kind, f.Value = Boolean, 1
+			return f, nil
+		case "f", "F", "false", "False", "FALSE":
+			f.Kind, f.Value = Boolean, 0
+			return f, nil
+		}
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return f, fmt.Errorf("invalid value %q in field %q", value, f.Key)
+		}
+		f.Kind, f.Value = Float, v
+	}
+	return f, nil
+}
+
+// scan returns the token starting at i up to an unescaped stop character.
+// With quotes set, stop characters inside double quotes don't end the token.
+func scan(line string, i int, stops string, quotes bool) (string, int) {
+	start := i
+	inQuotes := false
+	for ; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == '\\' && i+1 < len(line):
+			i++
+		case quotes && c == '"':
+			inQuotes = !inQuotes
+		case !inQuotes && strings.IndexByte(stops, c) >= 0:
+			return line[start:i], i
+		}
+	}
+	return line[start:], i
+}
+
+func cutUnescaped(s string, sep byte) (string, string, bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+func skipSpaces(line string, i int) int {
+	for i < len(line) && line[i] == ' ' {
+		i++
+	}
+	return i
+}
+
+var unescaper = strings.NewReplacer(`\,`, ",", `\ `, " ", `\=`, "=", `\\`, `\`)
+
+func unescape(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	return unescaper.Replace(s)
+}
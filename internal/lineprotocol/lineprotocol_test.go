@@ -0,0 +1,111 @@
+package lineprotocol
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Point
+		wantErr bool
+	}{
+		{
+			name: "tags, fields and timestamp",
+			line: `cpu,host=a,region=eu usage_idle=98.5,usage_user=1.2 1700000000000000000`,
+			want: Point{
+				Measurement: "cpu",
+				Tags:        internal.Labels{"host": "a", "region": "eu"},
+				Fields:      []Field{{Key: "usage_idle", Value: 98.5}, {Key: "usage_user", Value: 1.2}},
+				Time:        time.Unix(1700000000, 0),
+			},
+		},
+		{
+			name: "field types",
+			line: `net bytes_recv=42i,drops=7u,up=true,iface="eth0, \"main\""`,
+			want: Point{
+				Measurement: "net",
+				Tags:        internal.Labels{},
+				Fields: []Field{
+					{Key: "bytes_recv", Kind: Integer, Value: 42},
+					{Key: "drops", Kind: Unsigned, Value: 7},
+					{Key: "up", Kind: Boolean, Value: 1},
+					{Key: "iface", Kind: String, Str: `eth0, "main"`},
+				},
+			},
+		},
+		{
+			name: "escapes",
+			line: `disk\ io,path=/mnt/my\ disk,dev\=x=sda free\ bytes=1e9`,
+			want: Point{
+				Measurement: "disk io",
+				Tags:        internal.Labels{"path": "/mnt/my disk", "dev=x": "sda"},
+				Fields:      []Field{{Key: "free bytes", Value: 1e9}},
+			},
+		},
+		{name: "missing fields", line: `cpu,host=a`, wantErr: true},
+		{name: "bad tag", line: `cpu,host usage=1`, wantErr: true},
+		{name: "bad integer", line: `cpu usage=1.5i`, wantErr: true},
+		{name: "bad value", line: `cpu usage=high`, wantErr: true},
+		{name: "unterminated string", line: `cpu state="idle`, wantErr: true},
+		{name: "bad timestamp", line: `cpu usage=1 yesterday`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseLine(tt.line, time.Nanosecond)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	body := "# comment\ncpu usage=1 1700000000\n\ncpu usage=oops\nmem used=2i\n"
+	points, errs := Parse(strings.NewReader(body), time.Second)
+	require.Len(t, points, 2)
+	assert.Equal(t, time.Unix(1700000000, 0), points[0].Time)
+	require.Len(t, errs, 1)
+	var lineErr *LineError
+	require.True(t, errors.As(errs[0], &lineErr))
+	assert.Equal(t, 4, lineErr.Line)
+	assert.Equal(t, `line 4: invalid value "oops" in field "usage"`, errs[0].Error())
+}
+
+func TestCounters(t *testing.T) {
+	counters, err := ParseCounters("net_bytes_*, disk_io_*")
+	require.NoError(t, err)
+	assert.Equal(t, Counters{"net_bytes_*", "disk_io_*"}, counters)
+	_, err = ParseCounters("net_[")
+	assert.Error(t, err)
+
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{line: "mem total=8i", want: false},
+		{line: "disk used=1i", want: false},
+		{line: "http requests_total=3i", want: true},
+		{line: "requests_total value=3", want: true},
+		{line: "net bytes_recv=100u", want: true},
+		{line: "net up_total=true", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			p, err := ParseLine(tt.line, time.Nanosecond)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, counters.Match(p, p.Fields[0]))
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package logger
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryWithLogging is the gRPC counterpart of RequestWithLogging.
+func UnaryWithLogging(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	duration := time.Since(start)
+
+	Log.Infow(
+		"Request",
+		"method", info.FullMethod,
+		"request", req,
+		"status", status.Code(err).String(),
+		"duration", duration,
+	)
+	return resp, err
+}
+
+func StreamWithLogging(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	duration := time.Since(start)
+
+	Log.Infow(
+		"Request",
+		"method", info.FullMethod,
+		"status", status.Code(err).String(),
+		"duration", duration,
+	)
+	return err
+}
@@ -8,14 +8,17 @@ import (
 type MetricTypeName string
 
 const (
-	GaugeName   MetricTypeName = "gauge"
-	CounterName MetricTypeName = "counter"
+	GaugeName     MetricTypeName = "gauge"
+	CounterName   MetricTypeName = "counter"
+	HistogramName MetricTypeName = "histogram"
+	SummaryName   MetricTypeName = "summary"
+	SetName       MetricTypeName = "set"
 )
 
 type Gauge float64
 type Counter int64
 type MetricType interface {
-	Gauge | Counter
+	Gauge | Counter | Histogram | Summary | Set
 	GetTypeName() MetricTypeName
 	String() string
 }
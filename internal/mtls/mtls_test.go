@@ -0,0 +1,135 @@
+package mtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	// certFile and keyFile are PEM files in a temp dir
+	certFile string
+	keyFile  string
+}
+
+// newCert issues a certificate for cn signed by parent, or a self-signed CA when parent is nil.
+func newCert(t *testing.T, cn string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	issuer, signer := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		issuer, signer = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, &key.PublicKey, signer)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	c := &testCert{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, "cert.pem"),
+		keyFile:  filepath.Join(dir, "key.pem"),
+	}
+	require.NoError(t, os.WriteFile(c.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	require.NoError(t, os.WriteFile(c.keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600))
+	return c
+}
+
+func TestIdentify(t *testing.T) {
+	ca := newCert(t, "ca", nil)
+	otherCA := newCert(t, "other ca", nil)
+	serverCert := newCert(t, "server", ca)
+	agentCert := newCert(t, "agent-1", ca)
+	strangerCert := newCert(t, "stranger", otherCA)
+
+	echoSource := func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, Source(r.Context()))
+	}
+	tests := []struct {
+		name       string
+		clientCA   string
+		clientCert *testCert
+		wantErr    bool
+		source     string
+	}{
+		{name: "tls", source: ""},
+		{name: "tls with client certificate", clientCert: agentCert, source: ""},
+		{name: "mtls", clientCA: ca.certFile, clientCert: agentCert, source: "agent-1"},
+		{name: "mtls without client certificate", clientCA: ca.certFile, wantErr: true},
+		{name: "mtls with untrusted client certificate", clientCA: ca.certFile, clientCert: strangerCert, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverConfig, err := ServerConfig(serverCert.certFile, serverCert.keyFile, tt.clientCA)
+			require.NoError(t, err)
+			srv := httptest.NewUnstartedServer(Identify(http.HandlerFunc(echoSource)))
+			srv.TLS = serverConfig
+			srv.StartTLS()
+			defer srv.Close()
+
+			var certFile, keyFile string
+			if tt.clientCert != nil {
+				certFile, keyFile = tt.clientCert.certFile, tt.clientCert.keyFile
+			}
+			clientConfig, err := ClientConfig(ca.certFile, certFile, keyFile)
+			require.NoError(t, err)
+			client := http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+			resp, err := client.Get(srv.URL)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, tt.source, string(body))
+		})
+	}
+}
+
+func TestConfig_errors(t *testing.T) {
+	ca := newCert(t, "ca", nil)
+	_, err := ServerConfig("", "", "")
+	assert.Error(t, err)
+	_, err = ServerConfig(ca.certFile, ca.keyFile, ca.keyFile)
+	assert.ErrorContains(t, err, "no certificates found")
+	_, err = ClientConfig(filepath.Join(t.TempDir(), "missing.pem"), "", "")
+	assert.Error(t, err)
+	_, err = ClientConfig("", ca.certFile, "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,243 @@
+// Package otlp decodes OTLP metrics export requests into data points.
+package otlp
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"strconv"
+	"time"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+var ErrUnsupportedContentType = errors.New("content type should be application/x-protobuf or application/json")
+
+type Format int
+
+const (
+	Protobuf Format = iota
+	JSON
+)
+
+// ParseContentType returns the format of a request body, protobuf when the type is missing.
+func ParseContentType(contentType string) (Format, error) {
+	if contentType == "" {
+		return Protobuf, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return 0, ErrUnsupportedContentType
+	}
+	switch mediaType {
+	case "application/x-protobuf", "application/protobuf":
+		return Protobuf, nil
+	case "application/json":
+		return JSON, nil
+	default:
+		return 0, ErrUnsupportedContentType
+	}
+}
+
+func (f Format) ContentType() string {
+	if f == JSON {
+		return "application/json"
+	}
+	return "application/x-protobuf"
+}
+
+type Kind int
+
+const (
+	Gauge Kind = iota
+	Sum
+	Histogram
+)
+
+// Point is a data point of a gauge, sum or histogram labelled with the attributes
+// of its resource and its own, which take precedence.
+type Point struct {
+	Name   string
+	Labels internal.Labels
+	Kind   Kind
+	// Cumulative is false for sums and histograms with delta temporality
+	Cumulative bool
+	// Monotonic is set for sums that never decrease, i.e. counters
+	Monotonic bool
+	Value     float64
+	Histogram internal.Histogram
+	// Time is zero when the point has no timestamp
+	Time time.Time
+}
+
+func Unmarshal(data []byte, format Format) (*colmetricspb.ExportMetricsServiceRequest, error) {
+	req := &colmetricspb.ExportMetricsServiceRequest{}
+	var err error
+	if format == JSON {
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, req)
+	} else {
+		err = proto.Unmarshal(data, req)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse request: %w", err)
+	}
+	return req, nil
+}
+
+// MarshalResponse reports data points rejected with errs as a partial success.
+func MarshalResponse(errs []error, format Format) ([]byte, error) {
+	resp := &colmetricspb.ExportMetricsServiceResponse{}
+	if len(errs) > 0 {
+		message := errs[0].Error()
+		if len(errs) > 1 {
+			message += fmt.Sprintf(" (and %d more)", len(errs)-1)
+		}
+		resp.PartialSuccess = &colmetricspb.ExportMetricsPartialSuccess{
+			RejectedDataPoints: int64(len(errs)),
+			ErrorMessage:       message,
+		}
+	}
+	if format == JSON {
+		return protojson.Marshal(resp)
+	}
+	return proto.Marshal(resp)
+}
+
+// Points flattens a request into data points. Each data point that can't be converted,
+// including those of exponential histograms and summaries, yields an error instead.
+// Data points flagged as having no recorded value are skipped.
+func Points(req *colmetricspb.ExportMetricsServiceRequest) ([]Point, []error) {
+	var points []Point
+	var errs []error
+	for _, rm := range req.GetResourceMetrics() {
+		resource := attributeLabels(rm.GetResource().GetAttributes())
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				if m.GetName() == "" {
+					errs = append(errs, errors.New("metric name is required"))
+					continue
+				}
+				switch data := m.GetData().(type) {
+				case *metricspb.Metric_Gauge:
+					for _, dp := range data.Gauge.GetDataPoints() {
+						if noRecordedValue(dp.GetFlags()) {
+							continue
+						}
+						points = append(points, numberPoint(m.GetName(), resource, Gauge, dp))
+					}
+				case *metricspb.Metric_Sum:
+					for _, dp := range data.Sum.GetDataPoints() {
+						if noRecordedValue(dp.GetFlags()) {
+							continue
+						}
+						p := numberPoint(m.GetName(), resource, Sum, dp)
+						p.Cumulative = data.Sum.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+						p.Monotonic = data.Sum.GetIsMonotonic()
+						points = append(points, p)
+					}
+				case *metricspb.Metric_Histogram:
+					cumulative := data.Histogram.GetAggregationTemporality() == metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+					for _, dp := range data.Histogram.GetDataPoints() {
+						if noRecordedValue(dp.GetFlags()) {
+							continue
+						}
+						p, err := histogramPoint(m.GetName(), resource, dp)
+						if err != nil {
+							errs = append(errs, err)
+							continue
+						}
+						p.Cumulative = cumulative
+						points = append(points, p)
+					}
+				case *metricspb.Metric_ExponentialHistogram:
+					for range data.ExponentialHistogram.GetDataPoints() {
+						errs = append(errs, fmt.Errorf("%s: exponential histograms are not supported", m.GetName()))
+					}
+				case *metricspb.Metric_Summary:
+					for range data.Summary.GetDataPoints() {
+						errs = append(errs, fmt.Errorf("%s: summaries are not supported", m.GetName()))
+					}
+				default:
+					errs = append(errs, fmt.Errorf("%s: metric has no data", m.GetName()))
+				}
+			}
+		}
+	}
+	return points, errs
+}
+
+func numberPoint(name string, resource internal.Labels, kind Kind, dp *metricspb.NumberDataPoint) Point {
+	p := Point{
+		Name:   name,
+		Labels: resource.Merge(attributeLabels(dp.GetAttributes())),
+		Kind:   kind,
+		Time:   unixNano(dp.GetTimeUnixNano()),
+	}
+	switch value := dp.GetValue().(type) {
+	case *metricspb.NumberDataPoint_AsInt:
+		p.Value = float64(value.AsInt)
+	case *metricspb.NumberDataPoint_AsDouble:
+		p.Value = value.AsDouble
+	}
+	return p
+}
+
+func histogramPoint(name string, resource internal.Labels, dp *metricspb.HistogramDataPoint) (Point, error) {
+	histogram := internal.Histogram{
+		Bounds: append([]float64(nil), dp.GetExplicitBounds()...),
+		Counts: append([]uint64(nil), dp.GetBucketCounts()...),
+		Sum:    dp.GetSum(),
+		Count:  dp.GetCount(),
+	}
+	if len(histogram.Counts) == 0 && len(histogram.Bounds) == 0 {
+		// a histogram without buckets still carries its count and sum
+		histogram.Counts = []uint64{dp.GetCount()}
+	}
+	if err := histogram.Validate(); err != nil {
+		return Point{}, fmt.Errorf("%s: %w", name, err)
+	}
+	return Point{
+		Name:      name,
+		Labels:    resource.Merge(attributeLabels(dp.GetAttributes())),
+		Kind:      Histogram,
+		Histogram: histogram,
+		Time:      unixNano(dp.GetTimeUnixNano()),
+	}, nil
+}
+
+func noRecordedValue(flags uint32) bool {
+	return flags&uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK) != 0
+}
+
+func unixNano(ns uint64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(ns))
+}
+
+// attributeLabels converts scalar attributes to labels; arrays and maps are skipped.
+func attributeLabels(attrs []*commonpb.KeyValue) internal.Labels {
+	labels := make(internal.Labels, len(attrs))
+	for _, attr := range attrs {
+		switch value := attr.GetValue().GetValue().(type) {
+		case *commonpb.AnyValue_StringValue:
+			labels[attr.GetKey()] = value.StringValue
+		case *commonpb.AnyValue_BoolValue:
+			labels[attr.GetKey()] = strconv.FormatBool(value.BoolValue)
+		case *commonpb.AnyValue_IntValue:
+			labels[attr.GetKey()] = strconv.FormatInt(value.IntValue, 10)
+		case *commonpb.AnyValue_DoubleValue:
+			labels[attr.GetKey()] = strconv.FormatFloat(value.DoubleValue, 'f', -1, 64)
+		case *commonpb.AnyValue_BytesValue:
+			labels[attr.GetKey()] = base64.StdEncoding.EncodeToString(value.BytesValue)
+		}
+	}
+	return labels
+}
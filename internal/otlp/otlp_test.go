@@ -0,0 +1,130 @@
+package otlp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func stringAttr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func TestParseContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        Format
+		wantErr     bool
+	}{
+		{contentType: "", want: Protobuf},
+		{contentType: "application/x-protobuf", want: Protobuf},
+		{contentType: "application/json; charset=utf-8", want: JSON},
+		{contentType: "text/plain", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			got, err := ParseContentType(tt.contentType)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrUnsupportedContentType)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPoints(t *testing.T) {
+	sum := 0.6
+	req := &colmetricspb.ExportMetricsServiceRequest{
+		ResourceMetrics: []*metricspb.ResourceMetrics{{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{stringAttr("service.name", "checkout"), stringAttr("host", "a")}},
+			ScopeMetrics: []*metricspb.ScopeMetrics{{
+				Metrics: []*metricspb.Metric{
+					{
+						Name: "requests",
+						Data: &metricspb.Metric_Sum{Sum: &metricspb.Sum{
+							AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+							IsMonotonic:            true,
+							DataPoints: []*metricspb.NumberDataPoint{
+								{
+									Attributes:   []*commonpb.KeyValue{stringAttr("host", "b")},
+									TimeUnixNano: 1700000000000000000,
+									Value:        &metricspb.NumberDataPoint_AsInt{AsInt: 10},
+								},
+								{Flags: uint32(metricspb.DataPointFlags_DATA_POINT_FLAGS_NO_RECORDED_VALUE_MASK)},
+							},
+						}},
+					},
+					{
+						Name: "temperature",
+						Data: &metricspb.Metric_Gauge{Gauge: &metricspb.Gauge{DataPoints: []*metricspb.NumberDataPoint{
+							{Value: &metricspb.NumberDataPoint_AsDouble{AsDouble: 21.5}},
+						}}},
+					},
+					{
+						Name: "latency",
+						Data: &metricspb.Metric_Histogram{Histogram: &metricspb.Histogram{
+							AggregationTemporality: metricspb.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+							DataPoints: []*metricspb.HistogramDataPoint{
+								{Count: 3, Sum: &sum, BucketCounts: []uint64{1, 2, 0}, ExplicitBounds: []float64{0.1, 0.5}},
+								{Count: 3, BucketCounts: []uint64{1, 2}, ExplicitBounds: []float64{0.1, 0.5}},
+							},
+						}},
+					},
+					{
+						Name: "sizes",
+						Data: &metricspb.Metric_ExponentialHistogram{ExponentialHistogram: &metricspb.ExponentialHistogram{
+							DataPoints: []*metricspb.ExponentialHistogramDataPoint{{Count: 1}},
+						}},
+					},
+				},
+			}},
+		}},
+	}
+	data, err := proto.Marshal(req)
+	require.NoError(t, err)
+	decoded, err := Unmarshal(data, Protobuf)
+	require.NoError(t, err)
+
+	points, errs := Points(decoded)
+	assert.Equal(t, []Point{
+		{
+			Name:       "requests",
+			Labels:     internal.Labels{"service.name": "checkout", "host": "b"},
+			Kind:       Sum,
+			Cumulative: true,
+			Monotonic:  true,
+			Value:      10,
+			Time:       time.Unix(1700000000, 0),
+		},
+		{
+			Name:   "temperature",
+			Labels: internal.Labels{"service.name": "checkout", "host": "a"},
+			Kind:   Gauge,
+			Value:  21.5,
+		},
+		{
+			Name:   "latency",
+			Labels: internal.Labels{"service.name": "checkout", "host": "a"},
+			Kind:   Histogram,
+			Histogram: internal.Histogram{
+				Bounds: []float64{0.1, 0.5},
+				Counts: []uint64{1, 2, 0},
+				Sum:    0.6,
+				Count:  3,
+			},
+		},
+	}, points)
+	require.Len(t, errs, 2)
+	assert.EqualError(t, errs[0], "latency: histogram should have 3 counts for 2 bounds")
+	assert.EqualError(t, errs[1], "sizes: exponential histograms are not supported")
+}
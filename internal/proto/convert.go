@@ -0,0 +1,121 @@
+package proto
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/serializer"
+)
+
+// TypeName returns the name of a metric type used by the JSON API.
+func TypeName(t Metric_MType) internal.MetricTypeName {
+	return internal.MetricTypeName(strings.ToLower(t.String()))
+}
+
+// FromMetrics converts a metric of the JSON API to its message.
+func FromMetrics(m serializer.Metrics) (*Metric, error) {
+	mType, ok := Metric_MType_value[strings.ToUpper(m.MType)]
+	if !ok {
+		return nil, fmt.Errorf("unknown metric type %q", m.MType)
+	}
+	metric := &Metric{
+		Id:           m.ID,
+		Type:         Metric_MType(mType),
+		Labels:       m.Labels,
+		Observations: m.Observations,
+		Members:      m.Members,
+	}
+	if m.Delta != nil {
+		delta := int64(*m.Delta)
+		metric.Delta = &delta
+	}
+	if m.Value != nil {
+		value := float64(*m.Value)
+		metric.Value = &value
+	}
+	if m.Histogram != nil {
+		metric.Histogram = &Histogram{
+			Bounds: m.Histogram.Bounds,
+			Counts: m.Histogram.Counts,
+			Sum:    m.Histogram.Sum,
+			Count:  m.Histogram.Count,
+		}
+	}
+	if m.Summary != nil {
+		metric.Summary = &Summary{
+			Alpha:        m.Summary.Alpha,
+			Bins:         make(map[int32]uint64, len(m.Summary.Bins)),
+			NegativeBins: make(map[int32]uint64, len(m.Summary.NegativeBins)),
+			Zeros:        m.Summary.Zeros,
+			Count:        m.Summary.Count,
+			Sum:          m.Summary.Sum,
+			Min:          m.Summary.Min,
+			Max:          m.Summary.Max,
+		}
+		for i, count := range m.Summary.Bins {
+			metric.Summary.Bins[int32(i)] = count
+		}
+		for i, count := range m.Summary.NegativeBins {
+			metric.Summary.NegativeBins[int32(i)] = count
+		}
+	}
+	if m.Set != nil {
+		metric.Set = &Set{
+			Precision: uint32(m.Set.Precision),
+			Registers: m.Set.Registers,
+		}
+	}
+	return metric, nil
+}
+
+// ToMetrics is the reverse of FromMetrics.
+func (x *Metric) ToMetrics() serializer.Metrics {
+	m := serializer.Metrics{
+		ID:           x.GetId(),
+		MType:        string(TypeName(x.GetType())),
+		Observations: x.GetObservations(),
+		Members:      x.GetMembers(),
+	}
+	if len(x.GetLabels()) > 0 {
+		m.Labels = x.GetLabels()
+	}
+	if x.Delta != nil {
+		delta := internal.Counter(x.GetDelta())
+		m.Delta = &delta
+	}
+	if x.Value != nil {
+		value := internal.Gauge(x.GetValue())
+		m.Value = &value
+	}
+	if h := x.GetHistogram(); h != nil {
+		m.Histogram = &internal.Histogram{
+			Bounds: h.GetBounds(),
+			Counts: h.GetCounts(),
+			Sum:    h.GetSum(),
+			Count:  h.GetCount(),
+		}
+	}
+	if s := x.GetSummary(); s != nil {
+		summary := internal.NewSummary(s.GetAlpha())
+		for i, count := range s.GetBins() {
+			summary.Bins[int(i)] = count
+		}
+		for i, count := range s.GetNegativeBins() {
+			summary.NegativeBins[int(i)] = count
+		}
+		summary.Zeros = s.GetZeros()
+		summary.Count = s.GetCount()
+		summary.Sum = s.GetSum()
+		summary.Min = s.GetMin()
+		summary.Max = s.GetMax()
+		m.Summary = &summary
+	}
+	if s := x.GetSet(); s != nil {
+		m.Set = &internal.Set{
+			Precision: uint8(s.GetPrecision()),
+			Registers: s.GetRegisters(),
+		}
+	}
+	return m
+}
@@ -0,0 +1,247 @@
+// Package remotewrite decodes Prometheus remote write requests.
+package remotewrite
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/golang/snappy"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// MetricType is the metric type from remote write metadata.
+type MetricType int32
+
+const (
+	Unknown MetricType = iota
+	Counter
+	Gauge
+	Histogram
+	GaugeHistogram
+	Summary
+	Info
+	StateSet
+)
+
+// NameLabel holds the metric name among series labels.
+const NameLabel = "__name__"
+
+// staleNaN marks a series that disappeared from the scrape target.
+const staleNaN uint64 = 0x7ff0000000000002
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+type Sample struct {
+	Value float64
+	// Timestamp is in Unix milliseconds
+	Timestamp int64
+}
+
+// IsStale reports whether the sample is a Prometheus staleness marker.
+func (s Sample) IsStale() bool {
+	return math.Float64bits(s.Value) == staleNaN
+}
+
+type TimeSeries struct {
+	Labels  []Label
+	Samples []Sample
+}
+
+// WriteRequest holds the series of a request and the types of metric families from its metadata.
+type WriteRequest struct {
+	Timeseries []TimeSeries
+	Types      map[string]MetricType
+}
+
+// Decode decompresses and parses a snappy-compressed WriteRequest.
+func Decode(compressed []byte) (*WriteRequest, error) {
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress request: %w", err)
+	}
+	return Unmarshal(data)
+}
+
+// Unmarshal parses a protobuf WriteRequest.
+func Unmarshal(data []byte) (*WriteRequest, error) {
+	req := &WriteRequest{Types: make(map[string]MetricType)}
+	err := parseMessage(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == 1 && typ == protowire.BytesType:
+			ts, err := unmarshalTimeSeries(value)
+			if err != nil {
+				return err
+			}
+			req.Timeseries = append(req.Timeseries, ts)
+		case num == 3 && typ == protowire.BytesType:
+			name, mtype, err := unmarshalMetadata(value)
+			if err != nil {
+				return err
+			}
+			req.Types[name] = mtype
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func unmarshalTimeSeries(data []byte) (TimeSeries, error) {
+	var ts TimeSeries
+	err := parseMessage(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			var l Label
+			err := parseMessage(value, func(num protowire.Number, typ protowire.Type, value []byte) error {
+				switch {
+				case num == 1 && typ == protowire.BytesType:
+					l.Name = string(value)
+				case num == 2 && typ == protowire.BytesType:
+					l.Value = string(value)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ts.Labels = append(ts.Labels, l)
+		case 2:
+			var s Sample
+			err := parseMessage(value, func(num protowire.Number, typ protowire.Type, value []byte) error {
+				switch {
+				case num == 1 && typ == protowire.Fixed64Type:
+					v, _ := protowire.ConsumeFixed64(value)
+					s.Value = math.Float64frombits(v)
+				case num == 2 && typ == protowire.VarintType:
+					v, _ := protowire.ConsumeVarint(value)
+					s.Timestamp = int64(v)
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			ts.Samples = append(ts.Samples, s)
+		}
+		return nil
+	})
+	return ts, err
+}
+
+func unmarshalMetadata(data []byte) (string, MetricType, error) {
+	var name string
+	var mtype MetricType
+	err := parseMessage(data, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		switch {
+		case num == 1 && typ == protowire.VarintType:
+			v, _ := protowire.ConsumeVarint(value)
+			mtype = MetricType(v)
+		case num == 2 && typ == protowire.BytesType:
+			name = string(value)
+		}
+		return nil
+	})
+	return name, mtype, err
+}
+
+// parseMessage calls field for every field of a protobuf message. Length-delimited
+// values are passed without their length prefix, other values in their wire encoding.
+func parseMessage(data []byte, field func(num protowire.Number, typ protowire.Type, value []byte) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		var value []byte
+		if typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			value, data = v, data[n:]
+		} else {
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			value, data = data[:n], data[n:]
+		}
+		if err := field(num, typ, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var errNoName = errors.New("series without __name__ label")
+
+// Name splits series labels into the metric name and the remaining labels.
+func (ts TimeSeries) Name() (string, internal.Labels, error) {
+	var name string
+	labels := make(internal.Labels, len(ts.Labels))
+	for _, l := range ts.Labels {
+		if l.Name == NameLabel {
+			name = l.Value
+			continue
+		}
+		labels[l.Name] = l.Value
+	}
+	if name == "" {
+		return "", nil, errNoName
+	}
+	return name, labels, nil
+}
+
+// Encode marshals and snappy-compresses a WriteRequest.
+func Encode(req *WriteRequest) []byte {
+	return snappy.Encode(nil, Marshal(req))
+}
+
+// Marshal encodes a WriteRequest in protobuf; metadata only carries the types.
+func Marshal(req *WriteRequest) []byte {
+	var b []byte
+	for _, ts := range req.Timeseries {
+		var series []byte
+		for _, l := range ts.Labels {
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, l.Name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, l.Value)
+			series = protowire.AppendTag(series, 1, protowire.BytesType)
+			series = protowire.AppendBytes(series, label)
+		}
+		for _, s := range ts.Samples {
+			var sample []byte
+			sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+			sample = protowire.AppendFixed64(sample, math.Float64bits(s.Value))
+			sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+			sample = protowire.AppendVarint(sample, uint64(s.Timestamp))
+			series = protowire.AppendTag(series, 2, protowire.BytesType)
+			series = protowire.AppendBytes(series, sample)
+		}
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, series)
+	}
+	for name, mtype := range req.Types {
+		var metadata []byte
+		metadata = protowire.AppendTag(metadata, 1, protowire.VarintType)
+		metadata = protowire.AppendVarint(metadata, uint64(mtype))
+		metadata = protowire.AppendTag(metadata, 2, protowire.BytesType)
+		metadata = protowire.AppendString(metadata, name)
+		b = protowire.AppendTag(b, 3, protowire.BytesType)
+		b = protowire.AppendBytes(b, metadata)
+	}
+	return b
+}
@@ -0,0 +1,66 @@
+package remotewrite
+
+import (
+	"math"
+	"testing"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestDecode(t *testing.T) {
+	want := &WriteRequest{
+		Timeseries: []TimeSeries{
+			{
+				Labels:  []Label{{Name: NameLabel, Value: "up"}, {Name: "job", Value: "node"}},
+				Samples: []Sample{{Value: 1, Timestamp: 1700000000000}, {Value: 0, Timestamp: 1700000015000}},
+			},
+			{
+				Labels:  []Label{{Name: NameLabel, Value: "http_requests_total"}},
+				Samples: []Sample{{Value: 42, Timestamp: 1700000000000}},
+			},
+		},
+		Types: map[string]MetricType{"http_requests": Counter},
+	}
+	got, err := Decode(Encode(want))
+	require.NoError(t, err)
+	assert.Equal(t, want, got)
+
+	_, err = Decode([]byte("not snappy"))
+	assert.Error(t, err)
+	_, err = Unmarshal([]byte{0x0a, 0x05, 0x01})
+	assert.Error(t, err)
+}
+
+func TestUnmarshal_unknownFields(t *testing.T) {
+	var sample []byte
+	sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+	sample = protowire.AppendFixed64(sample, math.Float64bits(2.5))
+	sample = protowire.AppendTag(sample, 9, protowire.VarintType)
+	sample = protowire.AppendVarint(sample, 7)
+	var series []byte
+	series = protowire.AppendTag(series, 2, protowire.BytesType)
+	series = protowire.AppendBytes(series, sample)
+	var req []byte
+	req = protowire.AppendTag(req, 1, protowire.BytesType)
+	req = protowire.AppendBytes(req, series)
+	req = protowire.AppendTag(req, 15, protowire.BytesType)
+	req = protowire.AppendString(req, "ignored")
+
+	got, err := Unmarshal(req)
+	require.NoError(t, err)
+	require.Len(t, got.Timeseries, 1)
+	assert.Equal(t, []Sample{{Value: 2.5}}, got.Timeseries[0].Samples)
+}
+
+func TestTimeSeries_Name(t *testing.T) {
+	name, labels, err := TimeSeries{Labels: []Label{{Name: "job", Value: "node"}, {Name: NameLabel, Value: "up"}}}.Name()
+	require.NoError(t, err)
+	assert.Equal(t, "up", name)
+	assert.Equal(t, internal.Labels{"job": "node"}, labels)
+	_, _, err = TimeSeries{Labels: []Label{{Name: "job", Value: "node"}}}.Name()
+	assert.Error(t, err)
+	assert.True(t, Sample{Value: math.Float64frombits(staleNaN)}.IsStale())
+}
@@ -3,8 +3,56 @@ package serializer
 import "github.com/krm-shrftdnv/go-musthave-metrics/internal"
 
 type Metrics struct {
-	ID    string            `json:"id"`
-	MType string            `json:"type"`
-	Delta *internal.Counter `json:"delta,omitempty"`
-	Value *internal.Gauge   `json:"value,omitempty"`
+	ID        string              `json:"id"`
+	MType     string              `json:"type"`
+	Delta     *internal.Counter   `json:"delta,omitempty"`
+	Value     *internal.Gauge     `json:"value,omitempty"`
+	Histogram *internal.Histogram `json:"histogram,omitempty"`
+	Summary   *internal.Summary   `json:"summary,omitempty"`
+	Set       *internal.Set       `json:"set,omitempty"`
+	// Observations are raw values to add to a histogram or summary
+	Observations []float64 `json:"observations,omitempty"`
+	// Members are raw values to add to a set
+	Members []string        `json:"members,omitempty"`
+	Labels  internal.Labels `json:"labels,omitempty"`
+}
+
+func NewGauge(id string, value internal.Gauge) Metrics {
+	return Metrics{
+		ID:    id,
+		MType: string(internal.GaugeName),
+		Value: &value,
+	}
+}
+
+func NewCounter(id string, delta internal.Counter) Metrics {
+	return Metrics{
+		ID:    id,
+		MType: string(internal.CounterName),
+		Delta: &delta,
+	}
+}
+
+func NewHistogram(id string, histogram internal.Histogram) Metrics {
+	return Metrics{
+		ID:        id,
+		MType:     string(internal.HistogramName),
+		Histogram: &histogram,
+	}
+}
+
+func NewSummary(id string, summary internal.Summary) Metrics {
+	return Metrics{
+		ID:      id,
+		MType:   string(internal.SummaryName),
+		Summary: &summary,
+	}
+}
+
+func NewSet(id string, members ...string) Metrics {
+	return Metrics{
+		ID:      id,
+		MType:   string(internal.SetName),
+		Members: members,
+	}
 }
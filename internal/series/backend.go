@@ -0,0 +1,164 @@
+package series
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// backend stores the tiers of every series. Tier 0 holds raw points which are
+// read back as rollups of one point.
+type backend interface {
+	keys(ctx context.Context) ([]string, error)
+	append(ctx context.Context, key string, p Point) error
+	flush(ctx context.Context) error
+	read(ctx context.Context, key string, tier Tier, from, to int64) ([]Rollup, error)
+	write(ctx context.Context, key string, tier Tier, rollups []Rollup) error
+	lastTime(ctx context.Context, key string, tier Tier) (int64, bool, error)
+	expire(ctx context.Context, key string, tier Tier, before int64) error
+}
+
+type memSeries struct {
+	raw     Series
+	mx      sync.RWMutex
+	rollups map[time.Duration][]Rollup
+}
+
+// memBackend keeps raw points in Gorilla-compressed chunks and rollups as plain slices.
+type memBackend struct {
+	mx     sync.RWMutex
+	series map[string]*memSeries
+}
+
+func newMemBackend() *memBackend {
+	return &memBackend{series: make(map[string]*memSeries)}
+}
+
+func (b *memBackend) get(key string) (*memSeries, bool) {
+	b.mx.RLock()
+	defer b.mx.RUnlock()
+	s, ok := b.series[key]
+	return s, ok
+}
+
+func (b *memBackend) keys(context.Context) ([]string, error) {
+	b.mx.RLock()
+	defer b.mx.RUnlock()
+	keys := make([]string, 0, len(b.series))
+	for k := range b.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (b *memBackend) append(_ context.Context, key string, p Point) error {
+	// appending under the map lock keeps expire from dropping a series being written to
+	b.mx.RLock()
+	if s, ok := b.series[key]; ok {
+		err := s.raw.Append(p.T, p.V)
+		b.mx.RUnlock()
+		return err
+	}
+	b.mx.RUnlock()
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	s, ok := b.series[key]
+	if !ok {
+		s = &memSeries{rollups: make(map[time.Duration][]Rollup)}
+		b.series[key] = s
+	}
+	return s.raw.Append(p.T, p.V)
+}
+
+func (b *memBackend) flush(context.Context) error {
+	return nil
+}
+
+func (b *memBackend) read(_ context.Context, key string, tier Tier, from, to int64) ([]Rollup, error) {
+	s, ok := b.get(key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if tier.Resolution == 0 {
+		points, err := s.raw.Points(from, to)
+		if err != nil {
+			return nil, err
+		}
+		rollups := make([]Rollup, 0, len(points))
+		for _, p := range points {
+			rollups = append(rollups, pointRollup(p))
+		}
+		return rollups, nil
+	}
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	all := s.rollups[tier.Resolution]
+	i := sort.Search(len(all), func(i int) bool { return all[i].T >= from })
+	j := sort.Search(len(all), func(i int) bool { return all[i].T > to })
+	return append([]Rollup(nil), all[i:j]...), nil
+}
+
+func (b *memBackend) write(_ context.Context, key string, tier Tier, rollups []Rollup) error {
+	s, ok := b.get(key)
+	if !ok {
+		return ErrNotFound
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.rollups[tier.Resolution] = append(s.rollups[tier.Resolution], rollups...)
+	return nil
+}
+
+func (b *memBackend) lastTime(_ context.Context, key string, tier Tier) (int64, bool, error) {
+	s, ok := b.get(key)
+	if !ok {
+		return 0, false, ErrNotFound
+	}
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	rollups := s.rollups[tier.Resolution]
+	if len(rollups) == 0 {
+		return 0, false, nil
+	}
+	return rollups[len(rollups)-1].T, true, nil
+}
+
+func (b *memBackend) expire(_ context.Context, key string, tier Tier, before int64) error {
+	s, ok := b.get(key)
+	if !ok {
+		return nil
+	}
+	if tier.Resolution == 0 {
+		s.raw.Truncate(before)
+	} else {
+		s.mx.Lock()
+		rollups := s.rollups[tier.Resolution]
+		i := sort.Search(len(rollups), func(i int) bool { return rollups[i].T >= before })
+		s.rollups[tier.Resolution] = append(rollups[:0], rollups[i:]...)
+		s.mx.Unlock()
+	}
+	if s.empty() {
+		b.mx.Lock()
+		if s.empty() {
+			delete(b.series, key)
+		}
+		b.mx.Unlock()
+	}
+	return nil
+}
+
+func (s *memSeries) empty() bool {
+	if !s.raw.Empty() {
+		return false
+	}
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	for _, rollups := range s.rollups {
+		if len(rollups) > 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package series
+
+import "io"
+
+// bstream is an append-only stream of bits.
+type bstream struct {
+	stream []byte
+	// free is the number of unused low bits in the last byte
+	free uint8
+}
+
+func (b *bstream) bytes() []byte {
+	return b.stream
+}
+
+func (b *bstream) writeBit(bit bool) {
+	if b.free == 0 {
+		b.stream = append(b.stream, 0)
+		b.free = 8
+	}
+	if bit {
+		b.stream[len(b.stream)-1] |= 1 << (b.free - 1)
+	}
+	b.free--
+}
+
+func (b *bstream) writeBits(u uint64, nbits int) {
+	for i := nbits - 1; i >= 0; i-- {
+		b.writeBit(u>>uint(i)&1 == 1)
+	}
+}
+
+type bstreamReader struct {
+	stream []byte
+	pos    int
+}
+
+func newBReader(b []byte) *bstreamReader {
+	return &bstreamReader{stream: b}
+}
+
+func (r *bstreamReader) readBit() (bool, error) {
+	if r.pos >= len(r.stream)*8 {
+		return false, io.EOF
+	}
+	bit := r.stream[r.pos/8]>>(7-uint(r.pos%8))&1 == 1
+	r.pos++
+	return bit, nil
+}
+
+func (r *bstreamReader) readBits(nbits int) (uint64, error) {
+	var u uint64
+	for i := 0; i < nbits; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		u <<= 1
+		if bit {
+			u |= 1
+		}
+	}
+	return u, nil
+}
@@ -0,0 +1,224 @@
+package series
+
+import (
+	"math"
+	"math/bits"
+)
+
+// chunkSize is the number of points after which a series starts a new chunk.
+const chunkSize = 120
+
+// Chunk stores points with Gorilla compression: timestamps as delta-of-delta
+// and values as XOR with the previous value.
+type Chunk struct {
+	b   bstream
+	num int
+
+	minT, maxT int64
+	tDelta     int64
+	v          float64
+	leading    uint8
+	trailing   uint8
+}
+
+func (c *Chunk) Len() int {
+	return c.num
+}
+
+func (c *Chunk) MinTime() int64 {
+	return c.minT
+}
+
+func (c *Chunk) MaxTime() int64 {
+	return c.maxT
+}
+
+func (c *Chunk) Bytes() []byte {
+	return c.b.bytes()
+}
+
+// Append adds a point with a timestamp in milliseconds. Timestamps must not decrease.
+func (c *Chunk) Append(t int64, v float64) {
+	switch c.num {
+	case 0:
+		c.b.writeBits(uint64(t), 64)
+		c.b.writeBits(math.Float64bits(v), 64)
+		c.minT = t
+	default:
+		tDelta := t - c.maxT
+		c.writeDoD(tDelta - c.tDelta)
+		c.tDelta = tDelta
+		c.writeXOR(v)
+	}
+	c.maxT = t
+	c.v = v
+	c.num++
+}
+
+var dodEncodings = []struct {
+	prefix, prefixBits uint64
+	bits               int
+}{
+	{prefix: 0b10, prefixBits: 2, bits: 7},
+	{prefix: 0b110, prefixBits: 3, bits: 9},
+	{prefix: 0b1110, prefixBits: 4, bits: 12},
+}
+
+func (c *Chunk) writeDoD(dod int64) {
+	if dod == 0 {
+		c.b.writeBit(false)
+		return
+	}
+	for _, enc := range dodEncodings {
+		if fitsBits(dod, enc.bits) {
+			c.b.writeBits(enc.prefix, int(enc.prefixBits))
+			c.b.writeBits(uint64(dod), enc.bits)
+			return
+		}
+	}
+	c.b.writeBits(0b1111, 4)
+	c.b.writeBits(uint64(dod), 64)
+}
+
+// fitsBits reports whether dod fits into the signed range [-(2^(n-1)-1), 2^(n-1)].
+func fitsBits(dod int64, n int) bool {
+	return -(1<<(n-1))+1 <= dod && dod <= 1<<(n-1)
+}
+
+func (c *Chunk) writeXOR(v float64) {
+	xor := math.Float64bits(v) ^ math.Float64bits(c.v)
+	if xor == 0 {
+		c.b.writeBit(false)
+		return
+	}
+	c.b.writeBit(true)
+	leading := uint8(bits.LeadingZeros64(xor))
+	trailing := uint8(bits.TrailingZeros64(xor))
+	if leading >= 32 {
+		leading = 31
+	}
+	if c.num > 1 && leading >= c.leading && trailing >= c.trailing {
+		c.b.writeBit(false)
+		c.b.writeBits(xor>>c.trailing, 64-int(c.leading)-int(c.trailing))
+		return
+	}
+	c.leading, c.trailing = leading, trailing
+	c.b.writeBit(true)
+	c.b.writeBits(uint64(leading), 5)
+	sigbits := 64 - leading - trailing
+	// 64 significant bits don't fit into 6 bits and are written as 0
+	c.b.writeBits(uint64(sigbits)&0x3f, 6)
+	c.b.writeBits(xor>>trailing, int(sigbits))
+}
+
+// Points decodes all points of the chunk.
+func (c *Chunk) Points() ([]Point, error) {
+	it := chunkIterator{r: newBReader(c.b.bytes())}
+	points := make([]Point, 0, c.num)
+	for i := 0; i < c.num; i++ {
+		if err := it.next(i); err != nil {
+			return nil, err
+		}
+		points = append(points, Point{T: it.t, V: it.v})
+	}
+	return points, nil
+}
+
+type chunkIterator struct {
+	r        *bstreamReader
+	t        int64
+	tDelta   int64
+	v        float64
+	leading  uint8
+	trailing uint8
+}
+
+func (it *chunkIterator) next(i int) error {
+	if i == 0 {
+		t, err := it.r.readBits(64)
+		if err != nil {
+			return err
+		}
+		v, err := it.r.readBits(64)
+		if err != nil {
+			return err
+		}
+		it.t, it.v = int64(t), math.Float64frombits(v)
+		return nil
+	}
+	dod, err := it.readDoD()
+	if err != nil {
+		return err
+	}
+	it.tDelta += dod
+	it.t += it.tDelta
+	return it.readXOR()
+}
+
+func (it *chunkIterator) readDoD() (int64, error) {
+	// the number of leading ones in the prefix selects the encoding
+	var ones int
+	for ones < 4 {
+		bit, err := it.r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if !bit {
+			break
+		}
+		ones++
+	}
+	var n int
+	switch ones {
+	case 0:
+		return 0, nil
+	case 4:
+		n = 64
+	default:
+		n = dodEncodings[ones-1].bits
+	}
+	u, err := it.r.readBits(n)
+	if err != nil {
+		return 0, err
+	}
+	if n == 64 {
+		return int64(u), nil
+	}
+	if u > 1<<(n-1) {
+		return int64(u) - 1<<n, nil
+	}
+	return int64(u), nil
+}
+
+func (it *chunkIterator) readXOR() error {
+	bit, err := it.r.readBit()
+	if err != nil || !bit {
+		return err
+	}
+	bit, err = it.r.readBit()
+	if err != nil {
+		return err
+	}
+	if bit {
+		leading, err := it.r.readBits(5)
+		if err != nil {
+			return err
+		}
+		sigbits, err := it.r.readBits(6)
+		if err != nil {
+			return err
+		}
+		if sigbits == 0 {
+			sigbits = 64
+		}
+		it.leading = uint8(leading)
+		it.trailing = 64 - it.leading - uint8(sigbits)
+	}
+	sigbits := 64 - int(it.leading) - int(it.trailing)
+	xor, err := it.r.readBits(sigbits)
+	if err != nil {
+		return err
+	}
+	it.v = math.Float64frombits(math.Float64bits(it.v) ^ xor<<it.trailing)
+	return nil
+}
@@ -0,0 +1,167 @@
+package series
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+)
+
+// maxPending bounds the points waiting to be inserted.
+const maxPending = 10000
+
+var ErrTooManyPending = errors.New("too many points waiting to be written")
+
+type pendingPoint struct {
+	key string
+	Point
+}
+
+// dbBackend keeps raw points in series_points and rollups in series_rollups.
+// Appended points are buffered and inserted in batches by flush.
+type dbBackend struct {
+	db      *sql.DB
+	mx      sync.Mutex
+	pending []pendingPoint
+}
+
+func (b *dbBackend) keys(ctx context.Context) ([]string, error) {
+	rows, err := b.db.QueryContext(ctx, "SELECT DISTINCT key FROM series_points UNION SELECT DISTINCT key FROM series_rollups ORDER BY key")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	keys := make([]string, 0)
+	for rows.Next() {
+		var key string
+		if err = rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (b *dbBackend) append(_ context.Context, key string, p Point) error {
+	b.mx.Lock()
+	defer b.mx.Unlock()
+	if len(b.pending) >= maxPending {
+		return ErrTooManyPending
+	}
+	b.pending = append(b.pending, pendingPoint{key: key, Point: p})
+	return nil
+}
+
+// flush inserts the buffered points in one transaction. Points of a failed
+// batch are dropped.
+func (b *dbBackend) flush(ctx context.Context) (err error) {
+	b.mx.Lock()
+	points := b.pending
+	b.pending = nil
+	b.mx.Unlock()
+	if len(points) == 0 {
+		return nil
+	}
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+	stmt, err := tx.PrepareContext(ctx, "INSERT INTO series_points (key, ts, value) VALUES ($1, $2, $3)")
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, p := range points {
+		if _, err = stmt.ExecContext(ctx, p.key, p.T, p.V); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *dbBackend) read(ctx context.Context, key string, tier Tier, from, to int64) ([]Rollup, error) {
+	var rows *sql.Rows
+	var err error
+	if tier.Resolution == 0 {
+		rows, err = b.db.QueryContext(ctx,
+			"SELECT ts, value, value, value, 1, value FROM series_points WHERE key = $1 AND ts >= $2 AND ts <= $3 ORDER BY ts",
+			key, from, to)
+	} else {
+		rows, err = b.db.QueryContext(ctx,
+			"SELECT ts, min, max, sum, count, last FROM series_rollups WHERE key = $1 AND resolution = $2 AND ts >= $3 AND ts <= $4 ORDER BY ts",
+			key, tier.Resolution.Milliseconds(), from, to)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	rollups := make([]Rollup, 0)
+	for rows.Next() {
+		var r Rollup
+		if err = rows.Scan(&r.T, &r.Min, &r.Max, &r.Sum, &r.Count, &r.Last); err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, r)
+	}
+	return rollups, rows.Err()
+}
+
+func (b *dbBackend) write(ctx context.Context, key string, tier Tier, rollups []Rollup) (err error) {
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+	stmt, err := tx.PrepareContext(ctx, `
+		INSERT INTO series_rollups (key, resolution, ts, min, max, sum, count, last)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (key, resolution, ts) DO UPDATE SET
+			min = EXCLUDED.min, max = EXCLUDED.max, sum = EXCLUDED.sum, count = EXCLUDED.count, last = EXCLUDED.last
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, r := range rollups {
+		if _, err = stmt.ExecContext(ctx, key, tier.Resolution.Milliseconds(), r.T, r.Min, r.Max, r.Sum, r.Count, r.Last); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *dbBackend) lastTime(ctx context.Context, key string, tier Tier) (int64, bool, error) {
+	var last sql.NullInt64
+	err := b.db.QueryRowContext(ctx,
+		"SELECT max(ts) FROM series_rollups WHERE key = $1 AND resolution = $2",
+		key, tier.Resolution.Milliseconds()).Scan(&last)
+	if err != nil {
+		return 0, false, err
+	}
+	return last.Int64, last.Valid, nil
+}
+
+func (b *dbBackend) expire(ctx context.Context, key string, tier Tier, before int64) error {
+	var err error
+	if tier.Resolution == 0 {
+		_, err = b.db.ExecContext(ctx, "DELETE FROM series_points WHERE key = $1 AND ts < $2", key, before)
+	} else {
+		_, err = b.db.ExecContext(ctx,
+			"DELETE FROM series_rollups WHERE key = $1 AND resolution = $2 AND ts < $3",
+			key, tier.Resolution.Milliseconds(), before)
+	}
+	return err
+}
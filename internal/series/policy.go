@@ -0,0 +1,134 @@
+package series
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Tier keeps points at the given resolution for the retention window.
+// The first tier of a policy holds raw points and has zero resolution;
+// zero retention keeps data forever.
+type Tier struct {
+	Resolution time.Duration
+	Retention  time.Duration
+}
+
+// Policy applies retention tiers to metrics whose name matches Pattern (path.Match syntax).
+type Policy struct {
+	Pattern string
+	Tiers   []Tier
+}
+
+type Policies []Policy
+
+// rawForever is used for metrics that no policy matches.
+var rawForever = Policy{Pattern: "*", Tiers: []Tier{{}}}
+
+// Lookup returns the first policy matching the metric name.
+func (p Policies) Lookup(name string) Policy {
+	for _, policy := range p {
+		if ok, _ := path.Match(policy.Pattern, name); ok {
+			return policy
+		}
+	}
+	return rawForever
+}
+
+// Tier returns the index of the coarsest tier whose resolution is not above step.
+func (p Policy) Tier(step time.Duration) (int, Tier) {
+	i := 0
+	for j, tier := range p.Tiers {
+		if tier.Resolution <= step {
+			i = j
+		}
+	}
+	return i, p.Tiers[i]
+}
+
+func (p Policy) Validate() error {
+	if _, err := path.Match(p.Pattern, ""); err != nil {
+		return fmt.Errorf("pattern %q: %w", p.Pattern, err)
+	}
+	if len(p.Tiers) == 0 || p.Tiers[0].Resolution != 0 {
+		return fmt.Errorf("pattern %q: the first tier should keep raw points", p.Pattern)
+	}
+	for i := 1; i < len(p.Tiers); i++ {
+		prev, tier := p.Tiers[i-1], p.Tiers[i]
+		if tier.Resolution < time.Millisecond || tier.Resolution <= prev.Resolution {
+			return fmt.Errorf("pattern %q: tier resolutions should increase", p.Pattern)
+		}
+		if prev.Resolution != 0 && tier.Resolution%prev.Resolution != 0 {
+			return fmt.Errorf("pattern %q: resolution %v is not a multiple of %v", p.Pattern, tier.Resolution, prev.Resolution)
+		}
+		// the compactor builds a tier from the previous one, which must outlive a whole bucket
+		if prev.Retention != 0 && prev.Retention < tier.Resolution {
+			return fmt.Errorf("pattern %q: retention %v is shorter than the next resolution %v", p.Pattern, prev.Retention, tier.Resolution)
+		}
+	}
+	return nil
+}
+
+// ParsePolicies parses policies like "Go*=raw:1h;*=raw:24h,1m:30d,1h:1y".
+// Policies are separated by semicolons and matched in order.
+func ParsePolicies(s string) (Policies, error) {
+	var policies Policies
+	for _, spec := range strings.Split(s, ";") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		pattern, tiers, ok := strings.Cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid policy %q, expected pattern=tiers", spec)
+		}
+		policy := Policy{Pattern: strings.TrimSpace(pattern)}
+		for _, tierSpec := range strings.Split(tiers, ",") {
+			resolution, retention, ok := strings.Cut(strings.TrimSpace(tierSpec), ":")
+			if !ok {
+				return nil, fmt.Errorf("invalid tier %q, expected resolution:retention", tierSpec)
+			}
+			var tier Tier
+			var err error
+			if resolution != "raw" {
+				if tier.Resolution, err = parseDuration(resolution); err != nil {
+					return nil, err
+				}
+			}
+			if tier.Retention, err = parseDuration(retention); err != nil {
+				return nil, err
+			}
+			policy.Tiers = append(policy.Tiers, tier)
+		}
+		if err := policy.Validate(); err != nil {
+			return nil, err
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+var durationUnits = map[byte]time.Duration{
+	'd': 24 * time.Hour,
+	'w': 7 * 24 * time.Hour,
+	'y': 365 * 24 * time.Hour,
+}
+
+// parseDuration extends time.ParseDuration with whole days, weeks and years.
+func parseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, errors.New("empty duration")
+	}
+	if unit, ok := durationUnits[s[len(s)-1]]; ok {
+		n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(n) * unit, nil
+	}
+	return time.ParseDuration(s)
+}
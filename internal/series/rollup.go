@@ -0,0 +1,83 @@
+package series
+
+import (
+	"fmt"
+	"math"
+)
+
+type Aggregation string
+
+const (
+	Min   Aggregation = "min"
+	Max   Aggregation = "max"
+	Avg   Aggregation = "avg"
+	Count Aggregation = "count"
+	Last  Aggregation = "last"
+)
+
+func ParseAggregation(s string) (Aggregation, error) {
+	switch agg := Aggregation(s); agg {
+	case "":
+		return Last, nil
+	case Min, Max, Avg, Count, Last:
+		return agg, nil
+	default:
+		return "", fmt.Errorf("aggregation should be one of min, max, avg, count or last")
+	}
+}
+
+// Rollup summarizes the points of a bucket starting at T. A raw point is a rollup of one.
+type Rollup struct {
+	T     int64
+	Min   float64
+	Max   float64
+	Sum   float64
+	Count int64
+	Last  float64
+}
+
+func pointRollup(p Point) Rollup {
+	return Rollup{T: p.T, Min: p.V, Max: p.V, Sum: p.V, Count: 1, Last: p.V}
+}
+
+func (r *Rollup) merge(other Rollup) {
+	r.Min = math.Min(r.Min, other.Min)
+	r.Max = math.Max(r.Max, other.Max)
+	r.Sum += other.Sum
+	r.Count += other.Count
+	r.Last = other.Last
+}
+
+func (r Rollup) Value(agg Aggregation) float64 {
+	switch agg {
+	case Min:
+		return r.Min
+	case Max:
+		return r.Max
+	case Avg:
+		return r.Sum / float64(r.Count)
+	case Count:
+		return float64(r.Count)
+	default:
+		return r.Last
+	}
+}
+
+// aggregate merges time-ordered rollups into buckets of step aligned to origin.
+func aggregate(rollups []Rollup, origin int64, step int64) []Rollup {
+	merged := make([]Rollup, 0)
+	for _, r := range rollups {
+		offset := r.T - origin
+		start := origin + offset/step*step
+		if offset < 0 && offset%step != 0 {
+			start -= step
+		}
+		if n := len(merged); n > 0 && merged[n-1].T == start {
+			merged[n-1].merge(r)
+			continue
+		}
+		r.T = start
+		merged = append(merged, r)
+	}
+	return merged
+}
@@ -0,0 +1,80 @@
+package series
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrOutOfOrder rejects a point older than the last one of its series.
+var ErrOutOfOrder = errors.New("point is older than the last one of the series")
+
+// Point is a value with its timestamp in Unix milliseconds.
+type Point struct {
+	T int64   `json:"timestamp"`
+	V float64 `json:"value"`
+}
+
+// Series is a time-ordered sequence of compressed chunks.
+type Series struct {
+	mx     sync.RWMutex
+	chunks []*Chunk
+}
+
+// Append adds a point no older than the last one.
+func (s *Series) Append(t int64, v float64) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	var last *Chunk
+	if len(s.chunks) > 0 {
+		last = s.chunks[len(s.chunks)-1]
+		if t < last.MaxTime() {
+			return ErrOutOfOrder
+		}
+	}
+	if last == nil || last.Len() >= chunkSize {
+		last = &Chunk{}
+		s.chunks = append(s.chunks, last)
+	}
+	last.Append(t, v)
+	return nil
+}
+
+func (s *Series) Empty() bool {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	return len(s.chunks) == 0
+}
+
+// Truncate drops chunks that end before minT and reports whether the series is empty.
+func (s *Series) Truncate(minT int64) bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	i := 0
+	for i < len(s.chunks) && s.chunks[i].MaxTime() < minT {
+		i++
+	}
+	s.chunks = append(s.chunks[:0], s.chunks[i:]...)
+	return len(s.chunks) == 0
+}
+
+// Points returns the points with timestamps in [from, to].
+func (s *Series) Points(from, to int64) ([]Point, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	points := make([]Point, 0)
+	for _, c := range s.chunks {
+		if c.MaxTime() < from || c.MinTime() > to {
+			continue
+		}
+		chunkPoints, err := c.Points()
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range chunkPoints {
+			if p.T >= from && p.T <= to {
+				points = append(points, p)
+			}
+		}
+	}
+	return points, nil
+}
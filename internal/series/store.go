@@ -0,0 +1,223 @@
+package series
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/logger"
+	errs "github.com/pkg/errors"
+)
+
+var (
+	ErrNotFound  = errors.New("series not found")
+	ErrAmbiguous = errors.New("several series match, specify more labels")
+)
+
+// Key identifies the history of a series of the given metric type.
+func Key(metricType internal.MetricTypeName, seriesKey string) string {
+	return string(metricType) + "/" + seriesKey
+}
+
+// keyName returns the metric name of a history key.
+func keyName(key string) string {
+	_, seriesKey, _ := strings.Cut(key, "/")
+	name, _, err := internal.ParseSeriesKey(seriesKey)
+	if err != nil {
+		return seriesKey
+	}
+	return name
+}
+
+// Range selects points from From up to but not including To. With a positive Step
+// the points are aggregated into buckets of Step starting at From.
+type Range struct {
+	From        time.Time
+	To          time.Time
+	Step        time.Duration
+	Aggregation Aggregation
+}
+
+// Store keeps the history of every series in the retention tiers of its policy.
+type Store struct {
+	Policies Policies
+	backend  backend
+}
+
+func NewStore(policies Policies) *Store {
+	return &Store{
+		Policies: policies,
+		backend:  newMemBackend(),
+	}
+}
+
+// NewDBStore keeps history in the series_points and series_rollups tables.
+func NewDBStore(db *sql.DB, policies Policies) *Store {
+	return &Store{
+		Policies: policies,
+		backend:  &dbBackend{db: db},
+	}
+}
+
+func (s *Store) Policy(key string) Policy {
+	return s.Policies.Lookup(keyName(key))
+}
+
+// Append adds a point without waiting for the database, which only sees it after
+// the next Flush.
+func (s *Store) Append(key string, t time.Time, v float64) {
+	err := s.backend.append(context.Background(), key, Point{T: t.UnixMilli(), V: v})
+	if errors.Is(err, ErrOutOfOrder) {
+		logger.Log.Warnf("dropping point of series %s at %s: %v", key, t.Format(time.RFC3339Nano), err)
+		return
+	}
+	if err != nil {
+		logger.Log.Errorf("failed to append to series %s: %v", key, err)
+	}
+}
+
+// Flush writes the points appended since the last flush.
+func (s *Store) Flush(ctx context.Context) error {
+	return errs.WithMessage(s.backend.flush(ctx), "failed to write series points")
+}
+
+// Query reads the coarsest tier whose resolution fits the step and falls back to
+// finer tiers for the time the compactor has not rolled up yet.
+func (s *Store) Query(ctx context.Context, key string, r Range) ([]Point, error) {
+	if r.To.Before(r.From) {
+		return nil, errors.New("from should not be after to")
+	}
+	if r.Step < 0 {
+		return nil, errors.New("step should not be negative")
+	}
+	if err := s.Flush(ctx); err != nil {
+		return nil, err
+	}
+	policy := s.Policy(key)
+	i, _ := policy.Tier(r.Step)
+	rollups, err := s.read(ctx, key, policy, i, r.From.UnixMilli(), r.To.UnixMilli()-1)
+	if err != nil {
+		return nil, err
+	}
+	if r.Step > 0 {
+		rollups = aggregate(rollups, r.From.UnixMilli(), r.Step.Milliseconds())
+	}
+	points := make([]Point, 0, len(rollups))
+	for _, rollup := range rollups {
+		points = append(points, Point{T: rollup.T, V: rollup.Value(r.Aggregation)})
+	}
+	return points, nil
+}
+
+func (s *Store) read(ctx context.Context, key string, policy Policy, i int, from, to int64) ([]Rollup, error) {
+	tier := policy.Tiers[i]
+	rollups, err := s.backend.read(ctx, key, tier, from, to)
+	if err != nil || i == 0 {
+		return rollups, err
+	}
+	next := from
+	if n := len(rollups); n > 0 {
+		next = rollups[n-1].T + tier.Resolution.Milliseconds()
+	}
+	if next > to {
+		return rollups, nil
+	}
+	finer, err := s.read(ctx, key, policy, i-1, next, to)
+	if err != nil {
+		return nil, err
+	}
+	return append(rollups, finer...), nil
+}
+
+// Find returns the key of the series with the exact name and labels or of the only
+// series of that name whose labels contain the filter.
+func (s *Store) Find(ctx context.Context, metricType internal.MetricTypeName, name string, filter internal.Labels) (string, error) {
+	keys, err := s.Keys(ctx)
+	if err != nil {
+		return "", err
+	}
+	exact := Key(metricType, internal.SeriesKey(name, filter))
+	prefix := Key(metricType, "")
+	var found string
+	for _, k := range keys {
+		if k == exact {
+			return k, nil
+		}
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		seriesName, labels, err := internal.ParseSeriesKey(k[len(prefix):])
+		if err != nil || seriesName != name || !labels.Match(filter) {
+			continue
+		}
+		if found != "" {
+			return "", ErrAmbiguous
+		}
+		found = k
+	}
+	if found == "" {
+		return "", ErrNotFound
+	}
+	return found, nil
+}
+
+func (s *Store) Keys(ctx context.Context) ([]string, error) {
+	if err := s.Flush(ctx); err != nil {
+		return nil, err
+	}
+	return s.backend.keys(ctx)
+}
+
+// Compact rolls complete buckets of every tier up into the next one and
+// deletes data that outlived its tier.
+func (s *Store) Compact(ctx context.Context, now time.Time) error {
+	if err := s.Flush(ctx); err != nil {
+		return err
+	}
+	keys, err := s.backend.keys(ctx)
+	if err != nil {
+		return errs.WithMessage(err, "failed to list series")
+	}
+	for _, key := range keys {
+		policy := s.Policy(key)
+		for i := 1; i < len(policy.Tiers); i++ {
+			if err = s.rollup(ctx, key, policy.Tiers[i-1], policy.Tiers[i], now); err != nil {
+				return errs.WithMessagef(err, "failed to roll up %s", key)
+			}
+		}
+		for _, tier := range policy.Tiers {
+			if tier.Retention == 0 {
+				continue
+			}
+			if err = s.backend.expire(ctx, key, tier, now.Add(-tier.Retention).UnixMilli()); err != nil {
+				return errs.WithMessagef(err, "failed to expire %s", key)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Store) rollup(ctx context.Context, key string, source Tier, tier Tier, now time.Time) error {
+	resolution := tier.Resolution.Milliseconds()
+	// only buckets that ended before now are complete
+	end := now.UnixMilli() / resolution * resolution
+	var start int64
+	last, ok, err := s.backend.lastTime(ctx, key, tier)
+	if err != nil {
+		return err
+	}
+	if ok {
+		start = last + resolution
+	}
+	if start >= end {
+		return nil
+	}
+	rollups, err := s.backend.read(ctx, key, source, start, end-1)
+	if err != nil || len(rollups) == 0 {
+		return err
+	}
+	return s.backend.write(ctx, key, tier, aggregate(rollups, 0, resolution))
+}
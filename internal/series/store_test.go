@@ -0,0 +1,233 @@
+package series
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func rawPolicies(retention time.Duration) Policies {
+	return Policies{{Pattern: "*", Tiers: []Tier{{Retention: retention}}}}
+}
+
+func TestStore_Query(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Minute)
+	s := NewStore(rawPolicies(time.Hour))
+	key := Key(internal.GaugeName, "Alloc")
+	for i := 0; i < 300; i++ {
+		s.Append(key, now.Add(-90*time.Minute).Add(time.Duration(i)*30*time.Second), float64(i))
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		r       Range
+		want    []Point
+		wantErr error
+	}{
+		{
+			name: "raw points",
+			key:  key,
+			r:    Range{From: now.Add(-time.Minute), To: now.Add(30 * time.Second)},
+			want: []Point{
+				{T: now.Add(-time.Minute).UnixMilli(), V: 178},
+				{T: now.Add(-30 * time.Second).UnixMilli(), V: 179},
+				{T: now.UnixMilli(), V: 180},
+			},
+		},
+		{
+			name: "last value per step",
+			key:  key,
+			r:    Range{From: now.Add(-2 * time.Minute), To: now, Step: time.Minute},
+			want: []Point{
+				{T: now.Add(-2 * time.Minute).UnixMilli(), V: 177},
+				{T: now.Add(-time.Minute).UnixMilli(), V: 179},
+			},
+		},
+		{
+			name: "average per step",
+			key:  key,
+			r:    Range{From: now.Add(-2 * time.Minute), To: now, Step: time.Minute, Aggregation: Avg},
+			want: []Point{
+				{T: now.Add(-2 * time.Minute).UnixMilli(), V: 176.5},
+				{T: now.Add(-time.Minute).UnixMilli(), V: 178.5},
+			},
+		},
+		{
+			name: "to is excluded",
+			key:  key,
+			r:    Range{From: now.Add(-time.Minute), To: now},
+			want: []Point{
+				{T: now.Add(-time.Minute).UnixMilli(), V: 178},
+				{T: now.Add(-30 * time.Second).UnixMilli(), V: 179},
+			},
+		},
+		{
+			name: "range of one step",
+			key:  key,
+			r:    Range{From: now.Add(-time.Hour), To: now, Step: time.Hour, Aggregation: Count},
+			want: []Point{{T: now.Add(-time.Hour).UnixMilli(), V: 120}},
+		},
+		{name: "unknown series", key: Key(internal.CounterName, "Alloc"), r: Range{From: now.Add(-time.Minute), To: now}, wantErr: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Query(ctx, tt.key, tt.r)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	_, err := s.Query(ctx, key, Range{From: now, To: now.Add(-time.Minute)})
+	assert.Error(t, err)
+}
+
+func TestStore_Append_outOfOrder(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Minute)
+	s := NewStore(rawPolicies(time.Hour))
+	key := Key(internal.GaugeName, "Alloc")
+	s.Append(key, now, 1)
+	s.Append(key, now.Add(-time.Minute), 2)
+	s.Append(key, now.Add(time.Second), 3)
+
+	points, err := s.Query(ctx, key, Range{From: now.Add(-time.Hour), To: now.Add(time.Hour)})
+	require.NoError(t, err)
+	assert.Equal(t, []Point{{T: now.UnixMilli(), V: 1}, {T: now.Add(time.Second).UnixMilli(), V: 3}}, points)
+
+	var raw Series
+	require.NoError(t, raw.Append(10, 1))
+	assert.ErrorIs(t, raw.Append(5, 2), ErrOutOfOrder)
+	assert.NoError(t, raw.Append(10, 3))
+}
+
+func TestStore_Compact(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+	ctx := context.Background()
+	policies, err := ParsePolicies("Go*=raw:1h;*=raw:10m,1m:1h,10m:1d")
+	require.NoError(t, err)
+	s := NewStore(policies)
+	now := time.Now().Truncate(10 * time.Minute)
+	alloc := Key(internal.GaugeName, "Alloc")
+	goroutines := Key(internal.GaugeName, "Goroutines")
+	start := now.Add(-30 * time.Minute)
+	for i := 0; i < 3*chunkSize; i++ {
+		ts := start.Add(time.Duration(i) * 10 * time.Second)
+		s.Append(alloc, ts, float64(i))
+		s.Append(goroutines, ts, float64(i))
+	}
+	s.Append(Key(internal.GaugeName, "Stale"), now.Add(-48*time.Hour), 1)
+	require.NoError(t, s.Compact(ctx, now.Add(5*time.Second)))
+
+	keys, err := s.Keys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{alloc, goroutines}, keys)
+
+	// six points per minute rolled up into a one-minute tier
+	points, err := s.Query(ctx, alloc, Range{From: start, To: start.Add(2 * time.Minute), Step: time.Minute, Aggregation: Count})
+	require.NoError(t, err)
+	assert.Equal(t, []Point{{T: start.UnixMilli(), V: 6}, {T: start.Add(time.Minute).UnixMilli(), V: 6}}, points)
+	points, err = s.Query(ctx, alloc, Range{From: start, To: start.Add(10 * time.Minute), Step: 10 * time.Minute, Aggregation: Max})
+	require.NoError(t, err)
+	assert.Equal(t, []Point{{T: start.UnixMilli(), V: 59}}, points)
+
+	// raw points older than ten minutes are gone, rollups still cover them
+	points, err = s.Query(ctx, alloc, Range{From: start, To: start.Add(time.Minute)})
+	require.NoError(t, err)
+	assert.Empty(t, points)
+	points, err = s.Query(ctx, goroutines, Range{From: start, To: start.Add(time.Minute)})
+	require.NoError(t, err)
+	assert.Len(t, points, 6)
+
+	// the coarse tier falls back to raw points the compactor hasn't rolled up yet
+	points, err = s.Query(ctx, alloc, Range{From: start, To: now.Add(time.Hour), Step: time.Hour, Aggregation: Count})
+	require.NoError(t, err)
+	assert.Equal(t, []Point{{T: start.UnixMilli(), V: 3 * chunkSize}}, points)
+
+	// compacting again doesn't duplicate rollups
+	require.NoError(t, s.Compact(ctx, now.Add(5*time.Second)))
+	points, err = s.Query(ctx, alloc, Range{From: start, To: now.Add(time.Hour), Step: time.Hour, Aggregation: Count})
+	require.NoError(t, err)
+	assert.Equal(t, []Point{{T: start.UnixMilli(), V: 3 * chunkSize}}, points)
+}
+
+func TestStore_Find(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+	ctx := context.Background()
+	s := NewStore(nil)
+	s.Append(Key(internal.GaugeName, internal.SeriesKey("Alloc", internal.Labels{"host": "a"})), time.Now(), 1)
+	s.Append(Key(internal.GaugeName, internal.SeriesKey("Alloc", internal.Labels{"host": "b"})), time.Now(), 2)
+
+	key, err := s.Find(ctx, internal.GaugeName, "Alloc", internal.Labels{"host": "b"})
+	require.NoError(t, err)
+	assert.Equal(t, `gauge/Alloc{host="b"}`, key)
+	_, err = s.Find(ctx, internal.GaugeName, "Alloc", nil)
+	assert.ErrorIs(t, err, ErrAmbiguous)
+	_, err = s.Find(ctx, internal.CounterName, "Alloc", internal.Labels{"host": "b"})
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestParsePolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    Policies
+		wantErr bool
+	}{
+		{
+			name: "tiers",
+			s:    "Go*=raw:1h; *=raw:24h,1m:30d,1h:1y",
+			want: Policies{
+				{Pattern: "Go*", Tiers: []Tier{{Retention: time.Hour}}},
+				{Pattern: "*", Tiers: []Tier{
+					{Retention: 24 * time.Hour},
+					{Resolution: time.Minute, Retention: 30 * 24 * time.Hour},
+					{Resolution: time.Hour, Retention: 365 * 24 * time.Hour},
+				}},
+			},
+		},
+		{name: "empty", s: ""},
+		{name: "no raw tier", s: "*=1m:1d", wantErr: true},
+		{name: "resolution not a multiple", s: "*=raw:1d,1m:1d,90s:1d", wantErr: true},
+		{name: "raw expires before rollup", s: "*=raw:30s,1m:1d", wantErr: true},
+		{name: "bad duration", s: "*=raw:forever", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePolicies(tt.s)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+	policies, err := ParsePolicies("Go*=raw:1h;*=raw:24h,1m:30d,1h:1y")
+	require.NoError(t, err)
+	i, tier := policies.Lookup("Alloc").Tier(5 * time.Minute)
+	assert.Equal(t, 1, i)
+	assert.Equal(t, time.Minute, tier.Resolution)
+	i, _ = policies.Lookup("GoVersion").Tier(time.Hour)
+	assert.Equal(t, 0, i)
+}
+
+func TestDBBackend_append(t *testing.T) {
+	b := &dbBackend{}
+	ctx := context.Background()
+	for i := 0; i < maxPending; i++ {
+		require.NoError(t, b.append(ctx, "gauge/Alloc", Point{T: int64(i), V: 1}))
+	}
+	assert.ErrorIs(t, b.append(ctx, "gauge/Alloc", Point{T: maxPending, V: 1}), ErrTooManyPending)
+}
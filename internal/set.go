@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"strconv"
+)
+
+const (
+	DefaultSetPrecision = 14
+	minSetPrecision     = 4
+	maxSetPrecision     = 18
+)
+
+// Set estimates the number of unique members with a HyperLogLog sketch
+// of 2^Precision registers.
+type Set struct {
+	Precision uint8  `json:"precision"`
+	Registers []byte `json:"registers"`
+}
+
+func NewSet(precision uint8) Set {
+	return Set{
+		Precision: precision,
+		Registers: make([]byte, 1<<precision),
+	}
+}
+
+func (s Set) GetTypeName() MetricTypeName {
+	return SetName
+}
+
+func (s Set) String() string {
+	return strconv.FormatUint(s.Estimate(), 10)
+}
+
+func (s *Set) Add(member string) {
+	x := hashMember(member)
+	index := x >> (64 - s.Precision)
+	rank := uint8(bits.LeadingZeros64(x<<s.Precision|1<<(s.Precision-1))) + 1
+	if rank > s.Registers[index] {
+		s.Registers[index] = rank
+	}
+}
+
+// Merge keeps the maximum of every register; both sets must have the same precision.
+func (s *Set) Merge(other Set) error {
+	if s.Precision != other.Precision {
+		return fmt.Errorf("set precision mismatch: %d and %d", s.Precision, other.Precision)
+	}
+	for i, rank := range other.Registers {
+		if rank > s.Registers[i] {
+			s.Registers[i] = rank
+		}
+	}
+	return nil
+}
+
+func (s Set) Estimate() uint64 {
+	m := float64(len(s.Registers))
+	if m == 0 {
+		return 0
+	}
+	var alpha float64
+	switch len(s.Registers) {
+	case 16:
+		alpha = 0.673
+	case 32:
+		alpha = 0.697
+	case 64:
+		alpha = 0.709
+	default:
+		alpha = 0.7213 / (1 + 1.079/m)
+	}
+	var sum float64
+	var zeros int
+	for _, rank := range s.Registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+	estimate := alpha * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+func (s Set) Validate() error {
+	if s.Precision < minSetPrecision || s.Precision > maxSetPrecision {
+		return fmt.Errorf("set precision should be between %d and %d", minSetPrecision, maxSetPrecision)
+	}
+	if len(s.Registers) != 1<<s.Precision {
+		return fmt.Errorf("set with precision %d should have %d registers", s.Precision, 1<<s.Precision)
+	}
+	maxRank := uint8(64 - s.Precision + 1)
+	for _, rank := range s.Registers {
+		if rank > maxRank {
+			return fmt.Errorf("set register value %d exceeds %d", rank, maxRank)
+		}
+	}
+	return nil
+}
+
+func (s Set) Clone() Set {
+	return Set{
+		Precision: s.Precision,
+		Registers: append([]byte(nil), s.Registers...),
+	}
+}
+
+// hashMember is FNV-1a followed by the murmur3 finalizer, so that every agent
+// and server restart hashes members the same way.
+func hashMember(member string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(member))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,56 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSet_Estimate(t *testing.T) {
+	tests := []struct {
+		name    string
+		members int
+	}{
+		{name: "empty", members: 0},
+		{name: "small", members: 100},
+		{name: "large", members: 100000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSet(DefaultSetPrecision)
+			for i := 0; i < tt.members; i++ {
+				s.Add(fmt.Sprintf("user-%d", i))
+				s.Add(fmt.Sprintf("user-%d", i))
+			}
+			require.NoError(t, s.Validate())
+			estimate := float64(s.Estimate())
+			assert.LessOrEqual(t, math.Abs(estimate-float64(tt.members)), 0.03*float64(tt.members)+1, "estimate %v", estimate)
+		})
+	}
+}
+
+func TestSet_Merge(t *testing.T) {
+	a := NewSet(DefaultSetPrecision)
+	b := NewSet(DefaultSetPrecision)
+	whole := NewSet(DefaultSetPrecision)
+	for i := 0; i < 1000; i++ {
+		a.Add(fmt.Sprintf("10.0.0.%d", i))
+		b.Add(fmt.Sprintf("10.0.0.%d", i+500))
+		whole.Add(fmt.Sprintf("10.0.0.%d", i))
+		whole.Add(fmt.Sprintf("10.0.0.%d", i+500))
+	}
+	require.NoError(t, a.Merge(b))
+	assert.Equal(t, whole, a)
+	assert.Error(t, a.Merge(NewSet(10)))
+}
+
+func TestSet_Validate(t *testing.T) {
+	assert.Error(t, Set{Precision: 2, Registers: make([]byte, 4)}.Validate())
+	assert.Error(t, Set{Precision: 10, Registers: make([]byte, 16)}.Validate())
+	s := NewSet(10)
+	s.Registers[0] = 60
+	assert.Error(t, s.Validate())
+}
@@ -0,0 +1,177 @@
+package spool
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	errs "github.com/pkg/errors"
+)
+
+const segmentExt = ".seg"
+
+// Spool is a bounded directory of segment files, one batch per segment,
+// replayed in the order they were appended.
+type Spool struct {
+	Dir      string
+	MaxBytes int64
+	MaxAge   time.Duration
+
+	mx       sync.Mutex
+	replayMx sync.Mutex
+	seq      uint64
+	now      func() time.Time
+}
+
+type segment struct {
+	seq     uint64
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func New(dir string, maxBytes int64, maxAge time.Duration) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errs.WithMessage(err, "failed to create spool directory")
+	}
+	s := &Spool{
+		Dir:      dir,
+		MaxBytes: maxBytes,
+		MaxAge:   maxAge,
+		now:      time.Now,
+	}
+	segments, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) > 0 {
+		s.seq = segments[len(segments)-1].seq
+	}
+	return s, nil
+}
+
+// Append stores a batch as the newest segment and evicts the oldest
+// segments exceeding the age and size limits.
+func (s *Spool) Append(batch []byte) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.seq++
+	name := filepath.Join(s.Dir, fmt.Sprintf("%020d%s", s.seq, segmentExt))
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, batch, 0644); err != nil {
+		return errs.WithMessage(err, "failed to write segment")
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return errs.WithMessage(err, "failed to commit segment")
+	}
+	return s.evict()
+}
+
+// Replay calls send for every segment from the oldest to the newest and removes
+// the segment once send succeeds. It stops at the first failed segment.
+// Concurrent calls wait for the replay in progress, so a caller never sends
+// a live batch ahead of older spooled ones.
+func (s *Spool) Replay(send func(batch []byte) error) error {
+	s.replayMx.Lock()
+	defer s.replayMx.Unlock()
+
+	s.mx.Lock()
+	if err := s.evict(); err != nil {
+		s.mx.Unlock()
+		return err
+	}
+	segments, err := s.segments()
+	s.mx.Unlock()
+	if err != nil {
+		return err
+	}
+	for _, seg := range segments {
+		batch, err := os.ReadFile(seg.path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return errs.WithMessage(err, "failed to read segment")
+		}
+		if err = send(batch); err != nil {
+			return err
+		}
+		if err = os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			return errs.WithMessage(err, "failed to remove segment")
+		}
+	}
+	return nil
+}
+
+func (s *Spool) Len() int {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	segments, err := s.segments()
+	if err != nil {
+		return 0
+	}
+	return len(segments)
+}
+
+func (s *Spool) evict() error {
+	segments, err := s.segments()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, seg := range segments {
+		total += seg.size
+	}
+	for _, seg := range segments {
+		expired := s.MaxAge > 0 && s.now().Sub(seg.modTime) > s.MaxAge
+		oversized := s.MaxBytes > 0 && total > s.MaxBytes
+		if !expired && !oversized {
+			break
+		}
+		if err = os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+			return errs.WithMessage(err, "failed to evict segment")
+		}
+		total -= seg.size
+	}
+	return nil
+}
+
+func (s *Spool) segments() ([]segment, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, errs.WithMessage(err, "failed to read spool directory")
+	}
+	segments := make([]segment, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, segmentExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		segments = append(segments, segment{
+			seq:     seq,
+			path:    filepath.Join(s.Dir, name),
+			size:    info.Size(),
+			modTime: info.ModTime(),
+		})
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].seq < segments[j].seq
+	})
+	return segments, nil
+}
@@ -0,0 +1,117 @@
+package spool
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func appendAll(t *testing.T, s *Spool, batches ...string) {
+	for _, batch := range batches {
+		require.NoError(t, s.Append([]byte(batch)))
+	}
+}
+
+func replayAll(s *Spool, failAt int) ([]string, error) {
+	var sent []string
+	err := s.Replay(func(batch []byte) error {
+		if len(sent) == failAt {
+			return errors.New("server unavailable")
+		}
+		sent = append(sent, string(batch))
+		return nil
+	})
+	return sent, err
+}
+
+func TestSpool_Replay(t *testing.T) {
+	s, err := New(t.TempDir(), 0, 0)
+	require.NoError(t, err)
+	appendAll(t, s, "1", "2", "3")
+
+	sent, err := replayAll(s, 1)
+	assert.Error(t, err)
+	assert.Equal(t, []string{"1"}, sent)
+	assert.Equal(t, 2, s.Len())
+
+	sent, err = replayAll(s, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"2", "3"}, sent)
+	assert.Equal(t, 0, s.Len())
+}
+
+func TestSpool_reopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(dir, 0, 0)
+	require.NoError(t, err)
+	appendAll(t, s, "1", "2")
+
+	s, err = New(dir, 0, 0)
+	require.NoError(t, err)
+	appendAll(t, s, "3")
+	sent, err := replayAll(s, -1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3"}, sent)
+}
+
+func TestSpool_limits(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxBytes int64
+		maxAge   time.Duration
+		advance  time.Duration
+		want     []string
+	}{
+		{name: "size limit drops oldest", maxBytes: 8, want: []string{"bbbb", "cccc"}},
+		{name: "age limit drops expired", maxAge: time.Minute, advance: 2 * time.Minute, want: nil},
+		{name: "within limits", maxBytes: 64, maxAge: time.Minute, want: []string{"aaaa", "bbbb", "cccc"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := New(t.TempDir(), tt.maxBytes, tt.maxAge)
+			require.NoError(t, err)
+			appendAll(t, s, "aaaa", "bbbb", "cccc")
+			s.now = func() time.Time { return time.Now().Add(tt.advance) }
+			sent, err := replayAll(s, -1)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, sent)
+		})
+	}
+}
+
+func TestSpool_concurrentReplay(t *testing.T) {
+	s, err := New(t.TempDir(), 0, 0)
+	require.NoError(t, err)
+	appendAll(t, s, "1", "2")
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	first := make(chan error)
+	go func() {
+		first <- s.Replay(func(batch []byte) error {
+			if string(batch) == "1" {
+				close(started)
+				<-release
+			}
+			return nil
+		})
+	}()
+	<-started
+
+	second := make(chan error)
+	go func() {
+		second <- s.Replay(func(batch []byte) error { return nil })
+	}()
+	select {
+	case <-second:
+		t.Fatal("second replay returned while the first was in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	assert.NoError(t, <-first)
+	assert.NoError(t, <-second)
+	assert.Equal(t, 0, s.Len())
+}
@@ -0,0 +1,171 @@
+package statsd
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/logger"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/subnet"
+)
+
+// Sink applies parsed metrics to storage. Keys are series keys with tags as labels.
+type Sink interface {
+	AddCounter(key string, delta internal.Counter)
+	SetGauge(key string, value internal.Gauge)
+	AddGauge(key string, delta internal.Gauge)
+	// ObserveHistogram adds the value to an existing histogram and reports whether there was one.
+	ObserveHistogram(key string, value float64) bool
+	AddMember(key string, member string)
+}
+
+const (
+	maxPacketSize        = 65535
+	defaultFlushInterval = 10 * time.Second
+)
+
+type timerStats struct {
+	name   string
+	tags   internal.Labels
+	values []float64
+	count  float64
+}
+
+// Listener receives StatsD packets on Addr. Timers without a histogram are
+// flushed every FlushInterval as name_mean, name_p90 and name_count gauges.
+type Listener struct {
+	Addr          string
+	FlushInterval time.Duration
+	Sink          Sink
+	// Trusted drops packets from other addresses, empty accepts everyone
+	Trusted subnet.Subnets
+
+	mx     sync.Mutex
+	timers map[string]*timerStats
+}
+
+func (l *Listener) ListenAndServe(ctx context.Context) error {
+	conn, err := net.ListenPacket("udp", l.Addr)
+	if err != nil {
+		return err
+	}
+	return l.Serve(ctx, conn)
+}
+
+func (l *Listener) Serve(ctx context.Context, conn net.PacketConn) error {
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	go func() {
+		l.flushLoop(ctx)
+	}()
+	logger.Log.Infoln("Receiving StatsD on ", conn.LocalAddr())
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		if !l.Trusted.AllowsAddr(addr) {
+			logger.Log.Debugf("dropping statsd packet from untrusted %s", addr)
+			continue
+		}
+		l.HandlePacket(string(buf[:n]))
+	}
+}
+
+func (l *Listener) HandlePacket(packet string) {
+	for _, line := range strings.Split(packet, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		m, err := Parse(line)
+		if err != nil {
+			logger.Log.Warnf("skipping statsd line %q: %v", line, err)
+			continue
+		}
+		l.apply(m)
+	}
+}
+
+func (l *Listener) apply(m Metric) {
+	key := internal.SeriesKey(m.Name, m.Tags)
+	switch m.Type {
+	case Counter:
+		l.Sink.AddCounter(key, internal.Counter(math.Round(m.Value/m.Rate)))
+	case Gauge:
+		if m.Relative {
+			l.Sink.AddGauge(key, internal.Gauge(m.Value))
+		} else {
+			l.Sink.SetGauge(key, internal.Gauge(m.Value))
+		}
+	case Timer, Histogram:
+		if !l.Sink.ObserveHistogram(key, m.Value) {
+			l.observeTimer(key, m)
+		}
+	case Set:
+		l.Sink.AddMember(key, m.Member)
+	}
+}
+
+func (l *Listener) observeTimer(key string, m Metric) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+	if l.timers == nil {
+		l.timers = make(map[string]*timerStats)
+	}
+	stats, ok := l.timers[key]
+	if !ok {
+		stats = &timerStats{name: m.Name, tags: m.Tags}
+		l.timers[key] = stats
+	}
+	stats.values = append(stats.values, m.Value)
+	stats.count += 1 / m.Rate
+}
+
+func (l *Listener) flushLoop(ctx context.Context) {
+	interval := l.FlushInterval
+	if interval <= 0 {
+		interval = defaultFlushInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.Flush()
+		}
+	}
+}
+
+// Flush writes derived gauges of the timers observed since the last flush.
+func (l *Listener) Flush() {
+	l.mx.Lock()
+	timers := l.timers
+	l.timers = nil
+	l.mx.Unlock()
+	for _, stats := range timers {
+		sort.Float64s(stats.values)
+		var sum float64
+		for _, v := range stats.values {
+			sum += v
+		}
+		p90 := stats.values[int(math.Ceil(0.9*float64(len(stats.values))))-1]
+		l.Sink.SetGauge(internal.SeriesKey(stats.name+"_mean", stats.tags), internal.Gauge(sum/float64(len(stats.values))))
+		l.Sink.SetGauge(internal.SeriesKey(stats.name+"_p90", stats.tags), internal.Gauge(p90))
+		l.Sink.SetGauge(internal.SeriesKey(stats.name+"_count", stats.tags), internal.Gauge(stats.count))
+	}
+}
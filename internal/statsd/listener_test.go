@@ -0,0 +1,150 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/logger"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/subnet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSink struct {
+	mx         sync.Mutex
+	counters   map[string]internal.Counter
+	gauges     map[string]internal.Gauge
+	histograms map[string][]float64
+	members    map[string][]string
+}
+
+func newTestSink() *testSink {
+	return &testSink{
+		counters:   make(map[string]internal.Counter),
+		gauges:     make(map[string]internal.Gauge),
+		histograms: map[string][]float64{"payload": nil},
+		members:    make(map[string][]string),
+	}
+}
+
+func (s *testSink) AddCounter(key string, delta internal.Counter) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.counters[key] += delta
+}
+
+func (s *testSink) SetGauge(key string, value internal.Gauge) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.gauges[key] = value
+}
+
+func (s *testSink) AddGauge(key string, delta internal.Gauge) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.gauges[key] += delta
+}
+
+func (s *testSink) ObserveHistogram(key string, value float64) bool {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if _, ok := s.histograms[key]; !ok {
+		return false
+	}
+	s.histograms[key] = append(s.histograms[key], value)
+	return true
+}
+
+func (s *testSink) AddMember(key string, member string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.members[key] = append(s.members[key], member)
+}
+
+func TestListener_HandlePacket(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+	sink := newTestSink()
+	l := &Listener{Sink: sink}
+	l.HandlePacket("hits:2|c|@0.5\nhits:1|c|#env:prod\nqueue:10|g\nqueue:-3|g\nqueue:+1|g\nbroken\n" +
+		"payload:512|h\nusers:bob|s\n")
+	for i := 1; i <= 10; i++ {
+		l.HandlePacket("db.query:" + strconv.Itoa(i) + "|ms|@0.5|#env:prod")
+	}
+	l.Flush()
+
+	assert.Equal(t, map[string]internal.Counter{"hits": 4, `hits{env="prod"}`: 1}, sink.counters)
+	assert.Equal(t, map[string]internal.Gauge{
+		"queue":                      8,
+		`db.query_mean{env="prod"}`:  5.5,
+		`db.query_p90{env="prod"}`:   9,
+		`db.query_count{env="prod"}`: 20,
+	}, sink.gauges)
+	assert.Equal(t, []float64{512}, sink.histograms["payload"])
+	assert.Equal(t, []string{"bob"}, sink.members["users"])
+
+	// flushed timers start over
+	sink.gauges = make(map[string]internal.Gauge)
+	l.Flush()
+	assert.Empty(t, sink.gauges)
+}
+
+func TestListener_Serve(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	sink := newTestSink()
+	l := &Listener{Sink: sink, FlushInterval: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- l.Serve(ctx, conn)
+	}()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.Write([]byte("hits:1|c\nhits:2|c"))
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		sink.mx.Lock()
+		defer sink.mx.Unlock()
+		return sink.counters["hits"] == 3
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestListener_Serve_untrusted(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	trusted, err := subnet.Parse("10.0.0.0/8")
+	require.NoError(t, err)
+	sink := newTestSink()
+	l := &Listener{Sink: sink, FlushInterval: time.Hour, Trusted: trusted}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- l.Serve(ctx, conn)
+	}()
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer client.Close()
+	_, err = client.Write([]byte("hits:1|c"))
+	require.NoError(t, err)
+	assert.Never(t, func() bool {
+		sink.mx.Lock()
+		defer sink.mx.Unlock()
+		return sink.counters["hits"] != 0
+	}, 100*time.Millisecond, 10*time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
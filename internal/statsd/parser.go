@@ -0,0 +1,95 @@
+// Package statsd receives StatsD and DogStatsD metrics over UDP.
+package statsd
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+)
+
+type Type string
+
+const (
+	Counter   Type = "c"
+	Gauge     Type = "g"
+	Timer     Type = "ms"
+	Histogram Type = "h"
+	Set       Type = "s"
+)
+
+type Metric struct {
+	Name string
+	Type Type
+	// Value is the number for every type but sets
+	Value float64
+	// Relative marks a gauge update with an explicit sign, like +3 or -2
+	Relative bool
+	// Member is the value of a set
+	Member string
+	// Rate is the sample rate in (0, 1]
+	Rate float64
+	Tags internal.Labels
+}
+
+// Parse parses a line like name:value|type|@rate|#tag:value,tag.
+func Parse(line string) (Metric, error) {
+	m := Metric{Rate: 1}
+	name, rest, ok := strings.Cut(line, ":")
+	if !ok || name == "" {
+		return m, errors.New("missing metric name")
+	}
+	m.Name = name
+	parts := strings.Split(rest, "|")
+	if len(parts) < 2 {
+		return m, errors.New("missing metric type")
+	}
+	value := parts[0]
+	m.Type = Type(parts[1])
+	for _, part := range parts[2:] {
+		switch {
+		case strings.HasPrefix(part, "@"):
+			rate, err := strconv.ParseFloat(part[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return m, fmt.Errorf("invalid sample rate %q", part[1:])
+			}
+			m.Rate = rate
+		case strings.HasPrefix(part, "#"):
+			m.Tags = parseTags(part[1:])
+		}
+	}
+	switch m.Type {
+	case Set:
+		if value == "" {
+			return m, errors.New("missing set member")
+		}
+		m.Member = value
+		return m, nil
+	case Counter, Gauge, Timer, Histogram:
+	default:
+		return m, fmt.Errorf("unknown metric type %q", m.Type)
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return m, fmt.Errorf("invalid value %q", value)
+	}
+	m.Value = v
+	m.Relative = m.Type == Gauge && (value[0] == '+' || value[0] == '-')
+	return m, nil
+}
+
+// parseTags parses DogStatsD tags; a tag without a value gets an empty one.
+func parseTags(s string) internal.Labels {
+	tags := make(internal.Labels)
+	for _, tag := range strings.Split(s, ",") {
+		if tag == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(tag, ":")
+		tags[name] = value
+	}
+	return tags
+}
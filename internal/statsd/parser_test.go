@@ -0,0 +1,47 @@
+package statsd
+
+import (
+	"testing"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		want    Metric
+		wantErr bool
+	}{
+		{name: "counter", line: "page.views:1|c", want: Metric{Name: "page.views", Type: Counter, Value: 1, Rate: 1}},
+		{name: "sampled counter", line: "page.views:3|c|@0.1", want: Metric{Name: "page.views", Type: Counter, Value: 3, Rate: 0.1}},
+		{name: "gauge", line: "queue.size:42|g", want: Metric{Name: "queue.size", Type: Gauge, Value: 42, Rate: 1}},
+		{name: "gauge increment", line: "queue.size:+3|g", want: Metric{Name: "queue.size", Type: Gauge, Value: 3, Relative: true, Rate: 1}},
+		{name: "gauge decrement", line: "queue.size:-2.5|g", want: Metric{Name: "queue.size", Type: Gauge, Value: -2.5, Relative: true, Rate: 1}},
+		{
+			name: "timer with tags",
+			line: "db.query:320|ms|@0.5|#env:prod,replica",
+			want: Metric{Name: "db.query", Type: Timer, Value: 320, Rate: 0.5, Tags: internal.Labels{"env": "prod", "replica": ""}},
+		},
+		{name: "histogram", line: "payload:1024|h", want: Metric{Name: "payload", Type: Histogram, Value: 1024, Rate: 1}},
+		{name: "set", line: "users:alice|s", want: Metric{Name: "users", Type: Set, Member: "alice", Rate: 1}},
+		{name: "missing type", line: "page.views:1", wantErr: true},
+		{name: "unknown type", line: "page.views:1|x", wantErr: true},
+		{name: "bad value", line: "page.views:lots|c", wantErr: true},
+		{name: "bad rate", line: "page.views:1|c|@2", wantErr: true},
+		{name: "missing name", line: ":1|c", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.line)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
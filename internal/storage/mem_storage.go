@@ -29,10 +29,28 @@ func (ms *MemStorage[T]) Get(key string) (*T, bool) {
 	return value, ok
 }
 
+func (ms *MemStorage[T]) Update(key string, update func(old *T) T) T {
+	ms.mx.Lock()
+	defer ms.mx.Unlock()
+	if ms.storage == nil {
+		ms.storage = make(map[string]*T)
+	}
+	value := update(ms.storage[key])
+	ms.storage[key] = &value
+	return value
+}
+
 func (ms *MemStorage[T]) GetAll() map[string]*T {
 	ms.mx.RLock()
 	defer ms.mx.RUnlock()
-	return ms.storage
+	if ms.storage == nil {
+		return nil
+	}
+	all := make(map[string]*T, len(ms.storage))
+	for k, v := range ms.storage {
+		all[k] = v
+	}
+	return all
 }
 
 func (ms *MemStorage[T]) Init() {
@@ -19,15 +19,21 @@ import (
 var SingletonOperator *Operator
 
 type Operator struct {
-	GaugeStorage   Storage[internal.Gauge]
-	CounterStorage Storage[internal.Counter]
+	GaugeStorage     Storage[internal.Gauge]
+	CounterStorage   Storage[internal.Counter]
+	HistogramStorage Storage[internal.Histogram]
+	SummaryStorage   Storage[internal.Summary]
+	SetStorage       Storage[internal.Set]
 }
 
-func NewOperator(ctx context.Context, gs Storage[internal.Gauge], cs Storage[internal.Counter], restore bool) (*Operator, error) {
+func NewOperator(ctx context.Context, gs Storage[internal.Gauge], cs Storage[internal.Counter], hs Storage[internal.Histogram], ss Storage[internal.Summary], sets Storage[internal.Set], restore bool) (*Operator, error) {
 	if SingletonOperator == nil {
 		SingletonOperator = &Operator{
-			GaugeStorage:   gs,
-			CounterStorage: cs,
+			GaugeStorage:     gs,
+			CounterStorage:   cs,
+			HistogramStorage: hs,
+			SummaryStorage:   ss,
+			SetStorage:       sets,
 		}
 	}
 	if restore {
@@ -40,37 +46,69 @@ func NewOperator(ctx context.Context, gs Storage[internal.Gauge], cs Storage[int
 
 func (o *Operator) GetAllMetrics() []serializer.Metrics {
 	metrics := make([]serializer.Metrics, 0)
-	counterStorage := o.CounterStorage.GetAll()
-	keys := make([]string, 0, len(counterStorage))
-	for k := range counterStorage {
-		keys = append(keys, k)
+	metrics = appendMetrics(metrics, o.CounterStorage, func(m *serializer.Metrics, c *internal.Counter) {
+		m.Delta = c
+	})
+	metrics = appendMetrics(metrics, o.GaugeStorage, func(m *serializer.Metrics, g *internal.Gauge) {
+		m.Value = g
+	})
+	if o.HistogramStorage != nil {
+		metrics = appendMetrics(metrics, o.HistogramStorage, func(m *serializer.Metrics, h *internal.Histogram) {
+			m.Histogram = h
+		})
 	}
-	sort.Strings(keys)
-	for _, key := range keys {
-		c, _ := o.CounterStorage.Get(key)
-		metrics = append(metrics, serializer.Metrics{
-			ID:    key,
-			MType: string(c.GetTypeName()),
-			Delta: c,
+	if o.SummaryStorage != nil {
+		metrics = appendMetrics(metrics, o.SummaryStorage, func(m *serializer.Metrics, s *internal.Summary) {
+			m.Summary = s
 		})
 	}
-	gaugeStorage := o.GaugeStorage.GetAll()
-	keys = make([]string, 0, len(gaugeStorage))
-	for k := range gaugeStorage {
+	if o.SetStorage != nil {
+		metrics = appendMetrics(metrics, o.SetStorage, func(m *serializer.Metrics, s *internal.Set) {
+			m.Set = s
+		})
+	}
+	return metrics
+}
+
+func appendMetrics[T Element](metrics []serializer.Metrics, s Storage[T], setValue func(m *serializer.Metrics, value *T)) []serializer.Metrics {
+	elements := s.GetAll()
+	keys := make([]string, 0, len(elements))
+	for k := range elements {
 		keys = append(keys, k)
 	}
 	sort.Strings(keys)
 	for _, key := range keys {
-		g, _ := o.GaugeStorage.Get(key)
-		metrics = append(metrics, serializer.Metrics{
-			ID:    key,
-			MType: string(g.GetTypeName()),
-			Value: g,
-		})
+		element := elements[key]
+		name, labels, err := internal.ParseSeriesKey(key)
+		if err != nil {
+			logger.Log.Warnf("skipping series %q: %v", key, err)
+			continue
+		}
+		m := serializer.Metrics{
+			ID:     name,
+			MType:  string((*element).GetTypeName()),
+			Labels: labels,
+		}
+		setValue(&m, element)
+		metrics = append(metrics, m)
 	}
 	return metrics
 }
 
+func (o *Operator) FilterMetrics(filter internal.Labels) []serializer.Metrics {
+	metrics := o.GetAllMetrics()
+	if len(filter) == 0 {
+		return metrics
+	}
+	filtered := make([]serializer.Metrics, 0, len(metrics))
+	for _, m := range metrics {
+		if m.Labels.Match(filter) {
+			filtered = append(filtered, m)
+		}
+	}
+	return filtered
+}
+
 func (o *Operator) SaveAllMetrics(ctx context.Context) error {
 	switch o.CounterStorage.(type) {
 	case *FileStorage[internal.Counter]:
@@ -163,7 +201,8 @@ func (o *Operator) saveAllMetricsToDB(ctx context.Context) error {
 			return err
 		}
 		defer stmt.Close()
-		rows, err := stmt.QueryContext(ctx, m.ID)
+		key := internal.SeriesKey(m.ID, m.Labels)
+		rows, err := stmt.QueryContext(ctx, key)
 		if err != nil {
 			return err
 		}
@@ -178,15 +217,20 @@ func (o *Operator) saveAllMetricsToDB(ctx context.Context) error {
 			}
 		}
 		if id != "" {
-			stmt, err = tx.PrepareContext(ctx, "UPDATE metrics SET mtype = $1, delta = $2, mvalue = $3 WHERE id = $4")
+			stmt, err = tx.PrepareContext(ctx, "UPDATE metrics SET mtype = $1, delta = $2, mvalue = $3, mdata = $4 WHERE id = $5")
 		} else {
-			stmt, err = tx.PrepareContext(ctx, "INSERT INTO metrics (mtype, delta, mvalue, id) VALUES ($1, $2, $3, $4)")
+			stmt, err = tx.PrepareContext(ctx, "INSERT INTO metrics (mtype, delta, mvalue, mdata, id) VALUES ($1, $2, $3, $4, $5)")
 		}
 		if err != nil {
 			return err
 		}
 		defer stmt.Close()
-		_, err = stmt.ExecContext(ctx, m.MType, m.Delta, m.Value, m.ID)
+		var data sql.NullString
+		data, err = encodeData(m)
+		if err != nil {
+			return err
+		}
+		_, err = stmt.ExecContext(ctx, m.MType, m.Delta, m.Value, data, key)
 		if err != nil {
 			return err
 		}
@@ -219,14 +263,7 @@ func (o *Operator) loadMetricsFromFile() error {
 			return errs.WithMessage(err, "failed to unmarshal metrics")
 		}
 	}
-	for _, m := range metrics {
-		switch m.MType {
-		case string(internal.GaugeName):
-			o.GaugeStorage.Set(m.ID, *m.Value)
-		case string(internal.CounterName):
-			o.CounterStorage.Set(m.ID, *m.Delta)
-		}
-	}
+	o.setMetrics(metrics)
 	return nil
 }
 
@@ -239,30 +276,100 @@ func (o *Operator) loadMetricsFromDB(ctx context.Context) error {
 		return errs.WithMessage(errors.New("unsupported storage"), "unsupported storage")
 	}
 	metrics := make([]serializer.Metrics, 0)
-	rows, err := db.QueryContext(ctx, "SELECT id, mtype, delta, mvalue FROM metrics")
+	rows, err := db.QueryContext(ctx, "SELECT id, mtype, delta, mvalue, mdata FROM metrics")
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var m serializer.Metrics
-		err = rows.Scan(&m.ID, &m.MType, &m.Delta, &m.Value)
+		var data sql.NullString
+		err = rows.Scan(&m.ID, &m.MType, &m.Delta, &m.Value, &data)
 		if err != nil {
 			return err
 		}
+		if err = decodeData(&m, data); err != nil {
+			return err
+		}
 		metrics = append(metrics, m)
 	}
 	if rows.Err() != nil {
 		return rows.Err()
 	}
+	o.setMetrics(metrics)
+	return nil
+}
+
+func (o *Operator) setMetrics(metrics []serializer.Metrics) {
 	for _, m := range metrics {
+		key := internal.SeriesKey(m.ID, m.Labels)
 		switch m.MType {
 		case string(internal.GaugeName):
-			o.GaugeStorage.Set(m.ID, *m.Value)
+			o.GaugeStorage.Set(key, *m.Value)
 		case string(internal.CounterName):
-			o.CounterStorage.Set(m.ID, *m.Delta)
+			o.CounterStorage.Set(key, *m.Delta)
+		case string(internal.HistogramName):
+			if o.HistogramStorage != nil && m.Histogram != nil {
+				o.HistogramStorage.Set(key, *m.Histogram)
+			}
+		case string(internal.SummaryName):
+			if o.SummaryStorage != nil && m.Summary != nil {
+				o.SummaryStorage.Set(key, *m.Summary)
+			}
+		case string(internal.SetName):
+			if o.SetStorage != nil && m.Set != nil {
+				o.SetStorage.Set(key, *m.Set)
+			}
+		}
+	}
+}
+
+// encodeData serializes values of metric types that don't fit delta and mvalue columns.
+func encodeData(m serializer.Metrics) (sql.NullString, error) {
+	var data any
+	switch m.MType {
+	case string(internal.HistogramName):
+		if m.Histogram != nil {
+			data = m.Histogram
+		}
+	case string(internal.SummaryName):
+		if m.Summary != nil {
+			data = m.Summary
+		}
+	case string(internal.SetName):
+		if m.Set != nil {
+			data = m.Set
 		}
 	}
+	if data == nil {
+		return sql.NullString{}, nil
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return sql.NullString{}, errs.WithMessagef(err, "failed to marshal %s %s", m.MType, m.ID)
+	}
+	return sql.NullString{String: string(b), Valid: true}, nil
+}
+
+func decodeData(m *serializer.Metrics, data sql.NullString) error {
+	if !data.Valid {
+		return nil
+	}
+	var err error
+	switch m.MType {
+	case string(internal.HistogramName):
+		m.Histogram = &internal.Histogram{}
+		err = json.Unmarshal([]byte(data.String), m.Histogram)
+	case string(internal.SummaryName):
+		m.Summary = &internal.Summary{}
+		err = json.Unmarshal([]byte(data.String), m.Summary)
+	case string(internal.SetName):
+		m.Set = &internal.Set{}
+		err = json.Unmarshal([]byte(data.String), m.Set)
+	}
+	if err != nil {
+		return errs.WithMessagef(err, "failed to unmarshal %s %s", m.MType, m.ID)
+	}
 	return nil
 }
 
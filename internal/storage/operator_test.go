@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newFileOperator(path string) *Operator {
+	return &Operator{
+		GaugeStorage:     &FileStorage[internal.Gauge]{MemStorage: &MemStorage[internal.Gauge]{}, FilePath: path},
+		CounterStorage:   &FileStorage[internal.Counter]{MemStorage: &MemStorage[internal.Counter]{}, FilePath: path},
+		HistogramStorage: &FileStorage[internal.Histogram]{MemStorage: &MemStorage[internal.Histogram]{}, FilePath: path},
+		SummaryStorage:   &FileStorage[internal.Summary]{MemStorage: &MemStorage[internal.Summary]{}, FilePath: path},
+		SetStorage:       NewSetStorage(&FileStorage[internal.Set]{MemStorage: &MemStorage[internal.Set]{}, FilePath: path}, 0),
+	}
+}
+
+func TestOperator_fileRoundTrip(t *testing.T) {
+	require.NoError(t, logger.Initialize("error"))
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	ctx := context.Background()
+
+	histogram := internal.NewHistogram([]float64{1, 5})
+	histogram.Observe(3)
+	summary := internal.NewSummary(internal.DefaultSummaryAccuracy)
+	summary.Observe(-1)
+	summary.Observe(2)
+	saved := newFileOperator(path)
+	saved.GaugeStorage.Set(internal.SeriesKey("Alloc", internal.Labels{"host": "a"}), 1.5)
+	// names that look like keys or break them up survive the round trip
+	saved.GaugeStorage.Set(internal.SeriesKey(`Alloc{host="a"}`, nil), 2.5)
+	saved.GaugeStorage.Set(internal.SeriesKey("Free", internal.Labels{"a=b,c}": "1"}), 3.5)
+	saved.CounterStorage.Set("PollCount", 10)
+	saved.HistogramStorage.Set("Latency", histogram)
+	saved.SummaryStorage.Set("Duration", summary)
+	saved.SetStorage.(*SetStorage).Add("Visitors", "alice", "bob")
+	require.NoError(t, saved.SaveAllMetrics(ctx))
+
+	loaded := newFileOperator(path)
+	require.NoError(t, loaded.LoadMetrics(ctx))
+	assert.Equal(t, saved.GetAllMetrics(), loaded.GetAllMetrics())
+
+	value, ok := loaded.GaugeStorage.Get(`Alloc{host="a"}`)
+	require.True(t, ok)
+	assert.Equal(t, internal.Gauge(1.5), *value)
+	assert.Len(t, loaded.GetAllMetrics(), 7)
+	value, ok = loaded.GaugeStorage.Get(internal.SeriesKey(`Alloc{host="a"}`, nil))
+	require.True(t, ok)
+	assert.Equal(t, internal.Gauge(2.5), *value)
+	visitors, ok := loaded.SetStorage.Get("Visitors")
+	require.True(t, ok)
+	assert.Equal(t, uint64(2), visitors.Estimate())
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"sync"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+)
+
+// SetStorage keeps a HyperLogLog sketch per series on top of any backend and
+// updates sketches atomically, so concurrent agents never lose each other's members.
+type SetStorage struct {
+	Storage[internal.Set]
+	Precision uint8
+	mx        sync.Mutex
+}
+
+func NewSetStorage(backend Storage[internal.Set], precision uint8) *SetStorage {
+	if precision == 0 {
+		precision = internal.DefaultSetPrecision
+	}
+	return &SetStorage{
+		Storage:   backend,
+		Precision: precision,
+	}
+}
+
+func (s *SetStorage) Add(key string, members ...string) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	set := s.load(key)
+	for _, member := range members {
+		set.Add(member)
+	}
+	s.Storage.Set(key, set)
+}
+
+func (s *SetStorage) Merge(key string, other internal.Set) error {
+	if err := other.Validate(); err != nil {
+		return err
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	set, ok := s.Storage.Get(key)
+	if !ok {
+		s.Storage.Set(key, other.Clone())
+		return nil
+	}
+	merged := set.Clone()
+	if err := merged.Merge(other); err != nil {
+		return err
+	}
+	s.Storage.Set(key, merged)
+	return nil
+}
+
+func (s *SetStorage) load(key string) internal.Set {
+	if set, ok := s.Storage.Get(key); ok {
+		return set.Clone()
+	}
+	return internal.NewSet(s.Precision)
+}
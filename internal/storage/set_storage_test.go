@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetStorage_concurrentAgents(t *testing.T) {
+	s := NewSetStorage(&MemStorage[internal.Set]{}, 0)
+	var wg sync.WaitGroup
+	for agent := 0; agent < 4; agent++ {
+		wg.Add(1)
+		go func(agent int) {
+			defer wg.Done()
+			sketch := internal.NewSet(internal.DefaultSetPrecision)
+			for i := 0; i < 250; i++ {
+				// agents overlap on half of their members
+				sketch.Add(fmt.Sprintf("user-%d", agent*125+i))
+				s.Add("Users", fmt.Sprintf("direct-%d-%d", agent, i))
+			}
+			assert.NoError(t, s.Merge("Users", sketch))
+		}(agent)
+	}
+	wg.Wait()
+
+	users, ok := s.Get("Users")
+	require.True(t, ok)
+	assert.InDelta(t, 625+1000, float64(users.Estimate()), 50)
+	assert.Error(t, s.Merge("Users", internal.NewSet(10)))
+}
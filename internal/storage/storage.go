@@ -1,9 +1,16 @@
 package storage
 
 import (
+	"errors"
+
 	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
 )
 
+var (
+	ErrNotFound  = errors.New("element not found")
+	ErrAmbiguous = errors.New("several series match, specify more labels")
+)
+
 type Element interface {
 	internal.MetricType
 	String() string
@@ -13,5 +20,32 @@ type Storage[T Element] interface {
 	Set(key string, value T)
 	Get(key string) (*T, bool)
 	GetAll() map[string]*T
+	// Update atomically replaces the value with update's result; old is nil for a new key.
+	Update(key string, update func(old *T) T) T
 	String() string
 }
+
+// Find looks up the series with the exact name and labels first and falls back
+// to the only series of that name whose labels contain the filter.
+func Find[T Element](s Storage[T], name string, filter internal.Labels) (string, *T, error) {
+	key := internal.SeriesKey(name, filter)
+	if value, ok := s.Get(key); ok {
+		return key, value, nil
+	}
+	var foundKey string
+	var found *T
+	for k, v := range s.GetAll() {
+		seriesName, labels, err := internal.ParseSeriesKey(k)
+		if err != nil || seriesName != name || !labels.Match(filter) {
+			continue
+		}
+		if found != nil {
+			return "", nil, ErrAmbiguous
+		}
+		foundKey, found = k, v
+	}
+	if found == nil {
+		return "", nil, ErrNotFound
+	}
+	return foundKey, found, nil
+}
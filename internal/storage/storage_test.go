@@ -4,6 +4,7 @@ import (
 	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
 	"github.com/stretchr/testify/assert"
 	"reflect"
+	"sync"
 	"testing"
 )
 
@@ -173,3 +174,24 @@ func TestMemStorage_Set(t *testing.T) {
 		})
 	}
 }
+
+func TestMemStorage_Update(t *testing.T) {
+	ms := &MemStorage[internal.Gauge]{}
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ms.Update("Temperature", func(old *internal.Gauge) internal.Gauge {
+				if old == nil {
+					return 0.5
+				}
+				return *old + 0.5
+			})
+		}()
+	}
+	wg.Wait()
+	element, ok := ms.Get("Temperature")
+	assert.True(t, ok)
+	assert.Equal(t, internal.Gauge(50), *element)
+}
@@ -0,0 +1,138 @@
+// Package stream fans accepted metric updates out to live subscribers.
+package stream
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/serializer"
+)
+
+const DefaultBufferSize = 256
+
+// Filter selects metrics by type, name and labels. Empty fields match everything.
+type Filter struct {
+	Type   internal.MetricTypeName
+	Prefix string
+	// Glob is a path.Match pattern for the whole name, e.g. Heap*
+	Glob   string
+	Labels internal.Labels
+	// Scope limits names to any of these prefixes, e.g. those of a scoped token
+	Scope []string
+}
+
+func (f Filter) Validate() error {
+	if _, err := path.Match(f.Glob, ""); err != nil {
+		return errors.New("name should be a valid glob pattern")
+	}
+	return nil
+}
+
+func (f Filter) Match(m serializer.Metrics) bool {
+	if f.Type != "" && internal.MetricTypeName(m.MType) != f.Type {
+		return false
+	}
+	if !strings.HasPrefix(m.ID, f.Prefix) {
+		return false
+	}
+	if f.Glob != "" {
+		if ok, _ := path.Match(f.Glob, m.ID); !ok {
+			return false
+		}
+	}
+	if len(f.Scope) > 0 && !hasAnyPrefix(m.ID, f.Scope) {
+		return false
+	}
+	return m.Labels.Match(f.Labels)
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type Subscription struct {
+	filter  Filter
+	ch      chan serializer.Metrics
+	dropped atomic.Uint64
+}
+
+// C delivers matching metrics until the subscription is cancelled.
+func (s *Subscription) C() <-chan serializer.Metrics {
+	return s.ch
+}
+
+// Dropped returns the number of metrics dropped because the buffer was full
+// since the previous call.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Swap(0)
+}
+
+// Hub delivers published metrics to every subscription whose filter matches.
+// A subscriber that doesn't keep up loses metrics instead of blocking Publish.
+type Hub struct {
+	BufferSize int
+
+	mx            sync.RWMutex
+	subscriptions map[*Subscription]struct{}
+}
+
+func NewHub(bufferSize int) *Hub {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return &Hub{
+		BufferSize:    bufferSize,
+		subscriptions: make(map[*Subscription]struct{}),
+	}
+}
+
+func (h *Hub) Subscribe(filter Filter) *Subscription {
+	s := &Subscription{
+		filter: filter,
+		ch:     make(chan serializer.Metrics, h.BufferSize),
+	}
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	h.subscriptions[s] = struct{}{}
+	return s
+}
+
+// Cancel removes a subscription and closes its channel.
+func (h *Hub) Cancel(s *Subscription) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	if _, ok := h.subscriptions[s]; ok {
+		delete(h.subscriptions, s)
+		close(s.ch)
+	}
+}
+
+func (h *Hub) Publish(m serializer.Metrics) {
+	h.mx.RLock()
+	defer h.mx.RUnlock()
+	for s := range h.subscriptions {
+		if !s.filter.Match(m) {
+			continue
+		}
+		select {
+		case s.ch <- m:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+func (h *Hub) Len() int {
+	h.mx.RLock()
+	defer h.mx.RUnlock()
+	return len(h.subscriptions)
+}
@@ -0,0 +1,62 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal"
+	"github.com/krm-shrftdnv/go-musthave-metrics/internal/serializer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter_Match(t *testing.T) {
+	heapAlloc := serializer.NewGauge("HeapAlloc", 1)
+	heapAlloc.Labels = internal.Labels{"host": "a", "env": "prod"}
+	pollCount := serializer.NewCounter("PollCount", 1)
+	tests := []struct {
+		name   string
+		filter Filter
+		metric serializer.Metrics
+		want   bool
+	}{
+		{name: "empty", filter: Filter{}, metric: pollCount, want: true},
+		{name: "type", filter: Filter{Type: internal.GaugeName}, metric: pollCount, want: false},
+		{name: "prefix", filter: Filter{Prefix: "Heap"}, metric: heapAlloc, want: true},
+		{name: "other prefix", filter: Filter{Prefix: "Heap"}, metric: pollCount, want: false},
+		{name: "glob", filter: Filter{Glob: "*Alloc"}, metric: heapAlloc, want: true},
+		{name: "glob matches whole name", filter: Filter{Glob: "Heap"}, metric: heapAlloc, want: false},
+		{name: "labels", filter: Filter{Labels: internal.Labels{"host": "a"}}, metric: heapAlloc, want: true},
+		{name: "other labels", filter: Filter{Labels: internal.Labels{"host": "b"}}, metric: heapAlloc, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.filter.Match(tt.metric))
+		})
+	}
+	assert.Error(t, Filter{Glob: "[Heap"}.Validate())
+}
+
+func TestHub(t *testing.T) {
+	hub := NewHub(2)
+	slow := hub.Subscribe(Filter{})
+	gauges := hub.Subscribe(Filter{Type: internal.GaugeName})
+	for i := 0; i < 5; i++ {
+		hub.Publish(serializer.NewCounter("PollCount", internal.Counter(i)))
+	}
+	hub.Publish(serializer.NewGauge("Alloc", 1))
+
+	assert.Equal(t, uint64(4), slow.Dropped())
+	assert.Equal(t, uint64(0), slow.Dropped())
+	m := <-slow.C()
+	assert.Equal(t, internal.Counter(0), *m.Delta)
+	m = <-gauges.C()
+	assert.Equal(t, "Alloc", m.ID)
+
+	hub.Cancel(slow)
+	hub.Cancel(slow)
+	_, ok := <-slow.C()
+	require.True(t, ok, "buffered metrics are still delivered")
+	_, ok = <-slow.C()
+	assert.False(t, ok)
+	assert.Equal(t, 1, hub.Len())
+}
@@ -0,0 +1,190 @@
+// Package subnet restricts updates to clients from trusted subnets. Clients are
+// identified by the X-Real-IP header they send, or their address without it.
+// StatsD and Graphite senders have no header and are checked by address.
+package subnet
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	customHttp "github.com/krm-shrftdnv/go-musthave-metrics/internal/http"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	Header = "X-Real-IP"
+	// metadataKey carries the header over gRPC, where keys are lowercase
+	metadataKey = "x-real-ip"
+)
+
+// Subnets is a list of trusted networks. An empty list trusts everyone.
+type Subnets []*net.IPNet
+
+// Parse reads comma-separated CIDRs. A bare address stands for itself alone.
+func Parse(s string) (Subnets, error) {
+	var subnets Subnets
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.Contains(part, "/") {
+			ip := net.ParseIP(part)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted subnet %q", part)
+			}
+			bits := 8 * len(ip.To4())
+			if bits == 0 {
+				bits = 8 * net.IPv6len
+			}
+			part = fmt.Sprintf("%s/%d", part, bits)
+		}
+		_, ipNet, err := net.ParseCIDR(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted subnet %q: %w", part, err)
+		}
+		subnets = append(subnets, ipNet)
+	}
+	return subnets, nil
+}
+
+func (s Subnets) Contains(ip net.IP) bool {
+	for _, ipNet := range s {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// allows checks the X-Real-IP value, or the remote address when it's empty.
+func (s Subnets) allows(realIP string, remoteAddr string) bool {
+	if len(s) == 0 {
+		return true
+	}
+	addr := realIP
+	if addr == "" {
+		host, _, err := net.SplitHostPort(remoteAddr)
+		if err != nil {
+			host = remoteAddr
+		}
+		addr = host
+	}
+	ip := net.ParseIP(strings.TrimSpace(addr))
+	return ip != nil && s.Contains(ip)
+}
+
+// AllowsAddr checks the peer address of a UDP or TCP listener.
+func (s Subnets) AllowsAddr(addr net.Addr) bool {
+	if addr == nil {
+		return len(s) == 0
+	}
+	return s.allows("", addr.String())
+}
+
+// Trusted answers 403 to clients outside the subnets.
+func Trusted(subnets Subnets) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		trustedFn := func(w http.ResponseWriter, r *http.Request) {
+			if !subnets.allows(r.Header.Get(Header), r.RemoteAddr) {
+				http.Error(w, "client is not in a trusted subnet", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(trustedFn)
+	}
+}
+
+func grpcAllows(ctx context.Context, subnets Subnets) bool {
+	var realIP, remoteAddr string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(metadataKey); len(values) > 0 {
+			realIP = values[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		remoteAddr = p.Addr.String()
+	}
+	return subnets.allows(realIP, remoteAddr)
+}
+
+// NewUnaryInterceptor restricts the given methods, e.g. "/metrics.Metrics/UpdateMetrics".
+func NewUnaryInterceptor(subnets Subnets, methods ...string) grpc.UnaryServerInterceptor {
+	restricted := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		restricted[m] = true
+	}
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if restricted[info.FullMethod] && !grpcAllows(ctx, subnets) {
+			return nil, status.Error(codes.PermissionDenied, "client is not in a trusted subnet")
+		}
+		return handler(ctx, req)
+	}
+}
+
+func NewStreamInterceptor(subnets Subnets, methods ...string) grpc.StreamServerInterceptor {
+	restricted := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		restricted[m] = true
+	}
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if restricted[info.FullMethod] && !grpcAllows(ss.Context(), subnets) {
+			return status.Error(codes.PermissionDenied, "client is not in a trusted subnet")
+		}
+		return handler(srv, ss)
+	}
+}
+
+// OutboundIP finds the local address used to reach addr. Dialing UDP only picks
+// a route, no packets are sent.
+func OutboundIP(addr string) (net.IP, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	conn, err := net.Dial("udp", net.JoinHostPort(host, port))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+// RealIPRequest sets X-Real-IP on outgoing requests.
+func RealIPRequest(ip net.IP) customHttp.Middleware {
+	if ip == nil {
+		return nil
+	}
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return customHttp.InternalRoundTripper(func(req *http.Request) (*http.Response, error) {
+			header := req.Header
+			if header == nil {
+				header = make(http.Header)
+			}
+			header.Set(Header, ip.String())
+			req.Header = header
+			return rt.RoundTrip(req)
+		})
+	}
+}
+
+// RealIPUnaryRequest sets the x-real-ip metadata on outgoing calls.
+func RealIPUnaryRequest(ip net.IP) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if ip != nil {
+			ctx = metadata.AppendToOutgoingContext(ctx, metadataKey, ip.String())
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -0,0 +1,124 @@
+package subnet
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	customHttp "github.com/krm-shrftdnv/go-musthave-metrics/internal/http"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty", s: ""},
+		{name: "single", s: "192.168.1.0/24", want: []string{"192.168.1.0/24"}},
+		{name: "list", s: "10.0.0.0/8, 172.16.0.0/12,", want: []string{"10.0.0.0/8", "172.16.0.0/12"}},
+		{name: "bare addresses", s: "10.1.2.3,::1", want: []string{"10.1.2.3/32", "::1/128"}},
+		{name: "invalid", s: "10.0.0.0/33", wantErr: true},
+		{name: "not an address", s: "agents", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subnets, err := Parse(tt.s)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			var got []string
+			for _, s := range subnets {
+				got = append(got, s.String())
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSubnets_AllowsAddr(t *testing.T) {
+	subnets, err := Parse("10.0.0.0/8")
+	require.NoError(t, err)
+	assert.True(t, subnets.AllowsAddr(&net.UDPAddr{IP: net.ParseIP("10.1.2.3"), Port: 8125}))
+	assert.False(t, subnets.AllowsAddr(&net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 2003}))
+	assert.False(t, subnets.AllowsAddr(nil))
+	assert.True(t, Subnets(nil).AllowsAddr(&net.TCPAddr{IP: net.ParseIP("192.168.1.1"), Port: 2003}))
+}
+
+func TestTrusted(t *testing.T) {
+	subnets, err := Parse("192.168.1.0/24")
+	require.NoError(t, err)
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name       string
+		subnets    Subnets
+		realIP     string
+		remoteAddr string
+		code       int
+	}{
+		{name: "trusted header", subnets: subnets, realIP: "192.168.1.7", remoteAddr: "10.0.0.1:5000", code: http.StatusOK},
+		{name: "untrusted header", subnets: subnets, realIP: "192.168.2.7", remoteAddr: "192.168.1.1:5000", code: http.StatusForbidden},
+		{name: "invalid header", subnets: subnets, realIP: "agent", remoteAddr: "192.168.1.1:5000", code: http.StatusForbidden},
+		{name: "trusted remote address", subnets: subnets, remoteAddr: "192.168.1.1:5000", code: http.StatusOK},
+		{name: "untrusted remote address", subnets: subnets, remoteAddr: "10.0.0.1:5000", code: http.StatusForbidden},
+		{name: "no subnets", realIP: "10.0.0.1", remoteAddr: "10.0.0.1:5000", code: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/updates", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				req.Header.Set(Header, tt.realIP)
+			}
+			w := httptest.NewRecorder()
+			Trusted(tt.subnets)(next).ServeHTTP(w, req)
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+}
+
+func TestNewUnaryInterceptor(t *testing.T) {
+	subnets, err := Parse("192.168.1.0/24")
+	require.NoError(t, err)
+	interceptor := NewUnaryInterceptor(subnets, "/metrics.Metrics/UpdateMetrics")
+	handler := func(ctx context.Context, req any) (any, error) { return "ok", nil }
+	untrusted := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5000}})
+
+	_, err = interceptor(untrusted, nil, &grpc.UnaryServerInfo{FullMethod: "/metrics.Metrics/UpdateMetrics"}, handler)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = interceptor(untrusted, nil, &grpc.UnaryServerInfo{FullMethod: "/metrics.Metrics/GetMetric"}, handler)
+	assert.NoError(t, err)
+	trusted := metadata.NewIncomingContext(untrusted, metadata.Pairs(metadataKey, "192.168.1.7"))
+	_, err = interceptor(trusted, nil, &grpc.UnaryServerInfo{FullMethod: "/metrics.Metrics/UpdateMetrics"}, handler)
+	assert.NoError(t, err)
+}
+
+func TestRealIPRequest(t *testing.T) {
+	ip, err := OutboundIP("127.0.0.1:8080")
+	require.NoError(t, err)
+	assert.Equal(t, "127.0.0.1", ip.String())
+
+	var realIP string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		realIP = r.Header.Get(Header)
+	}))
+	defer srv.Close()
+	client := http.Client{Transport: customHttp.Chain(nil, RealIPRequest(ip))}
+	resp, err := client.Post(srv.URL, "application/json", nil)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "127.0.0.1", realIP)
+}
@@ -0,0 +1,204 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const DefaultSummaryAccuracy = 0.01
+
+var summaryQuantiles = []float64{0.5, 0.9, 0.99}
+
+// Summary is a DDSketch: a mergeable quantile sketch that answers quantile
+// queries with a relative error bounded by Alpha.
+type Summary struct {
+	Alpha        float64        `json:"alpha"`
+	Bins         map[int]uint64 `json:"bins,omitempty"`
+	NegativeBins map[int]uint64 `json:"negative_bins,omitempty"`
+	Zeros        uint64         `json:"zeros,omitempty"`
+	Count        uint64         `json:"count"`
+	Sum          float64        `json:"sum"`
+	Min          float64        `json:"min"`
+	Max          float64        `json:"max"`
+}
+
+func NewSummary(alpha float64) Summary {
+	return Summary{
+		Alpha:        alpha,
+		Bins:         make(map[int]uint64),
+		NegativeBins: make(map[int]uint64),
+	}
+}
+
+func (s Summary) GetTypeName() MetricTypeName {
+	return SummaryName
+}
+
+func (s Summary) String() string {
+	sb := strings.Builder{}
+	sb.WriteString("count=")
+	sb.WriteString(strconv.FormatUint(s.Count, 10))
+	sb.WriteString(" sum=")
+	sb.WriteString(strconv.FormatFloat(s.Sum, 'f', -1, 64))
+	for _, q := range summaryQuantiles {
+		value, err := s.Quantile(q)
+		if err != nil {
+			continue
+		}
+		sb.WriteString(" p")
+		sb.WriteString(strconv.FormatFloat(q*100, 'f', -1, 64))
+		sb.WriteByte('=')
+		sb.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	}
+	return sb.String()
+}
+
+func (s Summary) gamma() float64 {
+	return (1 + s.Alpha) / (1 - s.Alpha)
+}
+
+func (s Summary) index(v float64) int {
+	return int(math.Ceil(math.Log(v) / math.Log(s.gamma())))
+}
+
+func (s Summary) value(index int) float64 {
+	gamma := s.gamma()
+	return 2 * math.Pow(gamma, float64(index)) / (gamma + 1)
+}
+
+func (s *Summary) Observe(v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	if s.Bins == nil {
+		s.Bins = make(map[int]uint64)
+	}
+	if s.NegativeBins == nil {
+		s.NegativeBins = make(map[int]uint64)
+	}
+	switch {
+	case v > 0:
+		s.Bins[s.index(v)]++
+	case v < 0:
+		s.NegativeBins[s.index(-v)]++
+	default:
+		s.Zeros++
+	}
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.Count++
+	s.Sum += v
+}
+
+// Merge adds bins of other; both sketches must have the same accuracy.
+func (s *Summary) Merge(other Summary) error {
+	if s.Alpha != other.Alpha {
+		return errors.New("summary accuracy mismatch")
+	}
+	if other.Count == 0 {
+		return nil
+	}
+	if s.Bins == nil {
+		s.Bins = make(map[int]uint64)
+	}
+	if s.NegativeBins == nil {
+		s.NegativeBins = make(map[int]uint64)
+	}
+	for i, count := range other.Bins {
+		s.Bins[i] += count
+	}
+	for i, count := range other.NegativeBins {
+		s.NegativeBins[i] += count
+	}
+	if s.Count == 0 || other.Min < s.Min {
+		s.Min = other.Min
+	}
+	if s.Count == 0 || other.Max > s.Max {
+		s.Max = other.Max
+	}
+	s.Zeros += other.Zeros
+	s.Count += other.Count
+	s.Sum += other.Sum
+	return nil
+}
+
+func (s Summary) Quantile(q float64) (float64, error) {
+	if q < 0 || q > 1 || math.IsNaN(q) {
+		return 0, errors.New("quantile should be between 0 and 1")
+	}
+	if s.Count == 0 {
+		return 0, errors.New("summary is empty")
+	}
+	rank := uint64(q * float64(s.Count-1))
+
+	negative := sortedIndexes(s.NegativeBins)
+	var seen uint64
+	for i := len(negative) - 1; i >= 0; i-- {
+		seen += s.NegativeBins[negative[i]]
+		if seen > rank {
+			return s.clamp(-s.value(negative[i])), nil
+		}
+	}
+	seen += s.Zeros
+	if seen > rank {
+		return 0, nil
+	}
+	for _, i := range sortedIndexes(s.Bins) {
+		seen += s.Bins[i]
+		if seen > rank {
+			return s.clamp(s.value(i)), nil
+		}
+	}
+	return s.Max, nil
+}
+
+func (s Summary) clamp(v float64) float64 {
+	return math.Max(s.Min, math.Min(s.Max, v))
+}
+
+func (s Summary) Validate() error {
+	if s.Alpha <= 0 || s.Alpha >= 1 {
+		return errors.New("summary accuracy should be between 0 and 1")
+	}
+	total := s.Zeros
+	for _, count := range s.Bins {
+		total += count
+	}
+	for _, count := range s.NegativeBins {
+		total += count
+	}
+	if total != s.Count {
+		return fmt.Errorf("summary count %d should be equal to the sum of bin counts %d", s.Count, total)
+	}
+	return nil
+}
+
+func (s Summary) Clone() Summary {
+	clone := s
+	clone.Bins = make(map[int]uint64, len(s.Bins))
+	for i, count := range s.Bins {
+		clone.Bins[i] = count
+	}
+	clone.NegativeBins = make(map[int]uint64, len(s.NegativeBins))
+	for i, count := range s.NegativeBins {
+		clone.NegativeBins[i] = count
+	}
+	return clone
+}
+
+func sortedIndexes(bins map[int]uint64) []int {
+	indexes := make([]int, 0, len(bins))
+	for i := range bins {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
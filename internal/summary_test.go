@@ -0,0 +1,67 @@
+package internal
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSummary_Quantile(t *testing.T) {
+	s := NewSummary(DefaultSummaryAccuracy)
+	for i := 1; i <= 1000; i++ {
+		s.Observe(float64(i))
+	}
+	require.NoError(t, s.Validate())
+	tests := []struct {
+		q    float64
+		want float64
+	}{
+		{q: 0, want: 1},
+		{q: 0.5, want: 500},
+		{q: 0.99, want: 990},
+		{q: 1, want: 1000},
+	}
+	for _, tt := range tests {
+		got, err := s.Quantile(tt.q)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, math.Abs(got-tt.want)/tt.want, DefaultSummaryAccuracy+0.001, "q=%v got %v want %v", tt.q, got, tt.want)
+	}
+
+	_, err := s.Quantile(1.5)
+	assert.Error(t, err)
+	_, err = NewSummary(DefaultSummaryAccuracy).Quantile(0.5)
+	assert.Error(t, err)
+}
+
+func TestSummary_negative(t *testing.T) {
+	s := NewSummary(DefaultSummaryAccuracy)
+	for _, v := range []float64{-10, -5, 0, 5, 10} {
+		s.Observe(v)
+	}
+	q, err := s.Quantile(0)
+	require.NoError(t, err)
+	assert.Equal(t, -10.0, q)
+	q, err = s.Quantile(0.5)
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, q)
+	q, err = s.Quantile(0.25)
+	require.NoError(t, err)
+	assert.InDelta(t, -5, q, 5*DefaultSummaryAccuracy)
+}
+
+func TestSummary_Merge(t *testing.T) {
+	a := NewSummary(DefaultSummaryAccuracy)
+	b := NewSummary(DefaultSummaryAccuracy)
+	whole := NewSummary(DefaultSummaryAccuracy)
+	for i := 1; i <= 100; i++ {
+		a.Observe(float64(i))
+		b.Observe(float64(i + 100))
+		whole.Observe(float64(i))
+		whole.Observe(float64(i + 100))
+	}
+	require.NoError(t, a.Merge(b))
+	assert.Equal(t, whole, a)
+	assert.Error(t, a.Merge(NewSummary(0.05)))
+}